@@ -0,0 +1,27 @@
+// Command argon2bench recommends argon2id parameters for password hashing on
+// the host it runs on, printed as the env vars chirpy reads them from
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+)
+
+func main() {
+	target := flag.Duration("target", time.Millisecond*500, "the longest a login's password check should take")
+	maxMemory := flag.Uint("memory", 64*1024, "the most memory in KiB a single hash may use")
+	flag.Parse()
+
+	params, elapsed, err := auth.RecommendPasswordParams(*target, uint32(*maxMemory))
+	if err != nil {
+		log.Fatal("Could not benchmark argon2id:", err)
+	}
+	fmt.Printf("# hashes in %v on this host\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("ARGON2_MEMORY=%d\n", params.Memory)
+	fmt.Printf("ARGON2_ITERATIONS=%d\n", params.Iterations)
+	fmt.Printf("ARGON2_PARALLELISM=%d\n", params.Parallelism)
+}
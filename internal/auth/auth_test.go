@@ -1,10 +1,17 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
 )
 
 func TestPasswordHash(t *testing.T) {
@@ -63,10 +70,49 @@ func TestPasswordHash(t *testing.T) {
 	}
 }
 
+func TestNeedsRehash(t *testing.T) {
+	weak := &argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	strong := &argon2id.Params{Memory: 16 * 1024, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	defer func() { passwordParams = argon2id.DefaultParams }()
+
+	if err := SetPasswordParams(weak); err != nil {
+		t.Fatalf("could not set params: %v", err)
+	}
+	weakHash, _ := HashPassword("MyPassword123!")
+	if needsRehash, err := NeedsRehash(weakHash); err != nil || needsRehash {
+		t.Errorf("expected a hash with the current params to be kept, got %v (%v)", needsRehash, err)
+	}
+
+	if err := SetPasswordParams(strong); err != nil {
+		t.Fatalf("could not set params: %v", err)
+	}
+	if needsRehash, _ := NeedsRehash(weakHash); !needsRehash {
+		t.Error("expected a hash with weaker params to need a rehash")
+	}
+	strongHash, _ := HashPassword("MyPassword123!")
+	if ok, _ := CheckPasswordHash("MyPassword123!", strongHash); !ok {
+		t.Error("expected the rehashed password to match")
+	}
+
+	weakParallelism := *strong
+	weakParallelism.Parallelism = 1
+	_ = SetPasswordParams(&weakParallelism)
+	if needsRehash, _ := NeedsRehash(strongHash); needsRehash {
+		t.Error("expected a parallelism change alone to keep the hash")
+	}
+
+	if _, err := NeedsRehash("invalidhash"); err == nil {
+		t.Error("expected an invalid hash to error")
+	}
+	if err := SetPasswordParams(&argon2id.Params{Memory: 1, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err == nil {
+		t.Error("expected too little memory to be rejected")
+	}
+}
+
 func TestJWTValidation(t *testing.T) {
 	tokenSecret := "mysecrettoken"
 	userID := uuid.New()
-	token, _ := MakeJWT(userID, tokenSecret, time.Hour)
+	token, _ := MakeJWT(userID, 0, tokenSecret, time.Hour)
 
 	tests := []struct {
 		name        string
@@ -100,7 +146,7 @@ func TestJWTValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("the token could not be validated when it should have: %v", err)
 			}
@@ -114,3 +160,556 @@ func TestJWTValidation(t *testing.T) {
 		})
 	}
 }
+
+type fakeRevocationStore struct {
+	revocations   []database.AccessTokenRevocation
+	tokenVersions map[uuid.UUID]int32
+}
+
+func (s *fakeRevocationStore) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	if s.tokenVersions == nil {
+		s.tokenVersions = map[uuid.UUID]int32{}
+	}
+	s.tokenVersions[id]++
+	return s.tokenVersions[id], nil
+}
+
+func (s *fakeRevocationStore) CreateAccessTokenRevocation(ctx context.Context, arg database.CreateAccessTokenRevocationParams) (database.AccessTokenRevocation, error) {
+	revocation := database.AccessTokenRevocation{
+		ID:           uuid.New(),
+		CreatedAt:    time.Now().UTC(),
+		UserID:       arg.UserID,
+		Jti:          arg.Jti,
+		ExpiresAt:    arg.ExpiresAt,
+		TokenVersion: arg.TokenVersion,
+	}
+	s.revocations = append(s.revocations, revocation)
+	return revocation, nil
+}
+
+func (s *fakeRevocationStore) GetActiveAccessTokenRevocations(ctx context.Context) ([]database.AccessTokenRevocation, error) {
+	var active []database.AccessTokenRevocation
+	for _, revocation := range s.revocations {
+		if revocation.ExpiresAt.After(time.Now().UTC()) {
+			active = append(active, revocation)
+		}
+	}
+	return active, nil
+}
+
+func (s *fakeRevocationStore) DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error) {
+	active, _ := s.GetActiveAccessTokenRevocations(ctx)
+	deleted := int64(len(s.revocations) - len(active))
+	s.revocations = active
+	return deleted, nil
+}
+
+func TestDenylist(t *testing.T) {
+	tokenSecret := "mysecrettoken"
+	ctx := context.Background()
+
+	t.Run("Revoked user tokens are rejected", func(t *testing.T) {
+		denylist := NewDenylist(&fakeRevocationStore{}, AccessTokenExpiry)
+		userID := uuid.New()
+		otherUserID := uuid.New()
+		token, _ := MakeJWT(userID, 0, tokenSecret, time.Hour)
+		otherToken, _ := MakeJWT(otherUserID, 0, tokenSecret, time.Hour)
+
+		if err := denylist.RevokeUser(ctx, userID); err != nil {
+			t.Fatalf("could not revoke user: %v", err)
+		}
+		if _, err := ValidateJWT(token, tokenSecret, denylist); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("expected %v for a revoked user but got %v", ErrTokenRevoked, err)
+		}
+		if _, err := ValidateJWT(otherToken, tokenSecret, denylist); err != nil {
+			t.Errorf("another user's token should still be valid: %v", err)
+		}
+	})
+
+	t.Run("Tokens issued in the same second after a revocation are valid", func(t *testing.T) {
+		store := &fakeRevocationStore{}
+		denylist := NewDenylist(store, AccessTokenExpiry)
+		userID := uuid.New()
+		if err := denylist.RevokeUser(ctx, userID); err != nil {
+			t.Fatalf("could not revoke user: %v", err)
+		}
+		token, _ := MakeJWT(userID, store.tokenVersions[userID], tokenSecret, time.Hour)
+		if _, err := ValidateJWT(token, tokenSecret, denylist); err != nil {
+			t.Errorf("a token issued after the revocation should be valid: %v", err)
+		}
+	})
+
+	t.Run("Revoked token ids are rejected", func(t *testing.T) {
+		denylist := NewDenylist(&fakeRevocationStore{}, AccessTokenExpiry)
+		userID := uuid.New()
+		jti := uuid.NewString()
+
+		if err := denylist.RevokeToken(ctx, jti, userID, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("could not revoke token: %v", err)
+		}
+		if !denylist.IsRevoked(jti, userID, 0) {
+			t.Error("expected the token id to be revoked")
+		}
+		if denylist.IsRevoked(uuid.NewString(), userID, 0) {
+			t.Error("expected other token ids to stay valid")
+		}
+	})
+
+	t.Run("Revocations are loaded from the store", func(t *testing.T) {
+		store := &fakeRevocationStore{}
+		userID := uuid.New()
+		_ = NewDenylist(store, AccessTokenExpiry).RevokeUser(ctx, userID)
+
+		denylist := NewDenylist(store, AccessTokenExpiry)
+		if err := denylist.Load(ctx); err != nil {
+			t.Fatalf("could not load denylist: %v", err)
+		}
+		if !denylist.IsRevoked("", userID, 0) {
+			t.Error("expected the loaded user revocation to apply")
+		}
+	})
+
+	t.Run("Expired revocations are cleaned up", func(t *testing.T) {
+		store := &fakeRevocationStore{}
+		denylist := NewDenylist(store, AccessTokenExpiry)
+		userID := uuid.New()
+		jti := uuid.NewString()
+		_ = denylist.RevokeToken(ctx, jti, userID, time.Now().Add(-time.Second))
+
+		if err := denylist.Cleanup(ctx); err != nil {
+			t.Fatalf("could not clean up denylist: %v", err)
+		}
+		if denylist.IsRevoked(jti, userID, 0) {
+			t.Error("expected the expired revocation to be ignored")
+		}
+		if len(store.revocations) != 0 {
+			t.Errorf("expected the store to be empty but it has %d revocations", len(store.revocations))
+		}
+	})
+}
+
+type fakeUserStore map[uuid.UUID]database.User
+
+func (s fakeUserStore) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	user, ok := s[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func TestRequireRole(t *testing.T) {
+	signingKey := []byte("mysecrettoken")
+	users := fakeUserStore{}
+	for _, role := range []database.UserRole{database.UserRoleUser, database.UserRoleModerator, database.UserRoleAdmin} {
+		id := uuid.New()
+		users[id] = database.User{ID: id, Role: role}
+	}
+	tokenFor := func(role database.UserRole) string {
+		for id, user := range users {
+			if user.Role == role {
+				token, _ := MakeJWT(id, 0, string(signingKey), time.Hour)
+				return token
+			}
+		}
+		return ""
+	}
+	unknownUserToken, _ := MakeJWT(uuid.New(), 0, string(signingKey), time.Hour)
+
+	authorizer := &Authorizer{Users: users, SigningKey: signingKey}
+	handler := authorizer.RequireRole(database.UserRoleModerator, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"Missing token", "", http.StatusUnauthorized},
+		{"Unknown user", unknownUserToken, http.StatusUnauthorized},
+		{"Role too low", tokenFor(database.UserRoleUser), http.StatusForbidden},
+		{"Exact role", tokenFor(database.UserRoleModerator), http.StatusNoContent},
+		{"Higher role", tokenFor(database.UserRoleAdmin), http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRequireAuthAndOptionalAuth(t *testing.T) {
+	signingKey := []byte("mysecrettoken")
+	userID := uuid.New()
+	bannedID := uuid.New()
+	users := fakeUserStore{
+		userID:   database.User{ID: userID, Role: database.UserRoleUser},
+		bannedID: database.User{ID: bannedID, Role: database.UserRoleUser, BannedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+	}
+	token, _ := MakeJWT(userID, 0, string(signingKey), time.Hour)
+	bannedToken, _ := MakeJWT(bannedID, 0, string(signingKey), time.Hour)
+	authorizer := &Authorizer{Users: users, SigningKey: signingKey}
+
+	var gotUser database.User
+	var gotOK bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotUser, gotOK = UserFromContext(req.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		authorization string
+		wantStatus    int
+		wantChallenge string
+		wantUser      bool
+	}{
+		{"Required without token", authorizer.RequireAuth(next), "", http.StatusUnauthorized, `Bearer realm="chirpy"`, false},
+		{"Required with malformed header", authorizer.RequireAuth(next), "Basic abc", http.StatusBadRequest, `Bearer realm="chirpy", error="invalid_request", error_description="malformed authorization header"`, false},
+		{"Required with bad token", authorizer.RequireAuth(next), "Bearer notavalidtoken", http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="the access token is invalid"`, false},
+		{"Required with valid token", authorizer.RequireAuth(next), "Bearer " + token, http.StatusNoContent, "", true},
+		{"Required with banned user", authorizer.RequireAuth(next), "Bearer " + bannedToken, http.StatusForbidden, `Bearer realm="chirpy"`, false},
+		{"Optional without token", authorizer.OptionalAuth(next), "", http.StatusNoContent, "", false},
+		{"Optional with bad token", authorizer.OptionalAuth(next), "Bearer notavalidtoken", http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="the access token is invalid"`, false},
+		{"Optional with valid token", authorizer.OptionalAuth(next), "Bearer " + token, http.StatusNoContent, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotOK = database.User{}, false
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("expected challenge %q but got %q", tt.wantChallenge, got)
+			}
+			if gotOK != tt.wantUser || (tt.wantUser && gotUser.ID != userID) {
+				t.Errorf("expected user in context %v but got %v (%v)", tt.wantUser, gotOK, gotUser.ID)
+			}
+		})
+	}
+}
+
+type fakeTokenStore struct {
+	tokens  map[string]database.PersonalAccessToken
+	touched []uuid.UUID
+}
+
+func (s *fakeTokenStore) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	pat, ok := s.tokens[tokenHash]
+	if !ok {
+		return database.PersonalAccessToken{}, sql.ErrNoRows
+	}
+	return pat, nil
+}
+
+func (s *fakeTokenStore) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	signingKey := []byte("mysecrettoken")
+	userID := uuid.New()
+	users := fakeUserStore{userID: database.User{ID: userID, Role: database.UserRoleAdmin}}
+	tokens := &fakeTokenStore{tokens: map[string]database.PersonalAccessToken{}}
+	addToken := func(expiresAt time.Time, revoked bool) string {
+		token, tokenHash, err := MakePersonalAccessToken()
+		if err != nil {
+			t.Fatalf("could not make token: %v", err)
+		}
+		tokens.tokens[tokenHash] = database.PersonalAccessToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			TokenHash: tokenHash,
+			Scopes:    []string{string(ScopeChirpsWrite)},
+			ExpiresAt: expiresAt,
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: revoked},
+		}
+		return token
+	}
+	validToken := addToken(time.Now().Add(time.Hour), false)
+	expiredToken := addToken(time.Now().Add(-time.Hour), false)
+	revokedToken := addToken(time.Now().Add(time.Hour), true)
+	unknownToken, _, _ := MakePersonalAccessToken()
+	sessionToken, _ := MakeJWT(userID, 0, string(signingKey), time.Hour)
+
+	authorizer := &Authorizer{Users: users, Tokens: tokens, SigningKey: signingKey}
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	admin := authorizer.RequireScope(ScopeAdmin, authorizer.RequireRole(database.UserRoleAdmin, next))
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		token      string
+		wantStatus int
+	}{
+		{"Token with the scope", authorizer.RequireScope(ScopeChirpsWrite, next), validToken, http.StatusNoContent},
+		{"Token without the scope", authorizer.RequireScope(ScopeUsersWrite, next), validToken, http.StatusForbidden},
+		{"Token cannot use admin routes", admin, validToken, http.StatusForbidden},
+		{"Session can use admin routes", admin, sessionToken, http.StatusNoContent},
+		{"Expired token", authorizer.RequireScope(ScopeChirpsWrite, next), expiredToken, http.StatusUnauthorized},
+		{"Revoked token", authorizer.RequireScope(ScopeChirpsWrite, next), revokedToken, http.StatusUnauthorized},
+		{"Unknown token", authorizer.RequireScope(ScopeChirpsWrite, next), unknownToken, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+
+	if len(tokens.touched) == 0 {
+		t.Error("expected the last used time of the valid token to be recorded")
+	}
+}
+
+func TestParseGrantableScopes(t *testing.T) {
+	scopes, ok := ParseGrantableScopes([]string{"chirps:write", "chirps:read", "chirps:write"})
+	if !ok || len(scopes) != 2 {
+		t.Errorf("expected two deduplicated scopes but got %v (ok %v)", scopes, ok)
+	}
+	if _, ok := ParseGrantableScopes([]string{"chirps:write", "users:write"}); ok {
+		t.Error("users:write should not be grantable to personal access tokens")
+	}
+}
+
+type fakeLoginThrottleStore map[string]database.LoginThrottle
+
+func (s fakeLoginThrottleStore) GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]database.LoginThrottle, error) {
+	var throttles []database.LoginThrottle
+	for _, key := range throttleKeys {
+		if throttle, ok := s[key]; ok {
+			throttles = append(throttles, throttle)
+		}
+	}
+	return throttles, nil
+}
+
+func (s fakeLoginThrottleStore) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	throttle, ok := s[arg.ThrottleKey]
+	if !ok || throttle.LastFailureAt.Before(arg.ResetBefore) {
+		throttle = database.LoginThrottle{ThrottleKey: arg.ThrottleKey, LockedUntil: throttle.LockedUntil}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = time.Now().UTC()
+	s[arg.ThrottleKey] = throttle
+	return throttle, nil
+}
+
+func (s fakeLoginThrottleStore) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	throttle := s[arg.ThrottleKey]
+	throttle.LockedUntil = arg.LockedUntil
+	s[arg.ThrottleKey] = throttle
+	return nil
+}
+
+func (s fakeLoginThrottleStore) DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error) {
+	if _, ok := s[throttleKey]; !ok {
+		return 0, nil
+	}
+	delete(s, throttleKey)
+	return 1, nil
+}
+
+func (s fakeLoginThrottleStore) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestLoginPolicyLockout(t *testing.T) {
+	policy := LoginPolicy{FreeAttempts: 3, BaseLockout: time.Second, MaxLockout: time.Second * 10}
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, time.Second * 2},
+		{6, time.Second * 4},
+		{7, time.Second * 8},
+		{8, time.Second * 10},
+		{100, time.Second * 10},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Lockout(tt.failures); got != tt.want {
+			t.Errorf("Lockout(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	store := fakeLoginThrottleStore{}
+	throttle := NewLoginThrottle(store)
+	throttle.AccountPolicy.FreeAttempts = 2
+	throttle.IPPolicy.FreeAttempts = 4
+
+	fail := func(email, ip string) time.Duration {
+		t.Helper()
+		lockout, err := throttle.RecordFailure(ctx, email, ip)
+		if err != nil {
+			t.Fatalf("could not record failure: %v", err)
+		}
+		return lockout
+	}
+	retryAfter := func(email, ip string) time.Duration {
+		t.Helper()
+		retryAfter, err := throttle.RetryAfter(ctx, email, ip)
+		if err != nil {
+			t.Fatalf("could not check lockout: %v", err)
+		}
+		return retryAfter
+	}
+
+	t.Run("Account lockout", func(t *testing.T) {
+		fail("walt@breakingbad.com", "10.0.0.1")
+		if lockout := fail("Walt@BreakingBad.com ", "10.0.0.2"); lockout != 0 {
+			t.Fatalf("expected no lockout within the free attempts, got %v", lockout)
+		}
+		if lockout := fail("walt@breakingbad.com", "10.0.0.3"); lockout != throttle.AccountPolicy.BaseLockout {
+			t.Fatalf("expected the base lockout, got %v", lockout)
+		}
+		if retryAfter("walt@breakingbad.com", "10.0.0.4") <= 0 {
+			t.Error("expected the account to be locked from any address")
+		}
+		if retryAfter("jesse@breakingbad.com", "10.0.0.4") != 0 {
+			t.Error("expected other accounts to be unaffected")
+		}
+	})
+
+	t.Run("IP lockout", func(t *testing.T) {
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+			fail(email, "192.168.0.1")
+		}
+		if lockout := fail("e@example.com", "192.168.0.1"); lockout != throttle.IPPolicy.BaseLockout {
+			t.Fatalf("expected the ip to be locked out, got %v", lockout)
+		}
+		if retryAfter("f@example.com", "192.168.0.1") <= 0 {
+			t.Error("expected the ip to be locked for every account")
+		}
+	})
+
+	t.Run("Success and unlock", func(t *testing.T) {
+		if err := throttle.RecordSuccess(ctx, "e@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store[accountThrottleKey("e@example.com")]; ok {
+			t.Error("expected a successful login to clear the account's failures")
+		}
+		if _, ok := store[ipThrottleKey("192.168.0.1")]; !ok {
+			t.Error("expected a successful login to keep the ip's failures")
+		}
+
+		unlocked, err := throttle.Unlock(ctx, "walt@breakingbad.com", "192.168.0.1")
+		if err != nil || !unlocked {
+			t.Fatalf("expected Unlock to clear lockouts, got %v (%v)", unlocked, err)
+		}
+		if retryAfter("walt@breakingbad.com", "192.168.0.1") != 0 {
+			t.Error("expected no lockout after unlocking")
+		}
+		if unlocked, _ := throttle.Unlock(ctx, "nobody@example.com", ""); unlocked {
+			t.Error("expected nothing to unlock for an unknown email")
+		}
+	})
+}
+
+func TestSessionCookies(t *testing.T) {
+	signingKey := []byte("mysecrettoken")
+	userID := uuid.New()
+	users := fakeUserStore{userID: database.User{ID: userID, Role: database.UserRoleUser}}
+	token, _ := MakeJWT(userID, 0, string(signingKey), time.Hour)
+	authorizer := &Authorizer{Users: users, SigningKey: signingKey}
+	handler := authorizer.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	csrfToken, err := MakeCSRFToken(userID, signingKey)
+	if err != nil {
+		t.Fatalf("could not make csrf token: %v", err)
+	}
+	otherCSRFToken, _ := MakeCSRFToken(uuid.New(), signingKey)
+
+	rec := httptest.NewRecorder()
+	SetSessionCookies(rec, token, "refresh", csrfToken, true)
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("cookie %s is missing security attributes", cookie.Name)
+		}
+	}
+	if !cookies[AccessTokenCookie].HttpOnly || !cookies[RefreshTokenCookie].HttpOnly || cookies[CSRFCookie].HttpOnly {
+		t.Error("only the csrf cookie should be readable by JavaScript")
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		csrfCookie string
+		csrfHeader string
+		wantStatus int
+	}{
+		{"Safe method without csrf token", http.MethodGet, "", "", http.StatusNoContent},
+		{"Unsafe method with csrf token", http.MethodPost, csrfToken, csrfToken, http.StatusNoContent},
+		{"Unsafe method without csrf token", http.MethodPost, csrfToken, "", http.StatusForbidden},
+		{"Header doesn't match cookie", http.MethodDelete, csrfToken, otherCSRFToken, http.StatusForbidden},
+		{"Token signed for another user", http.MethodPut, otherCSRFToken, otherCSRFToken, http.StatusForbidden},
+		{"Forged token", http.MethodPost, "abc.def", "abc.def", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			req.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: token})
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d but got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+
+	t.Run("Bearer tokens skip the csrf check", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected status %d but got %d", http.StatusNoContent, rec.Code)
+		}
+	})
+}
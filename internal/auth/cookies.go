@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Cookie names and the header the web app echoes the CSRF token back in
+const (
+	AccessTokenCookie  = "chirpy_access"
+	RefreshTokenCookie = "chirpy_refresh"
+	CSRFCookie         = "chirpy_csrf"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// The refresh token is only needed by the refresh and revoke endpoints
+const refreshTokenCookiePath = "/api"
+
+var ErrInvalidCSRFToken = errors.New("the csrf token is missing or invalid")
+
+// SetSessionCookies stores a login in cookies the web app's JavaScript can't
+// read, except for the CSRF token which it has to echo back in CSRFHeader
+func SetSessionCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string, secure bool) {
+	SetAccessTokenCookie(w, accessToken, secure)
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    refreshToken,
+		Path:     refreshTokenCookiePath,
+		MaxAge:   int(RefreshTokenExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   int(RefreshTokenExpiry.Seconds()),
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// SetAccessTokenCookie replaces the access token after a refresh
+func SetAccessTokenCookie(w http.ResponseWriter, accessToken string, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AccessTokenCookie,
+		Value:    accessToken,
+		Path:     "/",
+		MaxAge:   int(AccessTokenExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookies removes every session cookie on logout
+func ClearSessionCookies(w http.ResponseWriter, secure bool) {
+	for name, path := range map[string]string{
+		AccessTokenCookie:  "/",
+		RefreshTokenCookie: refreshTokenCookiePath,
+		CSRFCookie:         "/",
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: name != CSRFCookie,
+			Secure:   secure,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// AccessTokenFromRequest returns the bearer token, or the access token cookie
+// when there is no Authorization header. fromCookie tells callers to check
+// the CSRF token.
+func AccessTokenFromRequest(req *http.Request) (token string, fromCookie bool, err error) {
+	return tokenFromRequest(req, AccessTokenCookie)
+}
+
+// RefreshTokenFromRequest is AccessTokenFromRequest for refresh tokens
+func RefreshTokenFromRequest(req *http.Request) (token string, fromCookie bool, err error) {
+	return tokenFromRequest(req, RefreshTokenCookie)
+}
+
+func tokenFromRequest(req *http.Request, cookieName string) (string, bool, error) {
+	if req.Header.Get("Authorization") != "" {
+		token, err := GetBearerToken(req.Header)
+		return token, false, err
+	}
+	cookie, err := req.Cookie(cookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false, errors.New("no bearer token or session cookie supplied")
+	}
+	return cookie.Value, true, nil
+}
+
+func hasSessionCookie(req *http.Request) bool {
+	cookie, err := req.Cookie(AccessTokenCookie)
+	return err == nil && cookie.Value != ""
+}
+
+// MakeCSRFToken returns a random token signed for userID, so a token planted
+// in the cookie by another site or subdomain can't be used against the user
+func MakeCSRFToken(userID uuid.UUID, key []byte) (string, error) {
+	random, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return random + "." + signCSRF(random, userID, key), nil
+}
+
+// CheckCSRF enforces the signed double submit pattern on requests that change
+// state: the CSRFHeader must match the CSRFCookie and be signed for userID
+func CheckCSRF(req *http.Request, userID uuid.UUID, key []byte) error {
+	if isSafeMethod(req.Method) {
+		return nil
+	}
+	cookie, err := req.Cookie(CSRFCookie)
+	if err != nil {
+		return ErrInvalidCSRFToken
+	}
+	header := req.Header.Get(CSRFHeader)
+	if header == "" || !hmac.Equal([]byte(header), []byte(cookie.Value)) {
+		return ErrInvalidCSRFToken
+	}
+	random, signature, ok := strings.Cut(header, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCSRF(random, userID, key))) {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func signCSRF(random string, userID uuid.UUID, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("csrf:" + userID.String() + ":" + random))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// RevocationStore persists access token revocations so they survive restarts
+// and are shared between instances.
+type RevocationStore interface {
+	IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+	CreateAccessTokenRevocation(ctx context.Context, arg database.CreateAccessTokenRevocationParams) (database.AccessTokenRevocation, error)
+	GetActiveAccessTokenRevocations(ctx context.Context) ([]database.AccessTokenRevocation, error)
+	DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error)
+}
+
+// userRevocation revokes the user's tokens issued before their token version
+// reached tokenVersion
+type userRevocation struct {
+	tokenVersion int32
+	expiresAt    time.Time
+}
+
+// Denylist tracks revoked access tokens. Revocations are written to the store
+// and mirrored in memory so checking a token never touches the database.
+// Entries are dropped once the tokens they cover would have expired anyway.
+type Denylist struct {
+	store  RevocationStore
+	maxTTL time.Duration
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uuid.UUID]userRevocation
+}
+
+// NewDenylist creates a Denylist backed by store. maxTTL must be at least the
+// lifetime of any access token issued so user wide revocations cover them.
+func NewDenylist(store RevocationStore, maxTTL time.Duration) *Denylist {
+	return &Denylist{
+		store:  store,
+		maxTTL: maxTTL,
+		tokens: make(map[string]time.Time),
+		users:  make(map[uuid.UUID]userRevocation),
+	}
+}
+
+// RevokeToken revokes the single access token identified by jti.
+func (d *Denylist) RevokeToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	_, err := d.store.CreateAccessTokenRevocation(ctx, database.CreateAccessTokenRevocationParams{
+		UserID:    userID,
+		Jti:       sql.NullString{String: jti, Valid: true},
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens[jti] = expiresAt.UTC()
+	return nil
+}
+
+// RevokeUser revokes every access token issued to the user up to now. It
+// bumps the user's token version so tokens issued from here on, even within
+// the same second, carry the new one.
+func (d *Denylist) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	tokenVersion, err := d.store.IncrementUserTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	revocation, err := d.store.CreateAccessTokenRevocation(ctx, database.CreateAccessTokenRevocationParams{
+		UserID:       userID,
+		ExpiresAt:    time.Now().UTC().Add(d.maxTTL),
+		TokenVersion: tokenVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addUserRevocation(revocation)
+	return nil
+}
+
+// IsRevoked reports whether a token with the given jti, subject and token
+// version has been revoked.
+func (d *Denylist) IsRevoked(jti string, userID uuid.UUID, tokenVersion int32) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := time.Now().UTC()
+	if jti != "" {
+		if expiresAt, ok := d.tokens[jti]; ok && expiresAt.After(now) {
+			return true
+		}
+	}
+	if revocation, ok := d.users[userID]; ok && revocation.expiresAt.After(now) {
+		return tokenVersion < revocation.tokenVersion
+	}
+	return false
+}
+
+// Load replaces the in memory entries with the active revocations in the store.
+func (d *Denylist) Load(ctx context.Context) error {
+	revocations, err := d.store.GetActiveAccessTokenRevocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens = make(map[string]time.Time, len(revocations))
+	d.users = make(map[uuid.UUID]userRevocation)
+	for _, revocation := range revocations {
+		if revocation.Jti.Valid {
+			d.tokens[revocation.Jti.String] = revocation.ExpiresAt
+		} else {
+			d.addUserRevocation(revocation)
+		}
+	}
+	return nil
+}
+
+// Cleanup removes expired revocations from memory and from the store.
+func (d *Denylist) Cleanup(ctx context.Context) error {
+	now := time.Now().UTC()
+	d.mu.Lock()
+	for jti, expiresAt := range d.tokens {
+		if !expiresAt.After(now) {
+			delete(d.tokens, jti)
+		}
+	}
+	for userID, revocation := range d.users {
+		if !revocation.expiresAt.After(now) {
+			delete(d.users, userID)
+		}
+	}
+	d.mu.Unlock()
+
+	_, err := d.store.DeleteExpiredAccessTokenRevocations(ctx)
+	return err
+}
+
+// Run periodically cleans up expired entries and reloads revocations made by
+// other instances until ctx is cancelled.
+func (d *Denylist) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Cleanup(ctx); err != nil {
+				slog.Error("could not clean up the access token denylist", "error", err)
+			}
+			if err := d.Load(ctx); err != nil {
+				slog.Error("could not reload the access token denylist", "error", err)
+			}
+		}
+	}
+}
+
+// addUserRevocation keeps the revocation with the highest token version per
+// user. d.mu must be held.
+func (d *Denylist) addUserRevocation(revocation database.AccessTokenRevocation) {
+	current, ok := d.users[revocation.UserID]
+	if ok && current.tokenVersion > revocation.TokenVersion {
+		return
+	}
+	d.users[revocation.UserID] = userRevocation{
+		tokenVersion: revocation.TokenVersion,
+		expiresAt:    revocation.ExpiresAt,
+	}
+}
@@ -1,12 +1,108 @@
 // Package auth contains authentication/security functionality for chirpy
 package auth
 
-import "github.com/alexedwards/argon2id"
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// passwordParams are used for new hashes, set them with SetPasswordParams
+var passwordParams = argon2id.DefaultParams
+
+// SetPasswordParams changes the parameters used to hash passwords. It should be
+// called at startup, before any passwords are hashed or checked.
+func SetPasswordParams(params *argon2id.Params) error {
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return errors.New("argon2id memory must be at least 8KiB per thread")
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return errors.New("argon2id iterations and parallelism must be at least 1")
+	}
+	if params.SaltLength < 16 || params.KeyLength < 16 {
+		return errors.New("argon2id salt and key lengths must be at least 16 bytes")
+	}
+	passwordParams = params
+	return nil
+}
 
 func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, argon2id.DefaultParams)
+	return argon2id.CreateHash(password, passwordParams)
 }
 
 func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
+
+// NeedsRehash reports whether hash was created with less memory, fewer
+// iterations or shorter salts or keys than the current parameters. The
+// parallelism only changes how the work is spread so it is not compared.
+func NeedsRehash(hash string) (bool, error) {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.SaltLength < passwordParams.SaltLength ||
+		params.KeyLength < passwordParams.KeyLength, nil
+}
+
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("chirpy-dummy-password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// CheckDummyPassword does the same work as checking a real password and always
+// fails, so logins for unknown emails take as long as ones for real users
+func CheckDummyPassword(password string) {
+	_, _ = CheckPasswordHash(password, dummyHash())
+}
+
+// RecommendPasswordParams finds the most iterations that hash a password within
+// target on this host using maxMemory KiB across every CPU. If a single
+// iteration is already too slow the memory is halved until it fits.
+func RecommendPasswordParams(target time.Duration, maxMemory uint32) (*argon2id.Params, time.Duration, error) {
+	params := &argon2id.Params{
+		Memory:      maxMemory,
+		Iterations:  1,
+		Parallelism: uint8(min(runtime.NumCPU(), 255)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	measure := func() (time.Duration, error) {
+		start := time.Now()
+		_, err := argon2id.CreateHash("benchmark-password", params)
+		return time.Since(start), err
+	}
+
+	elapsed, err := measure()
+	if err != nil {
+		return nil, 0, err
+	}
+	for elapsed > target && params.Memory/2 >= 8*uint32(params.Parallelism) {
+		params.Memory /= 2
+		if elapsed, err = measure(); err != nil {
+			return nil, 0, err
+		}
+	}
+	for elapsed < target {
+		params.Iterations++
+		next, err := measure()
+		if err != nil {
+			return nil, 0, err
+		}
+		if next > target {
+			params.Iterations--
+			break
+		}
+		elapsed = next
+	}
+	return params, elapsed, nil
+}
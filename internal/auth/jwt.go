@@ -17,14 +17,60 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		Issuer:    string(TokenTypeAccess),
-		Subject:   userID.String(),
+// AccessTokenExpiry is how long access tokens issued by chirpy stay valid
+const AccessTokenExpiry = time.Hour
+
+var ErrTokenRevoked = errors.New("the token has been revoked")
+
+// AccessClaims are the claims in access tokens issued by chirpy. Scope and
+// ClientID are only set on tokens issued to OAuth clients. TokenVersion is the
+// user's token version when the token was issued, revoking a user's tokens
+// bumps it.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope        string `json:"scope,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	TokenVersion int32  `json:"ver,omitempty"`
+}
+
+// Scopes returns the scopes the token grants, tokens from a password login
+// hold every session scope
+func (claims *AccessClaims) Scopes() []Scope {
+	if claims.Scope == "" {
+		return SessionScopes
+	}
+	return ParseScopeString(claims.Scope)
+}
+
+// MakeJWT makes an access token for the user, tokenVersion is the user's
+// current token version
+func MakeJWT(userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signAccessClaims(newAccessClaims(userID, tokenVersion, expiresIn), tokenSecret)
+}
+
+// MakeClientJWT makes an access token for an OAuth client acting on behalf of
+// the user, limited to scopes
+func MakeClientJWT(userID uuid.UUID, tokenVersion int32, clientID uuid.UUID, scopes []Scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims := newAccessClaims(userID, tokenVersion, expiresIn)
+	claims.Scope = JoinScopes(scopes)
+	claims.ClientID = clientID.String()
+	return signAccessClaims(claims, tokenSecret)
+}
+
+func newAccessClaims(userID uuid.UUID, tokenVersion int32, expiresIn time.Duration) *AccessClaims {
+	return &AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    string(TokenTypeAccess),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+		TokenVersion: tokenVersion,
 	}
+}
 
+func signAccessClaims(claims *AccessClaims, tokenSecret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	signedtoken, err := token.SignedString([]byte(tokenSecret))
@@ -35,27 +81,39 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return signedtoken, nil
 }
 
-func ValidateJWT(token, tokenSecret string) (uuid.UUID, error) {
-	parsedToken, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
+// ValidateJWT checks the token signature and expiry and returns the user it was
+// issued to. When denylist is not nil revoked tokens are rejected as well.
+func ValidateJWT(token, tokenSecret string, denylist *Denylist) (uuid.UUID, error) {
+	_, userID, err := ParseJWT(token, tokenSecret, denylist)
+	return userID, err
+}
+
+// ParseJWT validates the token like ValidateJWT and also returns its claims
+func ParseJWT(token, tokenSecret string, denylist *Denylist) (*AccessClaims, uuid.UUID, error) {
+	parsedToken, err := jwt.ParseWithClaims(token, &AccessClaims{}, func(token *jwt.Token) (any, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return uuid.Nil, err
+		return nil, uuid.Nil, err
 	}
 
-	if claims, ok := parsedToken.Claims.(*jwt.RegisteredClaims); ok {
+	if claims, ok := parsedToken.Claims.(*AccessClaims); ok {
 		userIDString, err := claims.GetSubject()
 		if err != nil {
-			return uuid.Nil, err
+			return nil, uuid.Nil, err
 		}
 
 		userID, err := uuid.Parse(userIDString)
 		if err != nil {
-			return uuid.Nil, err
+			return nil, uuid.Nil, err
+		}
+
+		if denylist != nil && denylist.IsRevoked(claims.ID, userID, claims.TokenVersion) {
+			return nil, uuid.Nil, ErrTokenRevoked
 		}
-		return userID, nil
+		return claims, userID, nil
 	} else {
-		return uuid.Nil, errors.New("the claims could not be cast to *jwt.RegisteredClaims")
+		return nil, uuid.Nil, errors.New("the claims could not be cast to *AccessClaims")
 	}
 }
 
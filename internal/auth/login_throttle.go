@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// LoginThrottleStore persists failed login attempts
+type LoginThrottleStore interface {
+	GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]database.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error
+	DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error)
+	DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error)
+}
+
+// LoginPolicy decides when repeated failures lock logins out. After
+// FreeAttempts failures each further failure locks for BaseLockout, doubling
+// every time up to MaxLockout. Failures are forgotten after ResetAfter.
+type LoginPolicy struct {
+	FreeAttempts int32
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	ResetAfter   time.Duration
+}
+
+// Lockout returns how long to lock logins out after failures failed attempts
+func (p LoginPolicy) Lockout(failures int32) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts + 1; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.MaxLockout)
+}
+
+var (
+	// AccountLoginPolicy protects a single account from password guessing
+	AccountLoginPolicy = LoginPolicy{
+		FreeAttempts: 5,
+		BaseLockout:  time.Second * 30,
+		MaxLockout:   time.Hour,
+		ResetAfter:   time.Hour * 24,
+	}
+	// IPLoginPolicy is looser as addresses can be shared behind NAT but stops
+	// one client from spraying guesses across many accounts
+	IPLoginPolicy = LoginPolicy{
+		FreeAttempts: 20,
+		BaseLockout:  time.Second * 10,
+		MaxLockout:   time.Hour,
+		ResetAfter:   time.Hour * 24,
+	}
+)
+
+// LoginThrottle tracks failed logins per account and per client IP and locks
+// them out with exponential backoff
+type LoginThrottle struct {
+	store         LoginThrottleStore
+	AccountPolicy LoginPolicy
+	IPPolicy      LoginPolicy
+}
+
+func NewLoginThrottle(store LoginThrottleStore) *LoginThrottle {
+	return &LoginThrottle{
+		store:         store,
+		AccountPolicy: AccountLoginPolicy,
+		IPPolicy:      IPLoginPolicy,
+	}
+}
+
+// Accounts are tracked by the email attempted so unknown emails are throttled
+// exactly like real ones
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter returns how long the account or IP is still locked out for, zero
+// means the login may be attempted
+func (t *LoginThrottle) RetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	throttles, err := t.store.GetLoginThrottles(ctx, []string{accountThrottleKey(email), ipThrottleKey(ip)})
+	if err != nil {
+		return 0, err
+	}
+
+	var retryAfter time.Duration
+	now := time.Now().UTC()
+	for _, throttle := range throttles {
+		if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(now) {
+			retryAfter = max(retryAfter, throttle.LockedUntil.Time.Sub(now))
+		}
+	}
+	return retryAfter, nil
+}
+
+// RecordFailure counts a failed login and returns how long the caller is now
+// locked out for, if at all
+func (t *LoginThrottle) RecordFailure(ctx context.Context, email, ip string) (time.Duration, error) {
+	accountLockout, err := t.recordFailure(ctx, accountThrottleKey(email), t.AccountPolicy)
+	if err != nil {
+		return 0, err
+	}
+	ipLockout, err := t.recordFailure(ctx, ipThrottleKey(ip), t.IPPolicy)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountLockout, ipLockout), nil
+}
+
+func (t *LoginThrottle) recordFailure(ctx context.Context, key string, policy LoginPolicy) (time.Duration, error) {
+	now := time.Now().UTC()
+	throttle, err := t.store.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		ThrottleKey: key,
+		ResetBefore: now.Add(-policy.ResetAfter),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	lockout := policy.Lockout(throttle.Failures)
+	if lockout == 0 {
+		return 0, nil
+	}
+	err = t.store.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+		ThrottleKey: key,
+		LockedUntil: sql.NullTime{Time: now.Add(lockout), Valid: true},
+	})
+	return lockout, err
+}
+
+// RecordSuccess forgets the account's failed logins. The IP's are kept so a
+// client can't reset its count by logging into an account it controls.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, email string) error {
+	_, err := t.store.DeleteLoginThrottle(ctx, accountThrottleKey(email))
+	return err
+}
+
+// Unlock clears the lockout for an account and or IP, empty values are skipped
+func (t *LoginThrottle) Unlock(ctx context.Context, email, ip string) (bool, error) {
+	var unlocked bool
+	if email != "" {
+		rows, err := t.store.DeleteLoginThrottle(ctx, accountThrottleKey(email))
+		if err != nil {
+			return false, err
+		}
+		unlocked = rows > 0
+	}
+	if ip != "" {
+		rows, err := t.store.DeleteLoginThrottle(ctx, ipThrottleKey(ip))
+		if err != nil {
+			return false, err
+		}
+		unlocked = unlocked || rows > 0
+	}
+	return unlocked, nil
+}
+
+// Run periodically removes failures that are old enough to be forgotten until
+// ctx is cancelled
+func (t *LoginThrottle) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resetAfter := max(t.AccountPolicy.ResetAfter, t.IPPolicy.ResetAfter)
+			_, err := t.store.DeleteStaleLoginThrottles(ctx, time.Now().UTC().Add(-resetAfter))
+			if err != nil {
+				slog.Error("could not clean up login throttles", "error", err)
+			}
+		}
+	}
+}
+
+// ClientIP returns the address of the client that sent req
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// RetryAfterSeconds formats a lockout for the Retry-After header, rounding up
+// so clients never retry early
+func RetryAfterSeconds(lockout time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(lockout.Seconds())))
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+const authRealm = "chirpy"
+
+// RFC 6750 error codes
+const (
+	bearerErrInvalidRequest    = "invalid_request"
+	bearerErrInvalidToken      = "invalid_token"
+	bearerErrInsufficientScope = "insufficient_scope"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	scopesContextKey
+)
+
+// UserStore looks up the users that access tokens are issued to
+type UserStore interface {
+	GetUserById(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+// PersonalAccessTokenStore looks up personal access tokens and records their use
+type PersonalAccessTokenStore interface {
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error
+}
+
+// Authorizer builds middleware that authenticates requests with access tokens
+// or, when Tokens is set, personal access tokens
+type Authorizer struct {
+	Users      UserStore
+	Tokens     PersonalAccessTokenStore
+	SigningKey []byte
+	Denylist   *Denylist
+}
+
+// ContextWithUser returns a copy of ctx carrying the authenticated user
+func ContextWithUser(ctx context.Context, user database.User) context.Context {
+	ctx = logging.WithUserID(ctx, user.ID)
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user stored by RequireAuth or
+// OptionalAuth, ok is false for anonymous requests
+func UserFromContext(ctx context.Context) (database.User, bool) {
+	user, ok := ctx.Value(userContextKey).(database.User)
+	return user, ok
+}
+
+// ContextWithScopes returns a copy of ctx carrying the scopes the request was
+// authenticated with
+func ContextWithScopes(ctx context.Context, scopes []Scope) context.Context {
+	return context.WithValue(ctx, scopesContextKey, scopes)
+}
+
+// ScopesFromContext returns the scopes the request was authenticated with
+func ScopesFromContext(ctx context.Context) []Scope {
+	scopes, _ := ctx.Value(scopesContextKey).([]Scope)
+	return scopes
+}
+
+// HasScope reports whether the request was authenticated with scope
+func HasScope(ctx context.Context, scope Scope) bool {
+	return slices.Contains(ScopesFromContext(ctx), scope)
+}
+
+// RequireAuth rejects requests without a valid access token and stores the
+// user it was issued to in the request context. The token is read from the
+// Authorization header or the session cookie, cookie requests that change
+// state also need a valid CSRF token.
+func (a *Authorizer) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "" && !hasSessionCookie(req) {
+			respondWithBearerError(w, http.StatusUnauthorized, "", "missing access token", errors.New("missing access token"))
+			return
+		}
+		a.authenticate(w, req, next)
+	})
+}
+
+// OptionalAuth lets anonymous requests through but still rejects invalid
+// access tokens, when a token is valid its user is stored in the request context
+func (a *Authorizer) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "" && !hasSessionCookie(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		a.authenticate(w, req, next)
+	})
+}
+
+// RequireRole only lets requests through from users with at least role
+func (a *Authorizer) RequireRole(role database.UserRole, next http.Handler) http.Handler {
+	return a.ensureAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, _ := UserFromContext(req.Context())
+		if !HasRole(user.Role, role) {
+			respondWithBearerError(w, http.StatusForbidden, bearerErrInsufficientScope, "user does not have the required role", errors.New("user does not have the required role"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// RequireScope rejects authenticated requests that were not granted scope
+func (a *Authorizer) RequireScope(scope Scope, next http.Handler) http.Handler {
+	return a.ensureAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !HasScope(req.Context(), scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=%q, scope=%q", authRealm, bearerErrInsufficientScope, scope))
+			utils.RespondWithError(w, http.StatusForbidden, "the token is missing the "+string(scope)+" scope", errors.New("missing scope"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// ensureAuth runs RequireAuth unless an outer middleware already authenticated
+// the request, so checks can be stacked without validating the token twice
+func (a *Authorizer) ensureAuth(next http.Handler) http.Handler {
+	requireAuth := a.RequireAuth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := UserFromContext(req.Context()); ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+		requireAuth.ServeHTTP(w, req)
+	})
+}
+
+func (a *Authorizer) authenticate(w http.ResponseWriter, req *http.Request, next http.Handler) {
+	bearerToken, fromCookie, err := AccessTokenFromRequest(req)
+	if err != nil {
+		respondWithBearerError(w, http.StatusBadRequest, bearerErrInvalidRequest, "malformed authorization header", err)
+		return
+	}
+
+	var userID uuid.UUID
+	var scopes []Scope
+	if IsPersonalAccessToken(bearerToken) && a.Tokens != nil {
+		userID, scopes, err = a.validatePersonalAccessToken(req.Context(), bearerToken)
+	} else {
+		var claims *AccessClaims
+		claims, userID, err = ParseJWT(bearerToken, string(a.SigningKey), a.Denylist)
+		if err == nil {
+			scopes = claims.Scopes()
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errTokenLookup) {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not get token from the db", err)
+		} else {
+			respondWithBearerError(w, http.StatusUnauthorized, bearerErrInvalidToken, "the access token is invalid", err)
+		}
+		return
+	}
+	if fromCookie {
+		if err := CheckCSRF(req, userID, a.SigningKey); err != nil {
+			utils.RespondWithError(w, http.StatusForbidden, "the csrf token is missing or invalid", err)
+			return
+		}
+	}
+
+	user, err := a.Users.GetUserById(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithBearerError(w, http.StatusUnauthorized, bearerErrInvalidToken, "the access token is invalid", err)
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not get user from the db", err)
+		}
+		return
+	}
+	if user.BannedAt.Valid {
+		respondWithBearerError(w, http.StatusForbidden, "", ErrUserBanned.Error(), ErrUserBanned)
+		return
+	}
+
+	ctx := ContextWithScopes(ContextWithUser(req.Context(), user), scopes)
+	next.ServeHTTP(w, req.WithContext(ctx))
+}
+
+var errTokenLookup = errors.New("could not look up token")
+
+func (a *Authorizer) validatePersonalAccessToken(ctx context.Context, token string) (uuid.UUID, []Scope, error) {
+	pat, err := a.Tokens.GetPersonalAccessTokenByHash(ctx, HashPersonalAccessToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, nil, errors.New("unknown personal access token")
+		}
+		return uuid.Nil, nil, fmt.Errorf("%w: %w", errTokenLookup, err)
+	}
+	if pat.RevokedAt.Valid {
+		return uuid.Nil, nil, ErrTokenRevoked
+	}
+	if pat.ExpiresAt.UTC().Before(time.Now().UTC()) {
+		return uuid.Nil, nil, errors.New("the personal access token has expired")
+	}
+
+	err = a.Tokens.TouchPersonalAccessToken(ctx, pat.ID)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%w: %w", errTokenLookup, err)
+	}
+
+	scopes := make([]Scope, len(pat.Scopes))
+	for i, scope := range pat.Scopes {
+		scopes[i] = Scope(scope)
+	}
+	return pat.UserID, scopes, nil
+}
+
+// respondWithBearerError sets the WWW-Authenticate challenge described in
+// RFC 6750 section 3 before writing the usual JSON error
+func respondWithBearerError(w http.ResponseWriter, code int, bearerErr, msg string, err error) {
+	challenge := fmt.Sprintf("Bearer realm=%q", authRealm)
+	if bearerErr != "" {
+		challenge += fmt.Sprintf(", error=%q, error_description=%q", bearerErr, msg)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	utils.RespondWithError(w, code, msg, err)
+}
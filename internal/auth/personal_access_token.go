@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new token to show the user once and the
+// hash to store in its place
+func MakePersonalAccessToken() (string, string, error) {
+	rawToken := make([]byte, 32)
+	_, err := rand.Read(rawToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := PersonalAccessTokenPrefix + hex.EncodeToString(rawToken)
+	return token, HashPersonalAccessToken(token), nil
+}
+
+// HashPersonalAccessToken hashes a token for storage and lookup
+func HashPersonalAccessToken(token string) string {
+	return HashToken(token)
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
@@ -2,9 +2,14 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"time"
 )
 
+// RefreshTokenExpiry is how long refresh tokens issued by chirpy stay valid
+const RefreshTokenExpiry = time.Hour * 24 * 60
+
 func MakeRefreshToken() (string, error) {
 	rawRefreshToken := make([]byte, 32)
 	_, err := rand.Read(rawRefreshToken)
@@ -14,3 +19,10 @@ func MakeRefreshToken() (string, error) {
 
 	return hex.EncodeToString(rawRefreshToken), nil
 }
+
+// HashToken hashes a random token for storage and lookup. The tokens are
+// random so a fast hash is enough, unlike passwords.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
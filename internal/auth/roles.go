@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// ErrUserBanned is returned when a banned user tries to sign in or use a token
+var ErrUserBanned = errors.New("the user is banned")
+
+// roleRanks orders roles so that each role includes the ones below it
+var roleRanks = map[database.UserRole]int{
+	database.UserRoleUser:      1,
+	database.UserRoleModerator: 2,
+	database.UserRoleAdmin:     3,
+}
+
+// ValidRole reports whether role is one chirpy knows about
+func ValidRole(role database.UserRole) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether a user with role have is allowed to act as want
+func HasRole(have, want database.UserRole) bool {
+	haveRank, ok := roleRanks[have]
+	if !ok {
+		return false
+	}
+	return haveRank >= roleRanks[want]
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scope limits what a credential is allowed to do
+type Scope string
+
+const (
+	ScopeChirpsRead  Scope = "chirps:read"
+	ScopeChirpsWrite Scope = "chirps:write"
+	ScopeUsersWrite  Scope = "users:write"
+	ScopeTokensWrite Scope = "tokens:write"
+	// ScopeWebhooksWrite manages outbound webhook endpoints
+	ScopeWebhooksWrite Scope = "webhooks:write"
+	ScopeAdmin         Scope = "admin"
+)
+
+// GrantableScopes can be given to personal access tokens. Changing the
+// account or minting new tokens is reserved for password logins.
+var GrantableScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeWebhooksWrite}
+
+// SessionScopes are held by access tokens from a password login
+var SessionScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersWrite, ScopeTokensWrite, ScopeWebhooksWrite, ScopeAdmin}
+
+// ParseGrantableScopes converts requested scope names into scopes, ok is false
+// if any of them can't be granted to a personal access token
+func ParseGrantableScopes(names []string) ([]Scope, bool) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(name)
+		if !slices.Contains(GrantableScopes, scope) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+// ParseScopeString splits a space separated OAuth scope parameter
+func ParseScopeString(scope string) []Scope {
+	fields := strings.Fields(scope)
+	scopes := make([]Scope, len(fields))
+	for i, field := range fields {
+		scopes[i] = Scope(field)
+	}
+	return scopes
+}
+
+// JoinScopes formats scopes as a space separated OAuth scope parameter
+func JoinScopes(scopes []Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, " ")
+}
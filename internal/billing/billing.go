@@ -0,0 +1,240 @@
+// Package billing tracks Chirpy Red subscriptions through their lifecycle,
+// a user is a member while HasAccess holds for their subscription
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// PlanChirpyRed is the plan members are on unless the provider names another
+const PlanChirpyRed = "chirpy_red"
+
+const (
+	// DefaultPeriod is used when the provider doesn't send the period's end
+	DefaultPeriod = time.Hour * 24 * 30
+	// DefaultGracePeriod keeps members on while a renewal or failed payment is
+	// retried by the provider
+	DefaultGracePeriod = time.Hour * 24 * 3
+)
+
+var (
+	ErrUnknownUser    = errors.New("the user could not be found")
+	ErrNoSubscription = errors.New("the user has no subscription")
+)
+
+// Store holds users' subscriptions
+type Store interface {
+	GetUserById(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error)
+	UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error)
+	ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// Period is the billing period an event applies to, zero values fall back to
+// now and DefaultPeriod
+type Period struct {
+	Plan  string
+	Start time.Time
+	End   time.Time
+}
+
+// Service applies subscription events
+type Service struct {
+	Store       Store
+	GracePeriod time.Duration
+	// Now is overridden in tests
+	Now func() time.Time
+}
+
+func NewService(store Store) *Service {
+	return &Service{Store: store, GracePeriod: DefaultGracePeriod, Now: time.Now}
+}
+
+// Activate starts a subscription, or restarts a lapsed one
+func (s *Service) Activate(ctx context.Context, userID uuid.UUID, period Period) (database.Subscription, error) {
+	if _, err := s.Store.GetUserById(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Subscription{}, ErrUnknownUser
+		}
+		return database.Subscription{}, err
+	}
+	period = s.fillPeriod(period, s.now())
+	return s.save(ctx, database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Plan:               period.Plan,
+		Status:             database.SubscriptionStatusActive,
+		CurrentPeriodStart: period.Start,
+		CurrentPeriodEnd:   period.End,
+		AccessUntil:        period.End.Add(s.GracePeriod),
+	})
+}
+
+// Renew moves the subscription on to its next period and clears any failed
+// payment or cancellation
+func (s *Service) Renew(ctx context.Context, userID uuid.UUID, period Period) (database.Subscription, error) {
+	sub, err := s.subscription(ctx, userID)
+	if errors.Is(err, ErrNoSubscription) {
+		return s.Activate(ctx, userID, period)
+	}
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	// Without dates the next period follows on from the current one
+	start := sub.CurrentPeriodEnd
+	if now := s.now(); sub.Status == database.SubscriptionStatusExpired || start.Before(now.Add(-s.GracePeriod)) {
+		start = now
+	}
+	if period.Plan == "" {
+		period.Plan = sub.Plan
+	}
+	period = s.fillPeriod(period, start)
+	return s.save(ctx, database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Plan:               period.Plan,
+		Status:             database.SubscriptionStatusActive,
+		CurrentPeriodStart: period.Start,
+		CurrentPeriodEnd:   period.End,
+		AccessUntil:        period.End.Add(s.GracePeriod),
+	})
+}
+
+// Cancel stops the subscription renewing, the member keeps Chirpy Red until
+// the end of the period they paid for. An expired subscription is left as it
+// is, a late cancellation can't restore access.
+func (s *Service) Cancel(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.subscription(ctx, userID)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+	if sub.Status == database.SubscriptionStatusExpired {
+		return sub, nil
+	}
+	params := paramsFrom(sub)
+	params.Status = database.SubscriptionStatusCanceled
+	params.CanceledAt = sql.NullTime{Time: s.now(), Valid: true}
+	params.AccessUntil = earliest(sub.AccessUntil, sub.CurrentPeriodEnd)
+	return s.save(ctx, params)
+}
+
+// PaymentFailed keeps the member on for the grace period while the provider
+// retries the payment, without extending access they already had. An expired
+// subscription is left as it is.
+func (s *Service) PaymentFailed(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.subscription(ctx, userID)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+	// Repeated failures don't extend the grace period
+	if sub.Status == database.SubscriptionStatusPastDue || sub.Status == database.SubscriptionStatusExpired {
+		return sub, nil
+	}
+	graceEnd := s.now().Add(s.GracePeriod)
+	params := paramsFrom(sub)
+	params.Status = database.SubscriptionStatusPastDue
+	params.GracePeriodEnd = sql.NullTime{Time: graceEnd, Valid: true}
+	params.AccessUntil = earliest(sub.AccessUntil, graceEnd)
+	return s.save(ctx, params)
+}
+
+// Downgrade ends the subscription immediately
+func (s *Service) Downgrade(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.subscription(ctx, userID)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+	params := paramsFrom(sub)
+	params.Status = database.SubscriptionStatusExpired
+	params.AccessUntil = s.now()
+	return s.save(ctx, params)
+}
+
+// ExpireLapsed expires subscriptions whose access has run out. Members lose
+// Chirpy Red when access_until passes whether or not this has run, it keeps
+// the statuses accurate for renewals and reporting.
+func (s *Service) ExpireLapsed(ctx context.Context) (int, error) {
+	userIDs, err := s.Store.ExpireLapsedSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(userIDs), nil
+}
+
+// Run periodically expires lapsed subscriptions until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireLapsed(ctx); err != nil {
+				slog.Error("could not expire lapsed subscriptions", "error", err)
+			}
+		}
+	}
+}
+
+// HasAccess reports whether the subscription grants Chirpy Red at now. It is
+// the only source of membership, the zero Subscription of a user who never
+// subscribed has no access.
+func HasAccess(sub database.Subscription, now time.Time) bool {
+	return sub.Status != database.SubscriptionStatusExpired && sub.AccessUntil.After(now)
+}
+
+func (s *Service) subscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.Store.GetSubscriptionByUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Subscription{}, ErrNoSubscription
+	}
+	return sub, err
+}
+
+func (s *Service) save(ctx context.Context, params database.UpsertSubscriptionParams) (database.Subscription, error) {
+	return s.Store.UpsertSubscription(ctx, params)
+}
+
+func (s *Service) fillPeriod(period Period, start time.Time) Period {
+	if period.Plan == "" {
+		period.Plan = PlanChirpyRed
+	}
+	if period.Start.IsZero() {
+		period.Start = start
+	}
+	if period.End.IsZero() || !period.End.After(period.Start) {
+		period.End = period.Start.Add(DefaultPeriod)
+	}
+	return period
+}
+
+func (s *Service) now() time.Time {
+	return s.Now().UTC()
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func paramsFrom(sub database.Subscription) database.UpsertSubscriptionParams {
+	return database.UpsertSubscriptionParams{
+		UserID:             sub.UserID,
+		Plan:               sub.Plan,
+		Status:             sub.Status,
+		CurrentPeriodStart: sub.CurrentPeriodStart,
+		CurrentPeriodEnd:   sub.CurrentPeriodEnd,
+		GracePeriodEnd:     sub.GracePeriodEnd,
+		CanceledAt:         sub.CanceledAt,
+		AccessUntil:        sub.AccessUntil,
+	}
+}
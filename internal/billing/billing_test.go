@@ -0,0 +1,202 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+type fakeStore struct {
+	now           func() time.Time
+	users         map[uuid.UUID]database.User
+	subscriptions map[uuid.UUID]database.Subscription
+}
+
+func (s *fakeStore) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeStore) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, ok := s.subscriptions[userID]
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	return sub, nil
+}
+
+func (s *fakeStore) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	sub := database.Subscription{
+		ID:                 uuid.New(),
+		UserID:             arg.UserID,
+		Plan:               arg.Plan,
+		Status:             arg.Status,
+		CurrentPeriodStart: arg.CurrentPeriodStart,
+		CurrentPeriodEnd:   arg.CurrentPeriodEnd,
+		GracePeriodEnd:     arg.GracePeriodEnd,
+		CanceledAt:         arg.CanceledAt,
+		AccessUntil:        arg.AccessUntil,
+	}
+	s.subscriptions[arg.UserID] = sub
+	return sub, nil
+}
+
+func (s *fakeStore) ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	for userID, sub := range s.subscriptions {
+		if sub.Status != database.SubscriptionStatusExpired && !sub.AccessUntil.After(s.now()) {
+			sub.Status = database.SubscriptionStatusExpired
+			s.subscriptions[userID] = sub
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	userID := uuid.New()
+	store := &fakeStore{
+		now:           clock,
+		users:         map[uuid.UUID]database.User{userID: {ID: userID}},
+		subscriptions: map[uuid.UUID]database.Subscription{},
+	}
+	service := NewService(store)
+	service.Now = clock
+
+	isRed := func() bool { return HasAccess(store.subscriptions[userID], now) }
+	advance := func(d time.Duration) {
+		t.Helper()
+		now = now.Add(d)
+		if _, err := service.ExpireLapsed(ctx); err != nil {
+			t.Fatalf("could not expire subscriptions: %v", err)
+		}
+	}
+
+	if _, err := service.Activate(ctx, uuid.New(), Period{}); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("expected an unknown user error, got %v", err)
+	}
+	if _, err := service.Cancel(ctx, userID); !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("expected a missing subscription error, got %v", err)
+	}
+
+	sub, err := service.Activate(ctx, userID, Period{})
+	if err != nil {
+		t.Fatalf("could not activate: %v", err)
+	}
+	if !isRed() || sub.Plan != PlanChirpyRed || !sub.CurrentPeriodEnd.Equal(now.Add(DefaultPeriod)) {
+		t.Fatalf("unexpected subscription after activating %+v", sub)
+	}
+
+	// Renewals follow on from the current period
+	advance(DefaultPeriod - time.Hour)
+	sub, _ = service.Renew(ctx, userID, Period{})
+	if !sub.CurrentPeriodStart.Equal(now.Add(time.Hour)) || !isRed() {
+		t.Errorf("expected the renewal to follow on from the last period, got %+v", sub)
+	}
+
+	// A failed payment keeps access for the grace period only
+	service.PaymentFailed(ctx, userID)
+	advance(DefaultGracePeriod - time.Hour)
+	service.PaymentFailed(ctx, userID)
+	if !isRed() {
+		t.Error("expected the member to keep Chirpy Red during the grace period")
+	}
+	advance(time.Hour * 2)
+	if isRed() || store.subscriptions[userID].Status != database.SubscriptionStatusExpired {
+		t.Error("expected the subscription to expire after the grace period")
+	}
+
+	// Renewing a lapsed subscription starts a new period now
+	sub, _ = service.Renew(ctx, userID, Period{End: now.Add(time.Hour * 24 * 365), Plan: "chirpy_red_yearly"})
+	if !sub.CurrentPeriodStart.Equal(now) || sub.Plan != "chirpy_red_yearly" || !isRed() {
+		t.Errorf("expected a new yearly period, got %+v", sub)
+	}
+
+	// Canceling keeps access until the end of the paid period
+	service.Cancel(ctx, userID)
+	advance(time.Hour * 24 * 364)
+	if !isRed() {
+		t.Error("expected a canceled member to keep Chirpy Red until the period ends")
+	}
+	advance(time.Hour * 24)
+	if isRed() {
+		t.Error("expected the canceled subscription to expire at the end of the period")
+	}
+
+	// Downgrading is immediate
+	service.Activate(ctx, userID, Period{})
+	service.Downgrade(ctx, userID)
+	if isRed() {
+		t.Error("expected a downgrade to remove Chirpy Red immediately")
+	}
+}
+
+func TestOutOfOrderEvents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	userID := uuid.New()
+	store := &fakeStore{
+		now:           clock,
+		users:         map[uuid.UUID]database.User{userID: {ID: userID}},
+		subscriptions: map[uuid.UUID]database.Subscription{},
+	}
+	service := NewService(store)
+	service.Now = clock
+	isRed := func() bool { return HasAccess(store.subscriptions[userID], now) }
+
+	t.Run("Late events after a downgrade", func(t *testing.T) {
+		service.Activate(ctx, userID, Period{})
+		service.Downgrade(ctx, userID)
+		for _, event := range []func(context.Context, uuid.UUID) (database.Subscription, error){service.Cancel, service.PaymentFailed} {
+			sub, err := event(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.Status != database.SubscriptionStatusExpired || isRed() {
+				t.Errorf("expected the downgraded subscription to stay expired, got %+v", sub)
+			}
+		}
+	})
+
+	t.Run("Payment failed after canceling", func(t *testing.T) {
+		service.Activate(ctx, userID, Period{})
+		now = now.Add(DefaultPeriod - time.Hour)
+		canceled, _ := service.Cancel(ctx, userID)
+		sub, err := service.PaymentFailed(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sub.AccessUntil.Equal(canceled.AccessUntil) {
+			t.Errorf("expected access to stay until %s, got %s", canceled.AccessUntil, sub.AccessUntil)
+		}
+		now = now.Add(time.Hour)
+		if isRed() {
+			t.Error("expected access to end with the paid period")
+		}
+	})
+
+	t.Run("Canceled during the grace period", func(t *testing.T) {
+		service.Activate(ctx, userID, Period{})
+		now = now.Add(DefaultPeriod + time.Hour)
+		failed, _ := service.PaymentFailed(ctx, userID)
+		sub, err := service.Cancel(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sub.AccessUntil.After(failed.AccessUntil) {
+			t.Errorf("expected canceling not to extend access past %s, got %s", failed.AccessUntil, sub.AccessUntil)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Package cli implements the chirpy commands for managing an instance
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/pressly/goose/v3"
+)
+
+// Migrator is satisfied by *goose.Provider
+type Migrator interface {
+	Up(ctx context.Context) ([]*goose.MigrationResult, error)
+	Down(ctx context.Context) (*goose.MigrationResult, error)
+	Status(ctx context.Context) ([]*goose.MigrationStatus, error)
+}
+
+// Migrate applies every pending migration with "up", rolls back the latest
+// with "down" or lists each migration's state with "status"
+func Migrate(ctx context.Context, migrator Migrator, command string, out io.Writer) error {
+	switch command {
+	case "up":
+		results, err := migrator.Up(ctx)
+		for _, result := range results {
+			fmt.Fprintln(out, result)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(out, "no migrations to apply")
+		}
+		return nil
+	case "down":
+		result, err := migrator.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Fprintln(out, "no migrations to roll back")
+			return nil
+		}
+		if result != nil {
+			fmt.Fprintln(out, result)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+}
+
+// UserStore creates users
+type UserStore interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (database.User, error)
+}
+
+// CreateUser creates a user with a hashed password, as an admin when admin is
+// set
+func CreateUser(ctx context.Context, store UserStore, email, password string, admin bool) (database.User, error) {
+	if email == "" || password == "" {
+		return database.User{}, errors.New("an email and password are required")
+	}
+	if _, err := store.GetUserByEmail(ctx, email); err == nil {
+		return database.User{}, fmt.Errorf("a user with the email %s already exists", email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, fmt.Errorf("could not hash the password: %w", err)
+	}
+	user, err := store.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, fmt.Errorf("could not create the user: %w", err)
+	}
+	if !admin {
+		return user, nil
+	}
+	user, err = store.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+		Role: database.UserRoleAdmin,
+		ID:   user.ID,
+	})
+	if err != nil {
+		return database.User{}, fmt.Errorf("could not make the user an admin: %w", err)
+	}
+	return user, nil
+}
+
+// SeedStore creates the sample users and their chirps
+type SeedStore interface {
+	UserStore
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+}
+
+type seedUser struct {
+	email  string
+	admin  bool
+	chirps []string
+}
+
+var seedUsers = []seedUser{
+	{"admin@chirpy.dev", true, []string{"Welcome to Chirpy!"}},
+	{"walt@chirpy.dev", false, []string{
+		"I'm the one who knocks!",
+		"Say my name.",
+	}},
+	{"saul@chirpy.dev", false, []string{
+		"Better call Saul!",
+		"S'all good, man.",
+	}},
+}
+
+// Seed creates sample users, all with password, and their chirps for local
+// development. Users that already exist are skipped so it can be run again.
+func Seed(ctx context.Context, store SeedStore, password string, out io.Writer) error {
+	for _, seed := range seedUsers {
+		if _, err := store.GetUserByEmail(ctx, seed.email); err == nil {
+			fmt.Fprintf(out, "skipped %s, it already exists\n", seed.email)
+			continue
+		}
+		user, err := CreateUser(ctx, store, seed.email, password, seed.admin)
+		if err != nil {
+			return err
+		}
+		for _, body := range seed.chirps {
+			if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID}); err != nil {
+				return fmt.Errorf("could not create a chirp for %s: %w", seed.email, err)
+			}
+		}
+		fmt.Fprintf(out, "created %s (%s) with %d chirps\n", user.Email, user.Role, len(seed.chirps))
+	}
+	return nil
+}
+
+// TokenStore revokes every user's tokens
+type TokenStore interface {
+	RevokeAllRefreshTokens(ctx context.Context) (int64, error)
+	RevokeAllPersonalAccessTokens(ctx context.Context) (int64, error)
+	IncrementAllUserTokenVersions(ctx context.Context) (int64, error)
+	RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error)
+}
+
+// RevokedTokens counts what RevokeAllTokens revoked
+type RevokedTokens struct {
+	RefreshTokens        int64
+	PersonalAccessTokens int64
+	// Users is how many users' access tokens were revoked
+	Users int64
+}
+
+// RevokeAllTokens signs every user out. Access tokens are revoked per user
+// through the denylist, which servers reload every minute, by bumping every
+// user's token version and revoking the versions before it.
+func RevokeAllTokens(ctx context.Context, store TokenStore) (RevokedTokens, error) {
+	var revoked RevokedTokens
+	var err error
+	if revoked.RefreshTokens, err = store.RevokeAllRefreshTokens(ctx); err != nil {
+		return revoked, fmt.Errorf("could not revoke refresh tokens: %w", err)
+	}
+	if revoked.PersonalAccessTokens, err = store.RevokeAllPersonalAccessTokens(ctx); err != nil {
+		return revoked, fmt.Errorf("could not revoke personal access tokens: %w", err)
+	}
+	if _, err = store.IncrementAllUserTokenVersions(ctx); err != nil {
+		return revoked, fmt.Errorf("could not revoke access tokens: %w", err)
+	}
+	expiresAt := time.Now().UTC().Add(auth.AccessTokenExpiry)
+	if revoked.Users, err = store.RevokeAllAccessTokens(ctx, expiresAt); err != nil {
+		return revoked, fmt.Errorf("could not revoke access tokens: %w", err)
+	}
+	return revoked, nil
+}
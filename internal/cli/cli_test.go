@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/pressly/goose/v3"
+)
+
+type fakeMigrator struct {
+	applied []int64
+	pending []int64
+}
+
+func (m *fakeMigrator) Up(context.Context) ([]*goose.MigrationResult, error) {
+	var results []*goose.MigrationResult
+	for _, version := range m.pending {
+		results = append(results, &goose.MigrationResult{Source: &goose.Source{Version: version}, Direction: "up"})
+		m.applied = append(m.applied, version)
+	}
+	m.pending = nil
+	return results, nil
+}
+
+func (m *fakeMigrator) Down(context.Context) (*goose.MigrationResult, error) {
+	if len(m.applied) == 0 {
+		return nil, goose.ErrNoNextVersion
+	}
+	version := m.applied[len(m.applied)-1]
+	m.applied = m.applied[:len(m.applied)-1]
+	m.pending = append([]int64{version}, m.pending...)
+	return &goose.MigrationResult{Source: &goose.Source{Version: version}, Direction: "down"}, nil
+}
+
+func (m *fakeMigrator) Status(context.Context) ([]*goose.MigrationStatus, error) {
+	var statuses []*goose.MigrationStatus
+	for _, version := range m.applied {
+		statuses = append(statuses, &goose.MigrationStatus{
+			Source: &goose.Source{Version: version}, State: goose.StateApplied, AppliedAt: time.Now(),
+		})
+	}
+	for _, version := range m.pending {
+		statuses = append(statuses, &goose.MigrationStatus{Source: &goose.Source{Version: version}, State: goose.StatePending})
+	}
+	return statuses, nil
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	migrator := &fakeMigrator{applied: []int64{1}, pending: []int64{2, 3}}
+	tests := []struct {
+		command     string
+		wantApplied int
+		wantOut     string
+		wantErr     bool
+	}{
+		{"status", 1, "pending", false},
+		{"up", 3, "up", false},
+		{"up", 3, "no migrations to apply", false},
+		{"down", 2, "down", false},
+		{"down", 1, "down", false},
+		{"down", 0, "down", false},
+		{"down", 0, "no migrations to roll back", false},
+		{"sideways", 0, "", true},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := Migrate(ctx, migrator, tt.command, &out)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("migrate %s: unexpected error %v", tt.command, err)
+		}
+		if len(migrator.applied) != tt.wantApplied {
+			t.Errorf("migrate %s: expected %d applied migrations, got %d", tt.command, tt.wantApplied, len(migrator.applied))
+		}
+		if !strings.Contains(out.String(), tt.wantOut) {
+			t.Errorf("migrate %s: expected output containing %q, got %q", tt.command, tt.wantOut, out.String())
+		}
+	}
+}
+
+type fakeStore struct {
+	users  map[string]database.User
+	chirps []database.Chirp
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{users: map[string]database.User{}}
+}
+
+func (s *fakeStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user := database.User{ID: uuid.New(), Email: arg.Email, HashedPassword: arg.HashedPassword, Role: database.UserRoleUser}
+	s.users[arg.Email] = user
+	return user, nil
+}
+
+func (s *fakeStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	user, ok := s.users[email]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeStore) UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (database.User, error) {
+	for email, user := range s.users {
+		if user.ID == arg.ID {
+			user.Role = arg.Role
+			s.users[email] = user
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *fakeStore) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	chirp := database.Chirp{ID: uuid.New(), Body: arg.Body, UserID: arg.UserID}
+	s.chirps = append(s.chirps, chirp)
+	return chirp, nil
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		admin    bool
+		wantRole database.UserRole
+		wantErr  string
+	}{
+		{"User", "user@example.com", "hunter2", false, database.UserRoleUser, ""},
+		{"Admin", "admin@example.com", "hunter2", true, database.UserRoleAdmin, ""},
+		{"Existing email", "user@example.com", "hunter2", false, "", "already exists"},
+		{"Missing password", "other@example.com", "", false, "", "are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := CreateUser(ctx, store, tt.email, tt.password, tt.admin)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("expected role %s, got %s", tt.wantRole, user.Role)
+			}
+			if match, err := auth.CheckPasswordHash(tt.password, user.HashedPassword); err != nil || !match {
+				t.Errorf("expected the password to be hashed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	if _, err := CreateUser(ctx, store, seedUsers[1].email, "existing", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Seed(ctx, store, "password", &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.users) != len(seedUsers) {
+		t.Errorf("expected %d users, got %d", len(seedUsers), len(store.users))
+	}
+	if store.users[seedUsers[0].email].Role != database.UserRoleAdmin {
+		t.Error("expected the sample admin to be an admin")
+	}
+	wantChirps := len(seedUsers[0].chirps) + len(seedUsers[2].chirps)
+	if len(store.chirps) != wantChirps {
+		t.Errorf("expected %d chirps, the existing user's to be skipped, got %d", wantChirps, len(store.chirps))
+	}
+	if !strings.Contains(out.String(), "skipped "+seedUsers[1].email) {
+		t.Errorf("expected the existing user to be reported as skipped, got %q", out.String())
+	}
+
+	if err := Seed(ctx, store, "password", &out); err != nil || len(store.chirps) != wantChirps {
+		t.Errorf("expected seeding again to change nothing, got %v", err)
+	}
+}
+
+type fakeTokenStore struct {
+	failAccess bool
+	expiresAt  time.Time
+}
+
+func (s *fakeTokenStore) RevokeAllRefreshTokens(context.Context) (int64, error) {
+	return 3, nil
+}
+
+func (s *fakeTokenStore) RevokeAllPersonalAccessTokens(context.Context) (int64, error) {
+	return 2, nil
+}
+
+func (s *fakeTokenStore) IncrementAllUserTokenVersions(context.Context) (int64, error) {
+	return 5, nil
+}
+
+func (s *fakeTokenStore) RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	if s.failAccess {
+		return 0, errors.New("connection refused")
+	}
+	s.expiresAt = expiresAt
+	return 5, nil
+}
+
+func TestRevokeAllTokens(t *testing.T) {
+	store := &fakeTokenStore{}
+	revoked, err := RevokeAllTokens(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != (RevokedTokens{RefreshTokens: 3, PersonalAccessTokens: 2, Users: 5}) {
+		t.Errorf("unexpected counts %+v", revoked)
+	}
+	if time.Until(store.expiresAt) < auth.AccessTokenExpiry-time.Minute {
+		t.Errorf("expected the revocations to outlive every access token, they expire at %s", store.expiresAt)
+	}
+
+	store.failAccess = true
+	if _, err := RevokeAllTokens(context.Background(), store); err == nil || !strings.Contains(err.Error(), "access tokens") {
+		t.Errorf("expected the access token error, got %v", err)
+	}
+}
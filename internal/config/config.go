@@ -0,0 +1,479 @@
+// Package config loads chirpy's settings. Each setting has a default which a
+// YAML or TOML config file, then environment variables, then command line
+// flags override in turn.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alexedwards/argon2id"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// MinSigningKeyLength is the shortest signing key accepted, in bytes
+const MinSigningKeyLength = 32
+
+// Platforms the API can run as, dev enables the admin reset and insecure
+// cookies and webhook urls
+const (
+	PlatformDev  = "dev"
+	PlatformProd = "prod"
+)
+
+// Database drivers, the database/sql driver names the API opens db_url with
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Secret is a setting that is redacted when it is printed
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Value is the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// Argon2 are the password hashing costs, see cmd/argon2bench
+type Argon2 struct {
+	// Memory is in KiB
+	Memory      uint32 `yaml:"memory" toml:"memory"`
+	Iterations  uint32 `yaml:"iterations" toml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism" toml:"parallelism"`
+}
+
+// Params are the default argon2id params with these costs
+func (a Argon2) Params() *argon2id.Params {
+	params := *argon2id.DefaultParams
+	params.Memory = a.Memory
+	params.Iterations = a.Iterations
+	params.Parallelism = a.Parallelism
+	return &params
+}
+
+// Server are the http server's limits and how it shuts down
+type Server struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// DrainDelay is how long readiness fails before the server stops accepting
+	// connections, set it longer than the load balancer's check interval
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// ShutdownTimeout is how long in flight requests have to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// ReadinessTimeout bounds each of readiness's checks
+	ReadinessTimeout time.Duration `yaml:"readiness_timeout" toml:"readiness_timeout"`
+}
+
+// Log is how logs are written, the format is "json" or "text"
+type Log struct {
+	Format string     `yaml:"format" toml:"format"`
+	Level  slog.Level `yaml:"level" toml:"level"`
+}
+
+// Tracing is where spans are exported, the exporter is "none", "stdout" or
+// "otlp"
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Endpoint is the OTLP collector's host:port, the OTEL_EXPORTER_OTLP_*
+	// env vars are used when it is empty
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	Insecure bool   `yaml:"insecure" toml:"insecure"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// SSO are the OpenID Connect providers users can sign in with
+type SSO struct {
+	// RedirectBaseURL is the API's public url, each provider's callback is
+	// served under it
+	RedirectBaseURL string        `yaml:"redirect_base_url" toml:"redirect_base_url"`
+	Providers       []SSOProvider `yaml:"providers" toml:"providers"`
+}
+
+// SSOProvider is one OpenID Connect provider, the client secret is only
+// needed for confidential clients
+type SSOProvider struct {
+	// Name identifies the provider in routes and linked identities
+	Name         string `yaml:"name" toml:"name"`
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret Secret `yaml:"client_secret" toml:"client_secret"`
+}
+
+// RedirectURL is the callback the named provider sends users back to
+func (s SSO) RedirectURL(name string) string {
+	return strings.TrimSuffix(s.RedirectBaseURL, "/") + "/api/sso/" + name + "/callback"
+}
+
+type Config struct {
+	Port     int    `yaml:"port" toml:"port"`
+	Platform string `yaml:"platform" toml:"platform"`
+	DBDriver string `yaml:"db_driver" toml:"db_driver"`
+	// DBURL is a postgres connection string or a sqlite file name
+	DBURL Secret `yaml:"db_url" toml:"db_url"`
+	// SigningKey signs access tokens and CSRF tokens
+	SigningKey  Secret `yaml:"signing_key" toml:"signing_key"`
+	PolkaAPIKey Secret `yaml:"polka_api_key" toml:"polka_api_key"`
+	// PolkaWebhookSecrets sign Polka's webhooks, list the old and new secret
+	// while rotating
+	PolkaWebhookSecrets []Secret `yaml:"polka_webhook_secrets" toml:"polka_webhook_secrets"`
+	Argon2              Argon2   `yaml:"argon2" toml:"argon2"`
+	Server              Server   `yaml:"server" toml:"server"`
+	Log                 Log      `yaml:"log" toml:"log"`
+	// MetricsToken is the bearer token scrapers send to /metrics, which is
+	// open when it is empty
+	MetricsToken Secret  `yaml:"metrics_token" toml:"metrics_token"`
+	Tracing      Tracing `yaml:"tracing" toml:"tracing"`
+	SSO          SSO     `yaml:"sso" toml:"sso"`
+}
+
+// Default is the config before any source is read
+func Default() *Config {
+	return &Config{
+		Port:     8080,
+		Platform: PlatformProd,
+		DBDriver: DriverPostgres,
+		Argon2: Argon2{
+			Memory:      argon2id.DefaultParams.Memory,
+			Iterations:  argon2id.DefaultParams.Iterations,
+			Parallelism: argon2id.DefaultParams.Parallelism,
+		},
+		Server: Server{
+			ReadHeaderTimeout: time.Second * 5,
+			ReadTimeout:       time.Second * 15,
+			WriteTimeout:      time.Second * 30,
+			IdleTimeout:       time.Minute * 2,
+			MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+			ShutdownTimeout:   time.Second * 30,
+			ReadinessTimeout:  time.Second * 2,
+		},
+		Log:     Log{Format: logging.FormatJSON, Level: slog.LevelInfo},
+		Tracing: Tracing{Exporter: tracing.ExporterNone, SampleRatio: 1},
+	}
+}
+
+// setting is read from the flag name and the env var of the same name in
+// upper snake case, e.g. -db-url and DB_URL
+type setting struct {
+	name  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"port", "port to serve on", func(c *Config, v string) error { return parseInt(v, 0, &c.Port) }},
+	{"platform", `"dev" or "prod"`, func(c *Config, v string) error { c.Platform = v; return nil }},
+	{"db-driver", `"postgres" or "sqlite"`, func(c *Config, v string) error { c.DBDriver = v; return nil }},
+	{"db-url", "postgres connection string or sqlite file", func(c *Config, v string) error { c.DBURL = Secret(v); return nil }},
+	{"signing-key", "key for signing tokens", func(c *Config, v string) error { c.SigningKey = Secret(v); return nil }},
+	{"polka-api-key", "legacy api key for unsigned Polka webhooks", func(c *Config, v string) error { c.PolkaAPIKey = Secret(v); return nil }},
+	{"polka-webhook-secrets", "comma separated secrets for signed Polka webhooks", func(c *Config, v string) error {
+		c.PolkaWebhookSecrets = nil
+		for _, secret := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			c.PolkaWebhookSecrets = append(c.PolkaWebhookSecrets, Secret(secret))
+		}
+		return nil
+	}},
+	{"argon2-memory", "argon2id memory in KiB", func(c *Config, v string) error { return parseUint(v, 32, &c.Argon2.Memory) }},
+	{"argon2-iterations", "argon2id iterations", func(c *Config, v string) error { return parseUint(v, 32, &c.Argon2.Iterations) }},
+	{"argon2-parallelism", "argon2id threads", func(c *Config, v string) error { return parseUint(v, 8, &c.Argon2.Parallelism) }},
+	{"read-header-timeout", "time to read request headers", func(c *Config, v string) error { return parseDuration(v, &c.Server.ReadHeaderTimeout) }},
+	{"read-timeout", "time to read a whole request", func(c *Config, v string) error { return parseDuration(v, &c.Server.ReadTimeout) }},
+	{"write-timeout", "time to write a response", func(c *Config, v string) error { return parseDuration(v, &c.Server.WriteTimeout) }},
+	{"idle-timeout", "time keep alive connections are kept idle", func(c *Config, v string) error { return parseDuration(v, &c.Server.IdleTimeout) }},
+	{"max-header-bytes", "largest request headers accepted", func(c *Config, v string) error { return parseInt(v, 0, &c.Server.MaxHeaderBytes) }},
+	{"drain-delay", "time readiness fails before shutting down", func(c *Config, v string) error { return parseDuration(v, &c.Server.DrainDelay) }},
+	{"readiness-timeout", "time each readiness check has to pass", func(c *Config, v string) error { return parseDuration(v, &c.Server.ReadinessTimeout) }},
+	{"metrics-token", "bearer token required to scrape /metrics", func(c *Config, v string) error { c.MetricsToken = Secret(v); return nil }},
+	{"log-format", `"json" or "text"`, func(c *Config, v string) error { c.Log.Format = v; return nil }},
+	{"log-level", "debug, info, warn or error", func(c *Config, v string) error { return c.Log.Level.UnmarshalText([]byte(v)) }},
+	{"tracing-exporter", `"none", "stdout" or "otlp"`, func(c *Config, v string) error { c.Tracing.Exporter = v; return nil }},
+	{"tracing-endpoint", "OTLP http collector host:port", func(c *Config, v string) error { c.Tracing.Endpoint = v; return nil }},
+	{"tracing-insecure", "send OTLP over http rather than https", func(c *Config, v string) error { return parseBool(v, &c.Tracing.Insecure) }},
+	{"tracing-sample-ratio", "share of new traces recorded, from 0 to 1", func(c *Config, v string) error { return parseFloat(v, &c.Tracing.SampleRatio) }},
+	{"shutdown-timeout", "time in flight requests have to finish on shutdown", func(c *Config, v string) error { return parseDuration(v, &c.Server.ShutdownTimeout) }},
+	{"oidc-providers", "comma separated OpenID Connect providers, each set by OIDC_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET", func(c *Config, v string) error {
+		c.SSO.Providers = ssoProvidersFromEnv(c.SSO.Providers, v)
+		return nil
+	}},
+	{"oidc-redirect-base-url", "public url the OpenID Connect callbacks are served under", func(c *Config, v string) error { c.SSO.RedirectBaseURL = v; return nil }},
+}
+
+// ssoProvidersFromEnv lists the named providers, e.g. "google" is read from
+// OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID and OIDC_GOOGLE_CLIENT_SECRET over
+// whatever the config file set for it
+func ssoProvidersFromEnv(configured []SSOProvider, names string) []SSOProvider {
+	var providers []SSOProvider
+	for _, name := range strings.FieldsFunc(names, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name = strings.ToLower(name)
+		provider := SSOProvider{Name: name}
+		if i := slices.IndexFunc(configured, func(p SSOProvider) bool { return p.Name == name }); i >= 0 {
+			provider = configured[i]
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		if issuer := os.Getenv(prefix + "ISSUER"); issuer != "" {
+			provider.Issuer = issuer
+		}
+		if clientID := os.Getenv(prefix + "CLIENT_ID"); clientID != "" {
+			provider.ClientID = clientID
+		}
+		if clientSecret := os.Getenv(prefix + "CLIENT_SECRET"); clientSecret != "" {
+			provider.ClientSecret = Secret(clientSecret)
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load reads the config from the file named by -config or CHIRPY_CONFIG, the
+// environment and the command line args, then validates it
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	loader := AddFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return loader.Load()
+}
+
+// Loader reads the config once the flags it added are parsed
+type Loader struct {
+	configFile *string
+	flagValues []flagValue
+}
+
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+// AddFlags adds -config and a flag for every setting to fs, so commands can
+// take the config flags alongside their own
+func AddFlags(fs *flag.FlagSet) *Loader {
+	l := &Loader{configFile: fs.String("config", os.Getenv("CHIRPY_CONFIG"), "YAML or TOML config file")}
+	for _, s := range settings {
+		fs.Func(s.name, s.usage+" (env "+envName(s.name)+")", func(value string) error {
+			l.flagValues = append(l.flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+	return l
+}
+
+// Load reads the config file, the environment and the parsed flags in turn,
+// then validates the config
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	if *l.configFile != "" {
+		if err := cfg.readFile(*l.configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		value, ok := os.LookupEnv(envName(s.name))
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", envName(s.name), err)
+		}
+	}
+	for _, f := range l.flagValues {
+		if err := f.setting.set(cfg, f.value); err != nil {
+			return nil, fmt.Errorf("-%s: %w", f.setting.name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML file by its extension, unknown keys are an
+// error so typos aren't silently ignored
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("could not parse %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys in %s: %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml, not %q", path, ext)
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or invalid
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is not between 1 and 65535", c.Port))
+	}
+	if c.Platform != PlatformDev && c.Platform != PlatformProd {
+		errs = append(errs, fmt.Errorf("platform must be %q or %q, not %q", PlatformDev, PlatformProd, c.Platform))
+	}
+	if c.DBDriver != DriverPostgres && c.DBDriver != DriverSQLite {
+		errs = append(errs, fmt.Errorf("db_driver must be %q or %q, not %q", DriverPostgres, DriverSQLite, c.DBDriver))
+	}
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("db_url is required"))
+	}
+	if len(c.SigningKey) < MinSigningKeyLength {
+		errs = append(errs, fmt.Errorf("signing_key must be at least %d bytes, generate one with `openssl rand -base64 64`", MinSigningKeyLength))
+	}
+	if c.Argon2.Iterations < 1 || c.Argon2.Parallelism < 1 {
+		errs = append(errs, errors.New("argon2 iterations and parallelism must be at least 1"))
+	}
+	if c.Argon2.Memory < 8*uint32(c.Argon2.Parallelism) {
+		errs = append(errs, errors.New("argon2 memory must be at least 8KiB per thread"))
+	}
+	if c.Server.ReadHeaderTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 ||
+		c.Server.IdleTimeout < 0 || c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server shutdown_timeout must be positive"))
+	}
+	if c.Server.ReadinessTimeout <= 0 {
+		errs = append(errs, errors.New("server readiness_timeout must be positive"))
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		errs = append(errs, fmt.Errorf("log format must be %q or %q, not %q", logging.FormatJSON, logging.FormatText, c.Log.Format))
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		errs = append(errs, errors.New("server max_header_bytes must be positive"))
+	}
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("tracing exporter must be %q, %q or %q, not %q",
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP, c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing sample_ratio %v is not between 0 and 1", c.Tracing.SampleRatio))
+	}
+	if len(c.SSO.Providers) > 0 && c.SSO.RedirectBaseURL == "" {
+		errs = append(errs, errors.New("sso redirect_base_url is required when providers are configured"))
+	}
+	names := map[string]bool{}
+	for _, provider := range c.SSO.Providers {
+		if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" {
+			errs = append(errs, fmt.Errorf("sso provider %q needs a name, issuer and client_id", provider.Name))
+		}
+		if names[provider.Name] {
+			errs = append(errs, fmt.Errorf("sso provider %q is configured more than once", provider.Name))
+		}
+		names[provider.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Dev reports whether the API runs as the dev platform
+func (c *Config) Dev() bool {
+	return c.Platform == PlatformDev
+}
+
+// String prints every setting with its secrets redacted
+func (c *Config) String() string {
+	return fmt.Sprintf("port=%d platform=%s db_driver=%s db_url=%s signing_key=%s polka_api_key=%s polka_webhook_secrets=%v "+
+		"argon2=%+v server=%+v log=%+v metrics_token=%s tracing=%+v sso=%+v",
+		c.Port, c.Platform, c.DBDriver, c.DBURL, c.SigningKey, c.PolkaAPIKey, c.PolkaWebhookSecrets,
+		c.Argon2, c.Server, c.Log, c.MetricsToken, c.Tracing, c.SSO)
+}
+
+func parseInt(value string, bits int, out *int) error {
+	parsed, err := strconv.ParseInt(value, 10, bits)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid number", value)
+	}
+	*out = int(parsed)
+	return nil
+}
+
+func parseDuration(value string, out *time.Duration) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid duration, e.g. 30s", value)
+	}
+	*out = parsed
+	return nil
+}
+
+func parseFloat(value string, out *float64) error {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid number", value)
+	}
+	*out = parsed
+	return nil
+}
+
+func parseBool(value string, out *bool) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", value)
+	}
+	*out = parsed
+	return nil
+}
+
+func parseUint[T uint8 | uint32](value string, bits int, out *T) error {
+	parsed, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid number", value)
+	}
+	*out = T(parsed)
+	return nil
+}
@@ -7,28 +7,120 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimDueChirpAnnouncements = `-- name: ClaimDueChirpAnnouncements :many
+UPDATE chirps
+SET announced_at = now()
+WHERE id IN (
+    SELECT c.id
+    FROM chirps AS c
+    WHERE c.announced_at IS NULL AND c.publish_at <= now()
+    ORDER BY c.publish_at ASC
+    LIMIT $1::INTEGER
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+// Marks scheduled chirps that have become visible as announced, the caller
+// publishes chirp.created for the ones returned
+func (q *Queries) ClaimDueChirpAnnouncements(ctx context.Context, maxChirps int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueChirpAnnouncements, maxChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.PinnedAt,
+			&i.PublishAt,
+			&i.AnnouncedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countChirpsByUserSince = `-- name: CountChirpsByUserSince :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = $1 AND created_at > $2
+`
+
+type CountChirpsByUserSinceParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPinnedChirpsByUser = `-- name: CountPinnedChirpsByUser :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = $1 AND pinned_at IS NOT NULL
+`
+
+func (q *Queries) CountPinnedChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPinnedChirpsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (
     id,
     body,
     created_at,
     updated_at,
-    user_id
-) VALUES (gen_random_uuid(), $1, now(), now(), $2)
-RETURNING id, body, created_at, updated_at, user_id
+    user_id,
+    publish_at,
+    announced_at
+) VALUES (
+    gen_random_uuid(),
+    $1,
+    now(),
+    now(),
+    $2,
+    coalesce($3::TIMESTAMP, now()),
+    CASE WHEN $3::TIMESTAMP IS NULL THEN now() END
+)
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.PublishAt)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -36,10 +128,26 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
 	)
 	return i, err
 }
 
+const deleteAnyChirpById = `-- name: DeleteAnyChirpById :execrows
+DELETE FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) DeleteAnyChirpById(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAnyChirpById, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteChirpById = `-- name: DeleteChirpById :execrows
 DELETE FROM chirps
 WHERE id = $1 AND user_id = $2
@@ -59,7 +167,7 @@ func (q *Queries) DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams
 }
 
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, body, created_at, updated_at, user_id
+SELECT id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
 FROM chirps
 WHERE id = $1
 `
@@ -73,13 +181,17 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, body, created_at, updated_at, user_id
+SELECT id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
 FROM chirps
+WHERE publish_at <= now()
 ORDER BY created_at ASC
 `
 
@@ -98,6 +210,9 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.PinnedAt,
+			&i.PublishAt,
+			&i.AnnouncedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -120,3 +235,64 @@ func (q *Queries) ResetChirps(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetChirps)
 	return err
 }
+
+const setChirpPinned = `-- name: SetChirpPinned :one
+UPDATE chirps
+SET
+    pinned_at = CASE
+        WHEN $3::BOOLEAN THEN coalesce(pinned_at, now())
+    END
+WHERE id = $1 AND user_id = $2
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+type SetChirpPinnedParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Pinned bool
+}
+
+func (q *Queries) SetChirpPinned(ctx context.Context, arg SetChirpPinnedParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpPinned, arg.ID, arg.UserID, arg.Pinned)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = now()
+WHERE id = $2 AND user_id = $3
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+type UpdateChirpBodyParams struct {
+	Body   string
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,126 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: login_throttles.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const deleteLoginThrottle = `-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE throttle_key = $1
+`
+
+func (q *Queries) DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLoginThrottle, throttleKey)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteStaleLoginThrottles = `-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE
+    last_failure_at < $1
+    AND (locked_until IS NULL OR locked_until < now())
+`
+
+func (q *Queries) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleLoginThrottles, lastFailureAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLoginThrottles = `-- name: GetLoginThrottles :many
+SELECT throttle_key, failures, last_failure_at, locked_until
+FROM login_throttles
+WHERE throttle_key = ANY($1::TEXT [])
+ORDER BY throttle_key ASC
+`
+
+func (q *Queries) GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]LoginThrottle, error) {
+	rows, err := q.db.QueryContext(ctx, getLoginThrottles, pq.Array(throttleKeys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoginThrottle
+	for rows.Next() {
+		var i LoginThrottle
+		if err := rows.Scan(
+			&i.ThrottleKey,
+			&i.Failures,
+			&i.LastFailureAt,
+			&i.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockLoginThrottle = `-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE throttle_key = $1
+`
+
+type LockLoginThrottleParams struct {
+	ThrottleKey string
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) error {
+	_, err := q.db.ExecContext(ctx, lockLoginThrottle, arg.ThrottleKey, arg.LockedUntil)
+	return err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (
+    throttle_key,
+    failures,
+    last_failure_at
+) VALUES ($1, 1, now())
+ON CONFLICT (throttle_key) DO UPDATE
+SET
+    failures = CASE
+        WHEN login_throttles.last_failure_at < $2 THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = now()
+RETURNING throttle_key, failures, last_failure_at, locked_until
+`
+
+type RecordLoginFailureParams struct {
+	ThrottleKey string
+	ResetBefore time.Time
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginFailure, arg.ThrottleKey, arg.ResetBefore)
+	var i LoginThrottle
+	err := row.Scan(
+		&i.ThrottleKey,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
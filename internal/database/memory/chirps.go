@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.Chirp{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		PublishAt: now,
+	}
+	if arg.PublishAt.Valid {
+		chirp.PublishAt = timestamp(arg.PublishAt.Time)
+	} else {
+		chirp.AnnouncedAt = sql.NullTime{Time: now, Valid: true}
+	}
+	s.chirps = append(s.chirps, chirp)
+	return chirp, nil
+}
+
+func (s *Store) ClaimDueChirpAnnouncements(ctx context.Context, maxChirps int32) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	due := []*database.Chirp{}
+	for i := range s.chirps {
+		chirp := &s.chirps[i]
+		if !chirp.AnnouncedAt.Valid && !chirp.PublishAt.After(now) {
+			due = append(due, chirp)
+		}
+	}
+	sortBy(due, func(chirp *database.Chirp) int64 { return unixMicro(chirp.PublishAt) }, false)
+	claimed := []database.Chirp{}
+	for _, chirp := range due[:min(len(due), max(int(maxChirps), 0))] {
+		chirp.AnnouncedAt = sql.NullTime{Time: now, Valid: true}
+		claimed = append(claimed, *chirp)
+	}
+	return claimed, nil
+}
+
+func (s *Store) ResetChirps(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chirps = nil
+	return nil
+}
+
+func (s *Store) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	chirps := filter(s.chirps, func(chirp database.Chirp) bool { return !chirp.PublishAt.After(now) })
+	sortBy(chirps, func(chirp database.Chirp) int64 { return unixMicro(chirp.CreatedAt) }, false)
+	return chirps, nil
+}
+
+func (s *Store) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := find(s.chirps, func(chirp database.Chirp) bool { return chirp.ID == id })
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return *chirp, nil
+}
+
+func (s *Store) DeleteChirpById(ctx context.Context, arg database.DeleteChirpByIdParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := remove(&s.chirps, func(chirp database.Chirp) bool {
+		return chirp.ID == arg.ID && chirp.UserID == arg.UserID
+	})
+	return int64(len(deleted)), nil
+}
+
+func (s *Store) DeleteAnyChirpById(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := remove(&s.chirps, func(chirp database.Chirp) bool { return chirp.ID == id })
+	return int64(len(deleted)), nil
+}
+
+func (s *Store) UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error) {
+	return s.updateChirp(arg.ID, arg.UserID, func(chirp *database.Chirp) {
+		chirp.Body = arg.Body
+		chirp.UpdatedAt = s.now()
+	})
+}
+
+func (s *Store) CountChirpsByUserSince(ctx context.Context, arg database.CountChirpsByUserSinceParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since := timestamp(arg.CreatedAt)
+	chirps := filter(s.chirps, func(chirp database.Chirp) bool {
+		return chirp.UserID == arg.UserID && chirp.CreatedAt.After(since)
+	})
+	return int64(len(chirps)), nil
+}
+
+func (s *Store) CountPinnedChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirps := filter(s.chirps, func(chirp database.Chirp) bool {
+		return chirp.UserID == userID && chirp.PinnedAt.Valid
+	})
+	return int64(len(chirps)), nil
+}
+
+func (s *Store) SetChirpPinned(ctx context.Context, arg database.SetChirpPinnedParams) (database.Chirp, error) {
+	return s.updateChirp(arg.ID, arg.UserID, func(chirp *database.Chirp) {
+		switch {
+		case !arg.Pinned:
+			chirp.PinnedAt = sql.NullTime{}
+		case !chirp.PinnedAt.Valid:
+			chirp.PinnedAt = sql.NullTime{Time: s.now(), Valid: true}
+		}
+	})
+}
+
+func (s *Store) updateChirp(id, userID uuid.UUID, update func(chirp *database.Chirp)) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := find(s.chirps, func(chirp database.Chirp) bool {
+		return chirp.ID == id && chirp.UserID == userID
+	})
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	update(chirp)
+	return *chirp, nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) (database.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := find(s.identities, func(identity database.UserIdentity) bool {
+		return identity.Provider == arg.Provider && identity.Subject == arg.Subject
+	}); ok {
+		return database.UserIdentity{}, uniqueViolation("uq_provider_subject")
+	}
+	if !s.userExists(arg.UserID) {
+		return database.UserIdentity{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	identity := database.UserIdentity{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		Provider:  arg.Provider,
+		Subject:   arg.Subject,
+		Email:     arg.Email,
+	}
+	s.identities = append(s.identities, identity)
+	return identity, nil
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, arg database.GetUserIdentityParams) (database.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity, ok := find(s.identities, func(identity database.UserIdentity) bool {
+		return identity.Provider == arg.Provider && identity.Subject == arg.Subject
+	})
+	if !ok {
+		return database.UserIdentity{}, sql.ErrNoRows
+	}
+	return *identity, nil
+}
@@ -0,0 +1,177 @@
+// Package memory is an in-memory database.Querier for tests. It keeps the
+// semantics of the Postgres queries: defaults, ordering, unique and foreign
+// key constraints with their cascades, and sql.ErrNoRows when a :one query
+// matches nothing.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// Constraint violations, wrapped with the constraint's name
+var (
+	ErrUniqueViolation     = errors.New("duplicate key value violates unique constraint")
+	ErrForeignKeyViolation = errors.New("insert violates foreign key constraint")
+)
+
+var (
+	_ database.Querier    = (*Store)(nil)
+	_ database.Transactor = (*Store)(nil)
+)
+
+// Store holds every table in memory, it is safe for concurrent use
+type Store struct {
+	// Now is overridden in tests
+	Now func() time.Time
+
+	mu sync.Mutex
+	// txMu runs transactions one at a time
+	txMu sync.Mutex
+	tables
+}
+
+type tables struct {
+	users                []database.User
+	chirps               []database.Chirp
+	refreshTokens        []database.RefreshToken
+	revocations          []database.AccessTokenRevocation
+	personalAccessTokens []database.PersonalAccessToken
+	oauthClients         []database.OauthClient
+	oauthCodes           []database.OauthAuthorizationCode
+	identities           []database.UserIdentity
+	loginThrottles       []database.LoginThrottle
+	subscriptions        []database.Subscription
+	webhookEvents        []database.WebhookEvent
+	webhookEndpoints     []database.WebhookEndpoint
+	webhookDeliveries    []database.WebhookDelivery
+}
+
+func New() *Store {
+	return &Store{Now: time.Now}
+}
+
+// InTx runs fn on the store and restores every table when it fails. Writes
+// made outside of transactions while fn runs are lost if it fails too.
+func (s *Store) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	s.mu.Lock()
+	snapshot := s.tables.clone()
+	s.mu.Unlock()
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.tables = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// clone copies the tables, the rows' slices are never modified in place so
+// they can be shared
+func (t tables) clone() tables {
+	return tables{
+		users:                slices.Clone(t.users),
+		chirps:               slices.Clone(t.chirps),
+		refreshTokens:        slices.Clone(t.refreshTokens),
+		revocations:          slices.Clone(t.revocations),
+		personalAccessTokens: slices.Clone(t.personalAccessTokens),
+		oauthClients:         slices.Clone(t.oauthClients),
+		oauthCodes:           slices.Clone(t.oauthCodes),
+		identities:           slices.Clone(t.identities),
+		loginThrottles:       slices.Clone(t.loginThrottles),
+		subscriptions:        slices.Clone(t.subscriptions),
+		webhookEvents:        slices.Clone(t.webhookEvents),
+		webhookEndpoints:     slices.Clone(t.webhookEndpoints),
+		webhookDeliveries:    slices.Clone(t.webhookDeliveries),
+	}
+}
+
+// now is the time Postgres would store for now(), in UTC to the microsecond
+func (s *Store) now() time.Time {
+	return timestamp(s.Now())
+}
+
+// timestamp stores t like a TIMESTAMP column
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Round(time.Microsecond)
+}
+
+func nullTimestamp(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = timestamp(t.Time)
+	}
+	return t
+}
+
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("%w %q", ErrUniqueViolation, constraint)
+}
+
+func foreignKeyViolation(constraint string) error {
+	return fmt.Errorf("%w %q", ErrForeignKeyViolation, constraint)
+}
+
+// find returns a pointer to the first row that matches, so it can be updated
+// in place
+func find[T any](rows []T, match func(T) bool) (*T, bool) {
+	i := slices.IndexFunc(rows, match)
+	if i < 0 {
+		return nil, false
+	}
+	return &rows[i], true
+}
+
+// filter returns the rows that match in insertion order
+func filter[T any](rows []T, match func(T) bool) []T {
+	matched := []T{}
+	for _, row := range rows {
+		if match(row) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+// remove deletes the rows that match and returns them
+func remove[T any](rows *[]T, match func(T) bool) []T {
+	removed := []T{}
+	*rows = slices.DeleteFunc(*rows, func(row T) bool {
+		if match(row) {
+			removed = append(removed, row)
+			return true
+		}
+		return false
+	})
+	return removed
+}
+
+// sortBy sorts stably so rows with equal keys stay in insertion order
+func sortBy[T any, K cmp.Ordered](rows []T, key func(T) K, desc bool) {
+	slices.SortStableFunc(rows, func(a, b T) int {
+		if desc {
+			return cmp.Compare(key(b), key(a))
+		}
+		return cmp.Compare(key(a), key(b))
+	})
+}
+
+func unixMicro(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// page applies LIMIT and OFFSET
+func page[T any](rows []T, limit, offset int32) []T {
+	start := min(max(int(offset), 0), len(rows))
+	end := min(start+max(int(limit), 0), len(rows))
+	return rows[start:end]
+}
@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// clock steps forward a second every time it is read, like rows inserted by
+// separate requests
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func newStore() *Store {
+	store := New()
+	store.Now = (&clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}).Now
+	return store
+}
+
+func createUser(t *testing.T, store *Store, email string) database.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"User", func() error { _, err := store.GetUserById(ctx, uuid.New()); return err }},
+		{"Chirp", func() error { _, err := store.GetChirpById(ctx, uuid.New()); return err }},
+		{"Refresh token", func() error { _, err := store.RevokeRefreshToken(ctx, "missing"); return err }},
+		{"Subscription", func() error { _, err := store.GetSubscriptionByUser(ctx, uuid.New()); return err }},
+		{"Webhook delivery", func() error { _, err := store.RedeliverWebhookDelivery(ctx, uuid.New()); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows, got %v", err)
+			}
+		})
+	}
+
+	// :exec and :execrows queries don't fail when nothing matches
+	if err := store.UpdateUserPasswordHash(ctx, database.UpdateUserPasswordHashParams{ID: uuid.New()}); err != nil {
+		t.Errorf("expected no error updating a missing user, got %v", err)
+	}
+	if deleted, err := store.DeleteAnyChirpById(ctx, uuid.New()); err != nil || deleted != 0 {
+		t.Errorf("expected nothing to be deleted, got %d %v", deleted, err)
+	}
+}
+
+func TestChirps(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+
+	var created []database.Chirp
+	for _, body := range []string{"first", "second", "third"} {
+		chirp, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, chirp)
+	}
+	_, err := store.CreateChirp(ctx, database.CreateChirpParams{
+		Body:      "scheduled",
+		UserID:    user.ID,
+		PublishAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirps, err := store.GetChirps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != len(created) {
+		t.Fatalf("expected %d published chirps, got %d", len(created), len(chirps))
+	}
+	for i := range chirps {
+		if chirps[i].ID != created[i].ID {
+			t.Errorf("expected chirp %d to be %q, got %q", i, created[i].Body, chirps[i].Body)
+		}
+	}
+
+	if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("expected a foreign key violation, got %v", err)
+	}
+	deleted, err := store.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: created[0].ID, UserID: uuid.New()})
+	if err != nil || deleted != 0 {
+		t.Errorf("expected only the author to delete the chirp, deleted %d %v", deleted, err)
+	}
+}
+
+func TestResetUsersCascades(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+	if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	endpoint, err := store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{UserID: user.ID, Url: "https://example.com", EventTypes: []string{"chirp.created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{EndpointID: endpoint.ID, EventID: uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ResetUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := store.GetChirps(ctx); len(chirps) != 0 {
+		t.Errorf("expected the chirps to be deleted, got %d", len(chirps))
+	}
+	if _, err := store.GetRefreshToken(ctx, "token"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the refresh token to be deleted, got %v", err)
+	}
+	if _, err := store.GetWebhookDeliveryById(ctx, delivery.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the webhook delivery to be deleted, got %v", err)
+	}
+}
+
+func TestUniqueViolations(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+
+	params := database.CreateUserIdentityParams{UserID: user.ID, Provider: "github", Subject: "1"}
+	if _, err := store.CreateUserIdentity(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateUserIdentity(ctx, params); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("expected a unique violation, got %v", err)
+	}
+
+	// Emails aren't unique in the schema
+	if _, err := store.CreateUser(ctx, database.CreateUserParams{Email: user.Email}); err != nil {
+		t.Errorf("expected a second user with the same email, got %v", err)
+	}
+}
+
+func TestClaimDueWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+	endpoint, err := store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{EndpointID: endpoint.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lease := store.Now().Add(time.Minute)
+	claimed, err := store.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{LeaseUntil: lease, MaxDeliveries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("expected 2 deliveries to be claimed, got %d", len(claimed))
+	}
+	claimed, err = store.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{LeaseUntil: lease, MaxDeliveries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 {
+		t.Errorf("expected leased deliveries to be skipped, claimed %d", len(claimed))
+	}
+}
+
+func TestReturnedRowsAreCopies(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+	token, err := store.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+		UserID: user.ID, TokenHash: "hash", Scopes: []string{"chirps:read"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Scopes[0] = "admin"
+
+	stored, err := store.GetPersonalAccessTokenByHash(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Scopes[0] != "chirps:read" {
+		t.Errorf("expected the stored scopes to be unchanged, got %v", stored.Scopes)
+	}
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+	store := newStore()
+	user := createUser(t, store, "walt@example.com")
+
+	errRollback := errors.New("rollback")
+	err := store.InTx(ctx, func(q database.Querier) error {
+		if _, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID}); err != nil {
+			return err
+		}
+		if err := q.ResetUsers(ctx); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if _, err := store.GetUserById(ctx, user.ID); err != nil {
+		t.Errorf("expected the user to be restored, got %v", err)
+	}
+	if chirps, _ := store.GetChirps(ctx); len(chirps) != 0 {
+		t.Errorf("expected the chirp to be rolled back, got %d", len(chirps))
+	}
+
+	err = store.InTx(ctx, func(q database.Querier) error {
+		_, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := store.GetChirps(ctx); len(chirps) != 1 {
+		t.Errorf("expected the chirp to be committed, got %d", len(chirps))
+	}
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.OauthClient{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	client := database.OauthClient{
+		ID:           uuid.New(),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: slices.Clone(arg.RedirectUris),
+	}
+	s.oauthClients = append(s.oauthClients, client)
+	return cloneOAuthClient(client), nil
+}
+
+func (s *Store) GetOAuthClientById(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := find(s.oauthClients, func(client database.OauthClient) bool { return client.ID == id })
+	if !ok {
+		return database.OauthClient{}, sql.ErrNoRows
+	}
+	return cloneOAuthClient(*client), nil
+}
+
+func (s *Store) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := find(s.oauthCodes, func(code database.OauthAuthorizationCode) bool { return code.CodeHash == arg.CodeHash }); ok {
+		return database.OauthAuthorizationCode{}, uniqueViolation("oauth_authorization_codes_pkey")
+	}
+	if !s.oauthClientExists(arg.ClientID) {
+		return database.OauthAuthorizationCode{}, foreignKeyViolation("fk_client_id")
+	}
+	if !s.userExists(arg.UserID) {
+		return database.OauthAuthorizationCode{}, foreignKeyViolation("fk_user_id")
+	}
+	code := database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		CreatedAt:     s.now(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        slices.Clone(arg.Scopes),
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     timestamp(arg.ExpiresAt),
+	}
+	s.oauthCodes = append(s.oauthCodes, code)
+	return cloneOAuthCode(code), nil
+}
+
+func (s *Store) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := find(s.oauthCodes, func(code database.OauthAuthorizationCode) bool {
+		return code.CodeHash == codeHash && !code.UsedAt.Valid
+	})
+	if !ok {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+	code.UsedAt = sql.NullTime{Time: s.now(), Valid: true}
+	return cloneOAuthCode(*code), nil
+}
+
+// oauthClientExists checks the fk_client_id constraints. s.mu must be held.
+func (s *Store) oauthClientExists(id uuid.UUID) bool {
+	_, ok := find(s.oauthClients, func(client database.OauthClient) bool { return client.ID == id })
+	return ok
+}
+
+// deleteOAuthClients removes the clients along with their codes and refresh
+// tokens. s.mu must be held.
+func (s *Store) deleteOAuthClients(match func(database.OauthClient) bool) {
+	deleted := map[uuid.UUID]bool{}
+	for _, client := range remove(&s.oauthClients, match) {
+		deleted[client.ID] = true
+	}
+	remove(&s.oauthCodes, func(code database.OauthAuthorizationCode) bool { return deleted[code.ClientID] })
+	remove(&s.refreshTokens, func(token database.RefreshToken) bool {
+		return token.ClientID.Valid && deleted[token.ClientID.UUID]
+	})
+}
+
+func cloneOAuthClient(client database.OauthClient) database.OauthClient {
+	client.RedirectUris = slices.Clone(client.RedirectUris)
+	return client
+}
+
+func cloneOAuthCode(code database.OauthAuthorizationCode) database.OauthAuthorizationCode {
+	code.Scopes = slices.Clone(code.Scopes)
+	return code
+}
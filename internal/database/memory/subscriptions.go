@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription, ok := find(s.subscriptions, func(subscription database.Subscription) bool { return subscription.UserID == userID })
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	return *subscription, nil
+}
+
+func (s *Store) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.Subscription{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	subscription, ok := find(s.subscriptions, func(subscription database.Subscription) bool { return subscription.UserID == arg.UserID })
+	if !ok {
+		s.subscriptions = append(s.subscriptions, database.Subscription{
+			ID:        uuid.New(),
+			CreatedAt: now,
+			UserID:    arg.UserID,
+		})
+		subscription = &s.subscriptions[len(s.subscriptions)-1]
+	}
+	subscription.UpdatedAt = now
+	subscription.Plan = arg.Plan
+	subscription.Status = arg.Status
+	subscription.CurrentPeriodStart = timestamp(arg.CurrentPeriodStart)
+	subscription.CurrentPeriodEnd = timestamp(arg.CurrentPeriodEnd)
+	subscription.GracePeriodEnd = nullTimestamp(arg.GracePeriodEnd)
+	subscription.CanceledAt = nullTimestamp(arg.CanceledAt)
+	subscription.AccessUntil = timestamp(arg.AccessUntil)
+	return *subscription, nil
+}
+
+func (s *Store) ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	userIDs := []uuid.UUID{}
+	for i := range s.subscriptions {
+		subscription := &s.subscriptions[i]
+		if subscription.Status == database.SubscriptionStatusExpired || subscription.AccessUntil.After(now) {
+			continue
+		}
+		subscription.Status = database.SubscriptionStatusExpired
+		subscription.UpdatedAt = now
+		userIDs = append(userIDs, subscription.UserID)
+	}
+	return userIDs, nil
+}
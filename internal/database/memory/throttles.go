@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]database.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	throttles := filter(s.loginThrottles, func(throttle database.LoginThrottle) bool {
+		return slices.Contains(throttleKeys, throttle.ThrottleKey)
+	})
+	sortBy(throttles, func(throttle database.LoginThrottle) string { return throttle.ThrottleKey }, false)
+	return throttles, nil
+}
+
+func (s *Store) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	throttle, ok := find(s.loginThrottles, func(throttle database.LoginThrottle) bool { return throttle.ThrottleKey == arg.ThrottleKey })
+	if !ok {
+		s.loginThrottles = append(s.loginThrottles, database.LoginThrottle{
+			ThrottleKey:   arg.ThrottleKey,
+			Failures:      1,
+			LastFailureAt: now,
+		})
+		return s.loginThrottles[len(s.loginThrottles)-1], nil
+	}
+	if throttle.LastFailureAt.Before(timestamp(arg.ResetBefore)) {
+		throttle.Failures = 1
+	} else {
+		throttle.Failures++
+	}
+	throttle.LastFailureAt = now
+	return *throttle, nil
+}
+
+func (s *Store) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if throttle, ok := find(s.loginThrottles, func(throttle database.LoginThrottle) bool { return throttle.ThrottleKey == arg.ThrottleKey }); ok {
+		throttle.LockedUntil = nullTimestamp(arg.LockedUntil)
+	}
+	return nil
+}
+
+func (s *Store) DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := remove(&s.loginThrottles, func(throttle database.LoginThrottle) bool { return throttle.ThrottleKey == throttleKey })
+	return int64(len(deleted)), nil
+}
+
+func (s *Store) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	deleted := remove(&s.loginThrottles, func(throttle database.LoginThrottle) bool {
+		return throttle.LastFailureAt.Before(timestamp(lastFailureAt)) &&
+			(!throttle.LockedUntil.Valid || throttle.LockedUntil.Time.Before(now))
+	})
+	return int64(len(deleted)), nil
+}
@@ -0,0 +1,287 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	return s.createRefreshToken(database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: timestamp(arg.ExpiresAt),
+	})
+}
+
+func (s *Store) CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	return s.createRefreshToken(database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: timestamp(arg.ExpiresAt),
+		ClientID:  arg.ClientID,
+		Scopes:    slices.Clone(arg.Scopes),
+	})
+}
+
+func (s *Store) createRefreshToken(token database.RefreshToken) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := find(s.refreshTokens, func(existing database.RefreshToken) bool { return existing.Token == token.Token }); ok {
+		return database.RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+	if !s.userExists(token.UserID) {
+		return database.RefreshToken{}, foreignKeyViolation("fk_user_id")
+	}
+	if token.ClientID.Valid && !s.oauthClientExists(token.ClientID.UUID) {
+		return database.RefreshToken{}, foreignKeyViolation("refresh_tokens_client_id_fkey")
+	}
+	token.CreatedAt = s.now()
+	token.UpdatedAt = token.CreatedAt
+	s.refreshTokens = append(s.refreshTokens, token)
+	return cloneRefreshToken(token), nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := find(s.refreshTokens, func(refreshToken database.RefreshToken) bool { return refreshToken.Token == token })
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return cloneRefreshToken(*refreshToken), nil
+}
+
+func (s *Store) GetUserFromRefreshToken(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := find(s.refreshTokens, func(refreshToken database.RefreshToken) bool { return refreshToken.Token == token })
+	if !ok {
+		return database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+	}
+	user, ok := find(s.users, func(user database.User) bool { return user.ID == refreshToken.UserID })
+	if !ok {
+		return database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+	}
+	return database.GetUserFromRefreshTokenRow{
+		Token:        refreshToken.Token,
+		ExpiresAt:    refreshToken.ExpiresAt,
+		RevokedAt:    refreshToken.RevokedAt,
+		ClientID:     refreshToken.ClientID,
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		BannedAt:     user.BannedAt,
+	}, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := find(s.refreshTokens, func(refreshToken database.RefreshToken) bool { return refreshToken.Token == token })
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	now := s.now()
+	refreshToken.UpdatedAt = now
+	refreshToken.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	return cloneRefreshToken(*refreshToken), nil
+}
+
+func (s *Store) ConsumeOAuthRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := find(s.refreshTokens, func(refreshToken database.RefreshToken) bool {
+		return refreshToken.Token == token && !refreshToken.RevokedAt.Valid
+	})
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	now := s.now()
+	refreshToken.UpdatedAt = now
+	refreshToken.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	return cloneRefreshToken(*refreshToken), nil
+}
+
+func (s *Store) RevokeAllRefreshTokens(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var revoked int64
+	for i := range s.refreshTokens {
+		token := &s.refreshTokens[i]
+		if token.RevokedAt.Valid || !token.ExpiresAt.After(now) {
+			continue
+		}
+		token.UpdatedAt = now
+		token.RevokedAt = sql.NullTime{Time: now, Valid: true}
+		revoked++
+	}
+	return revoked, nil
+}
+
+func (s *Store) CreateAccessTokenRevocation(ctx context.Context, arg database.CreateAccessTokenRevocationParams) (database.AccessTokenRevocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.AccessTokenRevocation{}, foreignKeyViolation("fk_user_id")
+	}
+	// NULL jtis never conflict
+	if arg.Jti.Valid {
+		existing, ok := find(s.revocations, func(revocation database.AccessTokenRevocation) bool {
+			return revocation.Jti.Valid && revocation.Jti.String == arg.Jti.String
+		})
+		if ok {
+			existing.ExpiresAt = timestamp(arg.ExpiresAt)
+			return *existing, nil
+		}
+	}
+	revocation := database.AccessTokenRevocation{
+		ID:           uuid.New(),
+		CreatedAt:    s.now(),
+		UserID:       arg.UserID,
+		Jti:          arg.Jti,
+		ExpiresAt:    timestamp(arg.ExpiresAt),
+		TokenVersion: arg.TokenVersion,
+	}
+	s.revocations = append(s.revocations, revocation)
+	return revocation, nil
+}
+
+func (s *Store) GetActiveAccessTokenRevocations(ctx context.Context) ([]database.AccessTokenRevocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	revocations := filter(s.revocations, func(revocation database.AccessTokenRevocation) bool {
+		return revocation.ExpiresAt.After(now)
+	})
+	sortBy(revocations, func(revocation database.AccessTokenRevocation) int64 { return unixMicro(revocation.CreatedAt) }, false)
+	return revocations, nil
+}
+
+func (s *Store) DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	deleted := remove(&s.revocations, func(revocation database.AccessTokenRevocation) bool {
+		return !revocation.ExpiresAt.After(now)
+	})
+	return int64(len(deleted)), nil
+}
+
+func (s *Store) RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, user := range s.users {
+		s.revocations = append(s.revocations, database.AccessTokenRevocation{
+			ID:           uuid.New(),
+			CreatedAt:    now,
+			UserID:       user.ID,
+			ExpiresAt:    timestamp(expiresAt),
+			TokenVersion: user.TokenVersion,
+		})
+	}
+	return int64(len(s.users)), nil
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := find(s.personalAccessTokens, func(token database.PersonalAccessToken) bool { return token.TokenHash == arg.TokenHash }); ok {
+		return database.PersonalAccessToken{}, uniqueViolation("personal_access_tokens_token_hash_key")
+	}
+	if !s.userExists(arg.UserID) {
+		return database.PersonalAccessToken{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	token := database.PersonalAccessToken{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    slices.Clone(arg.Scopes),
+		ExpiresAt: timestamp(arg.ExpiresAt),
+	}
+	s.personalAccessTokens = append(s.personalAccessTokens, token)
+	return clonePersonalAccessToken(token), nil
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := find(s.personalAccessTokens, func(token database.PersonalAccessToken) bool { return token.TokenHash == tokenHash })
+	if !ok {
+		return database.PersonalAccessToken{}, sql.ErrNoRows
+	}
+	return clonePersonalAccessToken(*token), nil
+}
+
+func (s *Store) GetPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := filter(s.personalAccessTokens, func(token database.PersonalAccessToken) bool { return token.UserID == userID })
+	sortBy(tokens, func(token database.PersonalAccessToken) int64 { return unixMicro(token.CreatedAt) }, false)
+	for i := range tokens {
+		tokens[i] = clonePersonalAccessToken(tokens[i])
+	}
+	return tokens, nil
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := find(s.personalAccessTokens, func(token database.PersonalAccessToken) bool {
+		return token.ID == arg.ID && token.UserID == arg.UserID && !token.RevokedAt.Valid
+	})
+	if !ok {
+		return 0, nil
+	}
+	now := s.now()
+	token.UpdatedAt = now
+	token.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	return 1, nil
+}
+
+func (s *Store) RevokeAllPersonalAccessTokens(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var revoked int64
+	for i := range s.personalAccessTokens {
+		token := &s.personalAccessTokens[i]
+		if token.RevokedAt.Valid {
+			continue
+		}
+		token.UpdatedAt = now
+		token.RevokedAt = sql.NullTime{Time: now, Valid: true}
+		revoked++
+	}
+	return revoked, nil
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	token, ok := find(s.personalAccessTokens, func(token database.PersonalAccessToken) bool { return token.ID == id })
+	if ok && (!token.LastUsedAt.Valid || token.LastUsedAt.Time.Before(now.Add(-time.Minute))) {
+		token.LastUsedAt = sql.NullTime{Time: now, Valid: true}
+	}
+	return nil
+}
+
+func cloneRefreshToken(token database.RefreshToken) database.RefreshToken {
+	token.Scopes = slices.Clone(token.Scopes)
+	return token
+}
+
+func clonePersonalAccessToken(token database.PersonalAccessToken) database.PersonalAccessToken {
+	token.Scopes = slices.Clone(token.Scopes)
+	return token
+}
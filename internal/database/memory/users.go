@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	user := database.User{
+		ID:             uuid.New(),
+		Email:          arg.Email,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		HashedPassword: arg.HashedPassword,
+		Role:           database.UserRoleUser,
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *Store) ResetUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteUsers(func(database.User) bool { return true })
+	return nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	return s.getUser(func(user database.User) bool { return user.Email == email })
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.getUser(func(user database.User) bool { return user.ID == id })
+}
+
+func (s *Store) UpdateUserById(ctx context.Context, arg database.UpdateUserByIdParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.Email = arg.Email
+		user.HashedPassword = arg.HashedPassword
+		user.UpdatedAt = s.now()
+	})
+}
+
+func (s *Store) SetUserBanned(ctx context.Context, arg database.SetUserBannedParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(user *database.User) {
+		switch {
+		case !arg.Banned:
+			user.BannedAt = sql.NullTime{}
+		case !user.BannedAt.Valid:
+			user.BannedAt = sql.NullTime{Time: s.now(), Valid: true}
+		}
+		user.UpdatedAt = s.now()
+	})
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.Role = arg.Role
+		user.UpdatedAt = s.now()
+	})
+}
+
+func (s *Store) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	user, err := s.updateUser(id, func(user *database.User) {
+		user.TokenVersion++
+	})
+	return user.TokenVersion, err
+}
+
+func (s *Store) IncrementAllUserTokenVersions(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		s.users[i].TokenVersion++
+	}
+	return int64(len(s.users)), nil
+}
+
+func (s *Store) UpdateUserPasswordHash(ctx context.Context, arg database.UpdateUserPasswordHashParams) error {
+	_, err := s.updateUser(arg.ID, func(user *database.User) {
+		user.HashedPassword = arg.HashedPassword
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) getUser(match func(database.User) bool) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := find(s.users, match)
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return *user, nil
+}
+
+func (s *Store) updateUser(id uuid.UUID, update func(user *database.User)) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := find(s.users, func(user database.User) bool { return user.ID == id })
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	update(user)
+	return *user, nil
+}
+
+// userExists checks the fk_user_id constraints. s.mu must be held.
+func (s *Store) userExists(id uuid.UUID) bool {
+	_, ok := find(s.users, func(user database.User) bool { return user.ID == id })
+	return ok
+}
+
+// deleteUsers removes the users and cascades to every row referencing them.
+// s.mu must be held.
+func (s *Store) deleteUsers(match func(database.User) bool) {
+	deleted := map[uuid.UUID]bool{}
+	for _, user := range remove(&s.users, match) {
+		deleted[user.ID] = true
+	}
+	remove(&s.chirps, func(chirp database.Chirp) bool { return deleted[chirp.UserID] })
+	remove(&s.refreshTokens, func(token database.RefreshToken) bool { return deleted[token.UserID] })
+	remove(&s.revocations, func(revocation database.AccessTokenRevocation) bool { return deleted[revocation.UserID] })
+	remove(&s.personalAccessTokens, func(token database.PersonalAccessToken) bool { return deleted[token.UserID] })
+	remove(&s.oauthCodes, func(code database.OauthAuthorizationCode) bool { return deleted[code.UserID] })
+	remove(&s.identities, func(identity database.UserIdentity) bool { return deleted[identity.UserID] })
+	remove(&s.subscriptions, func(subscription database.Subscription) bool { return deleted[subscription.UserID] })
+	s.deleteOAuthClients(func(client database.OauthClient) bool { return deleted[client.UserID] })
+	s.deleteWebhookEndpoints(func(endpoint database.WebhookEndpoint) bool { return deleted[endpoint.UserID] })
+}
@@ -0,0 +1,307 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func (s *Store) RecordWebhookEvent(ctx context.Context, arg database.RecordWebhookEventParams) (database.WebhookEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := find(s.webhookEvents, func(event database.WebhookEvent) bool {
+		return event.Provider == arg.Provider && event.EventID == arg.EventID
+	})
+	if ok {
+		event.Attempts++
+		return *event, nil
+	}
+	s.webhookEvents = append(s.webhookEvents, database.WebhookEvent{
+		ID:         uuid.New(),
+		Provider:   arg.Provider,
+		EventID:    arg.EventID,
+		EventType:  arg.EventType,
+		Payload:    arg.Payload,
+		ReceivedAt: s.now(),
+		Outcome:    database.WebhookEventOutcomePending,
+		Attempts:   1,
+	})
+	return s.webhookEvents[len(s.webhookEvents)-1], nil
+}
+
+func (s *Store) RetryWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	return s.updateWebhookEvent(id, func(event *database.WebhookEvent) {
+		event.Attempts++
+	})
+}
+
+func (s *Store) ClaimWebhookEvent(ctx context.Context, arg database.ClaimWebhookEventParams) (database.WebhookEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := find(s.webhookEvents, func(event database.WebhookEvent) bool {
+		return event.ID == arg.ID &&
+			(arg.AnyOutcome || slices.Contains([]database.WebhookEventOutcome{
+				database.WebhookEventOutcomePending,
+				database.WebhookEventOutcomeFailed,
+				database.WebhookEventOutcomeInvalid,
+			}, event.Outcome)) &&
+			(!event.ClaimedAt.Valid || event.ClaimedAt.Time.Before(timestamp(arg.StaleBefore)))
+	})
+	if !ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	event.ClaimedAt = sql.NullTime{Time: s.now(), Valid: true}
+	return *event, nil
+}
+
+func (s *Store) ReleaseWebhookEvent(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event, ok := find(s.webhookEvents, func(event database.WebhookEvent) bool { return event.ID == id }); ok {
+		event.ClaimedAt = sql.NullTime{}
+	}
+	return nil
+}
+
+func (s *Store) FinishWebhookEvent(ctx context.Context, arg database.FinishWebhookEventParams) (database.WebhookEvent, error) {
+	return s.updateWebhookEvent(arg.ID, func(event *database.WebhookEvent) {
+		event.Outcome = arg.Outcome
+		event.Error = arg.Error
+		event.ProcessedAt = sql.NullTime{Time: s.now(), Valid: true}
+		event.ClaimedAt = sql.NullTime{}
+	})
+}
+
+func (s *Store) GetWebhookEventById(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	return s.updateWebhookEvent(id, func(*database.WebhookEvent) {})
+}
+
+func (s *Store) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := filter(s.webhookEvents, func(event database.WebhookEvent) bool {
+		return (!arg.Provider.Valid || event.Provider == arg.Provider.String) &&
+			(!arg.Outcome.Valid || event.Outcome == arg.Outcome.WebhookEventOutcome)
+	})
+	sortBy(events, func(event database.WebhookEvent) int64 { return unixMicro(event.ReceivedAt) }, true)
+	return page(events, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) updateWebhookEvent(id uuid.UUID, update func(event *database.WebhookEvent)) (database.WebhookEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := find(s.webhookEvents, func(event database.WebhookEvent) bool { return event.ID == id })
+	if !ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	update(event)
+	return *event, nil
+}
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.WebhookEndpoint{}, foreignKeyViolation("fk_user_id")
+	}
+	now := s.now()
+	endpoint := database.WebhookEndpoint{
+		ID:         uuid.New(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		UserID:     arg.UserID,
+		Url:        arg.Url,
+		Secret:     arg.Secret,
+		EventTypes: slices.Clone(arg.EventTypes),
+		Enabled:    true,
+	}
+	s.webhookEndpoints = append(s.webhookEndpoints, endpoint)
+	return cloneWebhookEndpoint(endpoint), nil
+}
+
+func (s *Store) GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	return s.updateWebhookEndpoint(func(endpoint database.WebhookEndpoint) bool { return endpoint.ID == id }, func(*database.WebhookEndpoint) {})
+}
+
+func (s *Store) GetWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoints := filter(s.webhookEndpoints, func(endpoint database.WebhookEndpoint) bool { return endpoint.UserID == userID })
+	sortBy(endpoints, func(endpoint database.WebhookEndpoint) int64 { return unixMicro(endpoint.CreatedAt) }, false)
+	for i := range endpoints {
+		endpoints[i] = cloneWebhookEndpoint(endpoints[i])
+	}
+	return endpoints, nil
+}
+
+func (s *Store) GetWebhookEndpointsForEvent(ctx context.Context, arg database.GetWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoints := filter(s.webhookEndpoints, func(endpoint database.WebhookEndpoint) bool {
+		return endpoint.UserID == arg.UserID && endpoint.Enabled && slices.Contains(endpoint.EventTypes, arg.EventType)
+	})
+	for i := range endpoints {
+		endpoints[i] = cloneWebhookEndpoint(endpoints[i])
+	}
+	return endpoints, nil
+}
+
+func (s *Store) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := s.deleteWebhookEndpoints(func(endpoint database.WebhookEndpoint) bool {
+		return endpoint.ID == arg.ID && endpoint.UserID == arg.UserID
+	})
+	return int64(deleted), nil
+}
+
+func (s *Store) EnableWebhookEndpoint(ctx context.Context, arg database.EnableWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	return s.updateWebhookEndpoint(func(endpoint database.WebhookEndpoint) bool {
+		return endpoint.ID == arg.ID && endpoint.UserID == arg.UserID
+	}, func(endpoint *database.WebhookEndpoint) {
+		endpoint.UpdatedAt = s.now()
+		endpoint.Enabled = true
+		endpoint.ConsecutiveFailures = 0
+		endpoint.DisabledAt = sql.NullTime{}
+	})
+}
+
+func (s *Store) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := s.updateWebhookEndpoint(func(endpoint database.WebhookEndpoint) bool { return endpoint.ID == id }, func(endpoint *database.WebhookEndpoint) {
+		endpoint.ConsecutiveFailures = 0
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error) {
+	return s.updateWebhookEndpoint(func(endpoint database.WebhookEndpoint) bool { return endpoint.ID == arg.ID }, func(endpoint *database.WebhookEndpoint) {
+		// Every SET expression sees the old row
+		failures := endpoint.ConsecutiveFailures + 1
+		if endpoint.Enabled && failures >= arg.DisableAfter {
+			endpoint.DisabledAt = sql.NullTime{Time: s.now(), Valid: true}
+		}
+		endpoint.Enabled = endpoint.Enabled && failures < arg.DisableAfter
+		endpoint.ConsecutiveFailures = failures
+	})
+}
+
+func (s *Store) updateWebhookEndpoint(match func(database.WebhookEndpoint) bool, update func(endpoint *database.WebhookEndpoint)) (database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := find(s.webhookEndpoints, match)
+	if !ok {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	update(endpoint)
+	return cloneWebhookEndpoint(*endpoint), nil
+}
+
+// deleteWebhookEndpoints removes the endpoints along with their deliveries and
+// returns how many endpoints it removed. s.mu must be held.
+func (s *Store) deleteWebhookEndpoints(match func(database.WebhookEndpoint) bool) int {
+	deleted := map[uuid.UUID]bool{}
+	for _, endpoint := range remove(&s.webhookEndpoints, match) {
+		deleted[endpoint.ID] = true
+	}
+	remove(&s.webhookDeliveries, func(delivery database.WebhookDelivery) bool { return deleted[delivery.EndpointID] })
+	return len(deleted)
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := find(s.webhookEndpoints, func(endpoint database.WebhookEndpoint) bool { return endpoint.ID == arg.EndpointID }); !ok {
+		return database.WebhookDelivery{}, foreignKeyViolation("fk_endpoint_id")
+	}
+	now := s.now()
+	s.webhookDeliveries = append(s.webhookDeliveries, database.WebhookDelivery{
+		ID:            uuid.New(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		EndpointID:    arg.EndpointID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       arg.Payload,
+		Status:        database.WebhookDeliveryStatusPending,
+		NextAttemptAt: now,
+	})
+	return s.webhookDeliveries[len(s.webhookDeliveries)-1], nil
+}
+
+func (s *Store) ClaimDueWebhookDeliveries(ctx context.Context, arg database.ClaimDueWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	due := []*database.WebhookDelivery{}
+	for i := range s.webhookDeliveries {
+		delivery := &s.webhookDeliveries[i]
+		if delivery.Status == database.WebhookDeliveryStatusPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sortBy(due, func(delivery *database.WebhookDelivery) int64 { return unixMicro(delivery.NextAttemptAt) }, false)
+	claimed := []database.WebhookDelivery{}
+	for _, delivery := range due[:min(len(due), max(int(arg.MaxDeliveries), 0))] {
+		delivery.NextAttemptAt = timestamp(arg.LeaseUntil)
+		delivery.UpdatedAt = now
+		claimed = append(claimed, *delivery)
+	}
+	return claimed, nil
+}
+
+func (s *Store) FinishWebhookDeliveryAttempt(ctx context.Context, arg database.FinishWebhookDeliveryAttemptParams) (database.WebhookDelivery, error) {
+	return s.updateWebhookDelivery(arg.ID, func(delivery *database.WebhookDelivery) {
+		now := s.now()
+		delivery.UpdatedAt = now
+		delivery.Status = arg.Status
+		delivery.Attempts++
+		delivery.NextAttemptAt = timestamp(arg.NextAttemptAt)
+		delivery.LastAttemptAt = sql.NullTime{Time: now, Valid: true}
+		delivery.ResponseStatus = arg.ResponseStatus
+		delivery.LastError = arg.LastError
+	})
+}
+
+func (s *Store) GetWebhookDeliveryById(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	return s.updateWebhookDelivery(id, func(*database.WebhookDelivery) {})
+}
+
+func (s *Store) GetWebhookDeliveriesByEndpoint(ctx context.Context, arg database.GetWebhookDeliveriesByEndpointParams) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := filter(s.webhookDeliveries, func(delivery database.WebhookDelivery) bool { return delivery.EndpointID == arg.EndpointID })
+	sortBy(deliveries, func(delivery database.WebhookDelivery) int64 { return unixMicro(delivery.CreatedAt) }, true)
+	return page(deliveries, arg.Limit, 0), nil
+}
+
+func (s *Store) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	return s.updateWebhookDelivery(id, func(delivery *database.WebhookDelivery) {
+		now := s.now()
+		delivery.Status = database.WebhookDeliveryStatusPending
+		delivery.NextAttemptAt = now
+		delivery.UpdatedAt = now
+	})
+}
+
+func (s *Store) updateWebhookDelivery(id uuid.UUID, update func(delivery *database.WebhookDelivery)) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := find(s.webhookDeliveries, func(delivery database.WebhookDelivery) bool { return delivery.ID == id })
+	if !ok {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	update(delivery)
+	return *delivery, nil
+}
+
+func cloneWebhookEndpoint(endpoint database.WebhookEndpoint) database.WebhookEndpoint {
+	endpoint.EventTypes = slices.Clone(endpoint.EventTypes)
+	return endpoint
+}
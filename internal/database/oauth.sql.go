@@ -0,0 +1,223 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: oauth.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const consumeOAuthAuthorizationCode = `-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = now()
+WHERE code_hash = $1 AND used_at IS NULL
+RETURNING code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, used_at
+`
+
+func (q *Queries) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, consumeOAuthAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const consumeOAuthRefreshToken = `-- name: ConsumeOAuthRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE token = $1 AND revoked_at IS NULL
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+func (q *Queries) ConsumeOAuthRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, consumeOAuthRefreshToken, token)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const createOAuthAuthorizationCode = `-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    created_at,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES ($1, now(), $2, $3, $4, $5, $6, $7)
+RETURNING code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, used_at
+`
+
+type CreateOAuthAuthorizationCodeParams struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+func (q *Queries) CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    name,
+    secret_hash,
+    redirect_uris
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4)
+RETURNING id, created_at, updated_at, user_id, name, secret_hash, redirect_uris
+`
+
+type CreateOAuthClientParams struct {
+	UserID       uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.UserID,
+		arg.Name,
+		arg.SecretHash,
+		pq.Array(arg.RedirectUris),
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+	)
+	return i, err
+}
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (
+    token,
+    created_at,
+    updated_at,
+    user_id,
+    expires_at,
+    client_id,
+    scopes
+) VALUES (
+    $1,
+    now(),
+    now(),
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	ClientID  uuid.NullUUID
+	Scopes    []string
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getOAuthClientById = `-- name: GetOAuthClientById :one
+SELECT id, created_at, updated_at, user_id, name, secret_hash, redirect_uris
+FROM oauth_clients
+WHERE id = $1
+`
+
+func (q *Queries) GetOAuthClientById(ctx context.Context, id uuid.UUID) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClientById, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+	)
+	return i, err
+}
@@ -0,0 +1,95 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Querier interface {
+	// Marks scheduled chirps that have become visible as announced, the caller
+	// publishes chirp.created for the ones returned
+	ClaimDueChirpAnnouncements(ctx context.Context, maxChirps int32) ([]Chirp, error)
+	// Pushes next_attempt_at out to lease_until so other workers skip the
+	// deliveries while they are being attempted
+	ClaimDueWebhookDeliveries(ctx context.Context, arg ClaimDueWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ClaimWebhookEvent(ctx context.Context, arg ClaimWebhookEventParams) (WebhookEvent, error)
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error)
+	ConsumeOAuthRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error)
+	CountPinnedChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	CreateAccessTokenRevocation(ctx context.Context, arg CreateAccessTokenRevocationParams) (AccessTokenRevocation, error)
+	CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OauthAuthorizationCode, error)
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error)
+	CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error)
+	CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error)
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error)
+	CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error)
+	DeleteAnyChirpById(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams) (int64, error)
+	DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error)
+	DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error)
+	DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error)
+	DeleteWebhookEndpoint(ctx context.Context, arg DeleteWebhookEndpointParams) (int64, error)
+	EnableWebhookEndpoint(ctx context.Context, arg EnableWebhookEndpointParams) (WebhookEndpoint, error)
+	ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error)
+	FinishWebhookDeliveryAttempt(ctx context.Context, arg FinishWebhookDeliveryAttemptParams) (WebhookDelivery, error)
+	FinishWebhookEvent(ctx context.Context, arg FinishWebhookEventParams) (WebhookEvent, error)
+	GetActiveAccessTokenRevocations(ctx context.Context) ([]AccessTokenRevocation, error)
+	GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
+	GetChirps(ctx context.Context) ([]Chirp, error)
+	GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]LoginThrottle, error)
+	GetOAuthClientById(ctx context.Context, id uuid.UUID) (OauthClient, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error)
+	GetPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error)
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (Subscription, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	GetWebhookDeliveriesByEndpoint(ctx context.Context, arg GetWebhookDeliveriesByEndpointParams) ([]WebhookDelivery, error)
+	GetWebhookDeliveryById(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (WebhookEndpoint, error)
+	GetWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]WebhookEndpoint, error)
+	GetWebhookEndpointsForEvent(ctx context.Context, arg GetWebhookEndpointsForEventParams) ([]WebhookEndpoint, error)
+	GetWebhookEventById(ctx context.Context, id uuid.UUID) (WebhookEvent, error)
+	IncrementAllUserTokenVersions(ctx context.Context) (int64, error)
+	IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+	ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error)
+	LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error)
+	RecordWebhookEndpointFailure(ctx context.Context, arg RecordWebhookEndpointFailureParams) (WebhookEndpoint, error)
+	RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error
+	RecordWebhookEvent(ctx context.Context, arg RecordWebhookEventParams) (WebhookEvent, error)
+	RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	// Gives up a claim without recording an outcome
+	ReleaseWebhookEvent(ctx context.Context, id uuid.UUID) error
+	ResetChirps(ctx context.Context) error
+	ResetUsers(ctx context.Context) error
+	RetryWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error)
+	RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error)
+	RevokeAllPersonalAccessTokens(ctx context.Context) (int64, error)
+	RevokeAllRefreshTokens(ctx context.Context) (int64, error)
+	RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error)
+	RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	SetChirpPinned(ctx context.Context, arg SetChirpPinnedParams) (Chirp, error)
+	SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error)
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error
+	UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error)
+	UpdateUserById(ctx context.Context, arg UpdateUserByIdParams) (User, error)
+	UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error)
+}
+
+var _ Querier = (*Queries)(nil)
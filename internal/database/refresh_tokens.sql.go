@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
@@ -27,7 +28,7 @@ INSERT INTO refresh_tokens (
     $2,
     $3
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
@@ -46,12 +47,14 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
 FROM refresh_tokens
 WHERE token = $1
 `
@@ -66,6 +69,8 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
@@ -75,7 +80,10 @@ SELECT
     refresh_tokens.token,
     refresh_tokens.expires_at,
     refresh_tokens.revoked_at,
-    users.id AS user_id
+    refresh_tokens.client_id,
+    users.id AS user_id,
+    users.token_version,
+    users.banned_at
 FROM refresh_tokens
 INNER JOIN users
     ON refresh_tokens.user_id = users.id
@@ -83,10 +91,13 @@ WHERE refresh_tokens.token = $1
 `
 
 type GetUserFromRefreshTokenRow struct {
-	Token     string
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
-	UserID    uuid.UUID
+	Token        string
+	ExpiresAt    time.Time
+	RevokedAt    sql.NullTime
+	ClientID     uuid.NullUUID
+	UserID       uuid.UUID
+	TokenVersion int32
+	BannedAt     sql.NullTime
 }
 
 func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
@@ -96,16 +107,33 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Ge
 		&i.Token,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
 		&i.UserID,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
 
+const revokeAllRefreshTokens = `-- name: RevokeAllRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE revoked_at IS NULL AND expires_at > now()
+`
+
+func (q *Queries) RevokeAllRefreshTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllRefreshTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET updated_at = now(), revoked_at = now()
 WHERE token = $1
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
 `
 
 func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
@@ -118,6 +146,8 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (Refresh
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
@@ -0,0 +1,115 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: access_token_revocations.sql
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAccessTokenRevocation = `-- name: CreateAccessTokenRevocation :one
+INSERT INTO access_token_revocations (user_id, jti, expires_at, token_version)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (jti) DO UPDATE SET expires_at = excluded.expires_at
+RETURNING id, created_at, user_id, jti, expires_at, token_version
+`
+
+type CreateAccessTokenRevocationParams struct {
+	UserID       uuid.UUID
+	Jti          sql.NullString
+	ExpiresAt    time.Time
+	TokenVersion int32
+}
+
+func (q *Queries) CreateAccessTokenRevocation(ctx context.Context, arg CreateAccessTokenRevocationParams) (AccessTokenRevocation, error) {
+	row := q.db.QueryRowContext(ctx, createAccessTokenRevocation,
+		arg.UserID,
+		arg.Jti,
+		arg.ExpiresAt,
+		arg.TokenVersion,
+	)
+	var i AccessTokenRevocation
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Jti,
+		&i.ExpiresAt,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const deleteExpiredAccessTokenRevocations = `-- name: DeleteExpiredAccessTokenRevocations :execrows
+DELETE FROM access_token_revocations
+WHERE expires_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+`
+
+func (q *Queries) DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredAccessTokenRevocations)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getActiveAccessTokenRevocations = `-- name: GetActiveAccessTokenRevocations :many
+SELECT id, created_at, user_id, jti, expires_at, token_version
+FROM access_token_revocations
+WHERE expires_at > strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+ORDER BY created_at ASC, rowid ASC
+`
+
+func (q *Queries) GetActiveAccessTokenRevocations(ctx context.Context) ([]AccessTokenRevocation, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveAccessTokenRevocations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccessTokenRevocation
+	for rows.Next() {
+		var i AccessTokenRevocation
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Jti,
+			&i.ExpiresAt,
+			&i.TokenVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllAccessTokens = `-- name: RevokeAllAccessTokens :execrows
+INSERT INTO access_token_revocations (user_id, jti, expires_at, token_version)
+SELECT
+    users.id,
+    NULL,
+    ?1,
+    users.token_version
+FROM users
+`
+
+func (q *Queries) RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllAccessTokens, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
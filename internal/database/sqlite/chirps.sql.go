@@ -0,0 +1,293 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: chirps.sql
+
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimDueChirpAnnouncements = `-- name: ClaimDueChirpAnnouncements :many
+UPDATE chirps
+SET announced_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id IN (
+    SELECT c.id
+    FROM chirps AS c
+    WHERE
+        c.announced_at IS NULL
+        AND c.publish_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ORDER BY c.publish_at ASC
+    LIMIT CAST(?1 AS INTEGER)
+)
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+// Marks scheduled chirps that have become visible as announced, the caller
+// publishes chirp.created for the ones returned
+func (q *Queries) ClaimDueChirpAnnouncements(ctx context.Context, maxChirps int64) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueChirpAnnouncements, maxChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.PinnedAt,
+			&i.PublishAt,
+			&i.AnnouncedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countChirpsByUserSince = `-- name: CountChirpsByUserSince :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = ? AND created_at > ?
+`
+
+type CountChirpsByUserSinceParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPinnedChirpsByUser = `-- name: CountPinnedChirpsByUser :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = ? AND pinned_at IS NOT NULL
+`
+
+func (q *Queries) CountPinnedChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPinnedChirpsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createChirp = `-- name: CreateChirp :one
+INSERT INTO chirps (body, user_id, publish_at, announced_at)
+VALUES (
+    ?1,
+    ?2,
+    coalesce(?3, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CASE
+        WHEN ?3 IS NULL
+            THEN strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    END
+)
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+type CreateChirpParams struct {
+	Body      string
+	UserID    uuid.UUID
+	PublishAt interface{}
+}
+
+// sqlc can't type publish_at here and CAST(... AS TIMESTAMP) would turn the
+// text into a number, so it is passed untyped
+func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
+
+const deleteAnyChirpById = `-- name: DeleteAnyChirpById :execrows
+DELETE FROM chirps
+WHERE id = ?
+`
+
+func (q *Queries) DeleteAnyChirpById(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAnyChirpById, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteChirpById = `-- name: DeleteChirpById :execrows
+DELETE FROM chirps
+WHERE id = ? AND user_id = ?
+`
+
+type DeleteChirpByIdParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpById, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpById = `-- name: GetChirpById :one
+SELECT id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+FROM chirps
+WHERE id = ?
+`
+
+func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpById, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
+
+const getChirps = `-- name: GetChirps :many
+SELECT id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+FROM chirps
+WHERE publish_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+ORDER BY created_at ASC, rowid ASC
+`
+
+func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.PinnedAt,
+			&i.PublishAt,
+			&i.AnnouncedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resetChirps = `-- name: ResetChirps :exec
+DELETE FROM chirps
+`
+
+func (q *Queries) ResetChirps(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetChirps)
+	return err
+}
+
+const setChirpPinned = `-- name: SetChirpPinned :one
+UPDATE chirps
+SET
+    pinned_at = CASE
+        WHEN CAST(?1 AS BOOLEAN) THEN coalesce(pinned_at, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+    END
+WHERE id = ?2 AND user_id = ?3
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+type SetChirpPinnedParams struct {
+	Pinned bool
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) SetChirpPinned(ctx context.Context, arg SetChirpPinnedParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpPinned, arg.Pinned, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ? AND user_id = ?
+RETURNING id, body, created_at, updated_at, user_id, pinned_at, publish_at, announced_at
+`
+
+type UpdateChirpBodyParams struct {
+	Body   string
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PinnedAt,
+		&i.PublishAt,
+		&i.AnnouncedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,145 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: login_throttles.sql
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const deleteLoginThrottle = `-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE throttle_key = ?
+`
+
+func (q *Queries) DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLoginThrottle, throttleKey)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteStaleLoginThrottles = `-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE
+    last_failure_at < ?
+    AND (locked_until IS NULL OR locked_until < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+`
+
+func (q *Queries) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleLoginThrottles, lastFailureAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLoginThrottles = `-- name: GetLoginThrottles :many
+SELECT throttle_key, failures, last_failure_at, locked_until
+FROM login_throttles
+WHERE throttle_key IN (/*SLICE:throttle_keys*/?)
+ORDER BY throttle_key ASC
+`
+
+func (q *Queries) GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]LoginThrottle, error) {
+	query := getLoginThrottles
+	var queryParams []interface{}
+	if len(throttleKeys) > 0 {
+		for _, v := range throttleKeys {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:throttle_keys*/?", strings.Repeat(",?", len(throttleKeys))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:throttle_keys*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoginThrottle
+	for rows.Next() {
+		var i LoginThrottle
+		if err := rows.Scan(
+			&i.ThrottleKey,
+			&i.Failures,
+			&i.LastFailureAt,
+			&i.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockLoginThrottle = `-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = ?1
+WHERE throttle_key = ?2
+`
+
+type LockLoginThrottleParams struct {
+	LockedUntil sql.NullTime
+	ThrottleKey string
+}
+
+func (q *Queries) LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) error {
+	_, err := q.db.ExecContext(ctx, lockLoginThrottle, arg.LockedUntil, arg.ThrottleKey)
+	return err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+VALUES (
+    ?1,
+    coalesce((
+        SELECT
+            CASE
+                WHEN
+                    t.last_failure_at < ?2
+                    THEN 1
+                ELSE t.failures + 1
+            END
+        FROM login_throttles AS t
+        WHERE t.throttle_key = ?1
+    ), 1),
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+)
+ON CONFLICT (throttle_key) DO UPDATE
+SET
+    failures = excluded.failures,
+    last_failure_at = excluded.last_failure_at
+RETURNING throttle_key, failures, last_failure_at, locked_until
+`
+
+type RecordLoginFailureParams struct {
+	ThrottleKey string
+	ResetBefore time.Time
+}
+
+// SQLite upserts can't bind parameters in DO UPDATE, so the new count is
+// worked out in the inserted row
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginFailure, arg.ThrottleKey, arg.ResetBefore)
+	var i LoginThrottle
+	err := row.Scan(
+		&i.ThrottleKey,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
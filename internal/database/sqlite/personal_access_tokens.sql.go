@@ -0,0 +1,170 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: personal_access_tokens.sql
+
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createPersonalAccessToken = `-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (
+    user_id,
+    name,
+    token_hash,
+    scopes,
+    expires_at
+) VALUES (?, ?, ?, ?, ?)
+RETURNING id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at
+`
+
+type CreatePersonalAccessTokenParams struct {
+	UserID    uuid.UUID
+	Name      string
+	TokenHash string
+	Scopes    Strings
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error) {
+	row := q.db.QueryRowContext(ctx, createPersonalAccessToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i PersonalAccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getPersonalAccessTokenByHash = `-- name: GetPersonalAccessTokenByHash :one
+SELECT id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at
+FROM personal_access_tokens
+WHERE token_hash = ?
+`
+
+func (q *Queries) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error) {
+	row := q.db.QueryRowContext(ctx, getPersonalAccessTokenByHash, tokenHash)
+	var i PersonalAccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getPersonalAccessTokensByUser = `-- name: GetPersonalAccessTokensByUser :many
+SELECT id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at
+FROM personal_access_tokens
+WHERE user_id = ?
+ORDER BY created_at ASC, rowid ASC
+`
+
+func (q *Queries) GetPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error) {
+	rows, err := q.db.QueryContext(ctx, getPersonalAccessTokensByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PersonalAccessToken
+	for rows.Next() {
+		var i PersonalAccessToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			&i.Scopes,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllPersonalAccessTokens = `-- name: RevokeAllPersonalAccessTokens :execrows
+UPDATE personal_access_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllPersonalAccessTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllPersonalAccessTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokePersonalAccessToken = `-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+`
+
+type RevokePersonalAccessTokenParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokePersonalAccessToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const touchPersonalAccessToken = `-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE
+    id = ?
+    AND (
+        last_used_at IS NULL
+        OR last_used_at < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', '-1 minute')
+    )
+`
+
+func (q *Queries) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchPersonalAccessToken, id)
+	return err
+}
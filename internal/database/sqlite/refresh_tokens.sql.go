@@ -0,0 +1,141 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: refresh_tokens.sql
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createRefreshToken = `-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token, user_id, expires_at)
+VALUES (?, ?, ?)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+type CreateRefreshTokenParams struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+FROM refresh_tokens
+WHERE token = ?
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
+SELECT
+    refresh_tokens.token,
+    refresh_tokens.expires_at,
+    refresh_tokens.revoked_at,
+    refresh_tokens.client_id,
+    users.id AS user_id,
+    users.token_version,
+    users.banned_at
+FROM refresh_tokens
+INNER JOIN users
+    ON refresh_tokens.user_id = users.id
+WHERE refresh_tokens.token = ?
+`
+
+type GetUserFromRefreshTokenRow struct {
+	Token        string
+	ExpiresAt    time.Time
+	RevokedAt    sql.NullTime
+	ClientID     uuid.NullUUID
+	UserID       uuid.UUID
+	TokenVersion int32
+	BannedAt     sql.NullTime
+}
+
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+	var i GetUserFromRefreshTokenRow
+	err := row.Scan(
+		&i.Token,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const revokeAllRefreshTokens = `-- name: RevokeAllRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE revoked_at IS NULL AND expires_at > strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+`
+
+func (q *Queries) RevokeAllRefreshTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllRefreshTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeRefreshToken = `-- name: RevokeRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE token = ?
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, token)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
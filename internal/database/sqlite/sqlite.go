@@ -0,0 +1,140 @@
+// Package sqlite runs the queries in sql/sqlite against SQLite. The queries
+// are generated by sqlc like the Postgres ones, Store adapts them to
+// database.Querier so the rest of the server doesn't know which backend it
+// talks to.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/database"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// connParams apply to every connection in the pool. Timestamps are written in
+// UTC as text that sorts chronologically, foreign keys are enforced and write
+// transactions take the lock up front so they wait on busy_timeout rather
+// than fail when they upgrade.
+const connParams = "_time_format=sqlite" +
+	"&_pragma=foreign_keys(1)" +
+	"&_pragma=busy_timeout(5000)" +
+	"&_pragma=journal_mode(WAL)" +
+	"&_txlock=immediate"
+
+// Open opens the database file named by dsn, e.g. "chirpy.db" or
+// "file:chirpy.db?mode=rwc". Every connection in the pool opens its own
+// ":memory:" database so use a file, even in tests.
+func Open(dsn string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite", dsn+sep+connParams)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// NewTxRunner runs transactions on db, retrying them when another writer
+// holds the lock past busy_timeout. SQLite transactions are always
+// serializable.
+func NewTxRunner(db *sql.DB, newQuerier func(tx database.DBTX) database.Querier) *database.TxRunner {
+	return &database.TxRunner{
+		DB:         db,
+		NewQuerier: newQuerier,
+		Retryable:  IsBusy,
+		Attempts:   database.DefaultTxAttempts,
+	}
+}
+
+// IsBusy reports whether SQLite gave up waiting for another connection's lock
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Extended codes keep the primary code in the low byte
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// Strings is a TEXT[] column, stored as a JSON array
+type Strings []string
+
+func (s *Strings) Scan(src any) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	default:
+		return fmt.Errorf("unsupported scan type for Strings: %T", src)
+	}
+	return json.Unmarshal(data, (*[]string)(s))
+}
+
+// Value stores nil as NULL like pq.Array
+func (s Strings) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]string(s))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// utcDB stores every time argument in UTC to the microsecond, like a
+// Postgres TIMESTAMP, so the text comparisons in the queries order them
+type utcDB struct {
+	db DBTX
+}
+
+func (u utcDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return u.db.ExecContext(ctx, query, utcArgs(args)...)
+}
+
+func (u utcDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return u.db.PrepareContext(ctx, query)
+}
+
+func (u utcDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return u.db.QueryContext(ctx, query, utcArgs(args)...)
+}
+
+func (u utcDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return u.db.QueryRowContext(ctx, query, utcArgs(args)...)
+}
+
+func utcArgs(args []any) []any {
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case time.Time:
+			args[i] = utc(arg)
+		case sql.NullTime:
+			if arg.Valid {
+				arg.Time = utc(arg.Time)
+				args[i] = arg
+			}
+		}
+	}
+	return args
+}
+
+func utc(t time.Time) time.Time {
+	return t.UTC().Round(time.Microsecond)
+}
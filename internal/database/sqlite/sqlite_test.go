@@ -0,0 +1,389 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/sql/sqlite/schema"
+)
+
+// migratedDB opens a database in a temp file with every migration applied
+func migratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrations, err := schema.NewProvider(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	return NewStore(migratedDB(t))
+}
+
+func addUser(t *testing.T, store *Store, email string) database.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestMigrateDown(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations, err := schema.NewProvider(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := migrations.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.DownTo(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(ctx); err != nil {
+		t.Errorf("expected the schema to be reapplied after rolling back, got %v", err)
+	}
+}
+
+func TestUser(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+	if user.ID == uuid.Nil || user.Role != database.UserRoleUser || user.CreatedAt.IsZero() {
+		t.Errorf("expected the column defaults, got %+v", user)
+	}
+	if _, offset := user.CreatedAt.Zone(); offset != 0 {
+		t.Errorf("expected timestamps in UTC, got %s", user.CreatedAt)
+	}
+
+	got, err := store.GetUserByEmail(ctx, "walt@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != user {
+		t.Errorf("expected %+v, got %+v", user, got)
+	}
+	if _, err := store.GetUserById(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestChirps(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+
+	var created []database.Chirp
+	for _, body := range []string{"first", "second", "third"} {
+		chirp, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, chirp)
+	}
+	publishAt := time.Now().Add(time.Hour)
+	scheduled, err := store.CreateChirp(ctx, database.CreateChirpParams{
+		Body:      "scheduled",
+		UserID:    user.ID,
+		PublishAt: sql.NullTime{Time: publishAt, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scheduled.PublishAt.Equal(publishAt.Round(time.Microsecond)) {
+		t.Errorf("expected the chirp to be published at %s, got %s", publishAt, scheduled.PublishAt)
+	}
+
+	chirps, err := store.GetChirps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != len(created) {
+		t.Fatalf("expected %d published chirps, got %d", len(created), len(chirps))
+	}
+	for i := range chirps {
+		if chirps[i].ID != created[i].ID {
+			t.Errorf("expected chirp %d to be %q, got %q", i, created[i].Body, chirps[i].Body)
+		}
+	}
+
+	pinned, err := store.SetChirpPinned(ctx, database.SetChirpPinnedParams{ID: created[0].ID, UserID: user.ID, Pinned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned.PinnedAt.Valid {
+		t.Error("expected the chirp to be pinned")
+	}
+	if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); err == nil {
+		t.Error("expected the foreign key to be enforced")
+	}
+}
+
+func TestResetUsersCascades(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+	if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ResetUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := store.GetChirps(ctx); len(chirps) != 0 {
+		t.Errorf("expected the chirps to be deleted, got %d", len(chirps))
+	}
+	if _, err := store.GetRefreshToken(ctx, "token"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the refresh token to be deleted, got %v", err)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+	tests := []struct {
+		name   string
+		scopes []string
+	}{
+		{"Nil", nil},
+		{"Empty", []string{}},
+		{"Scopes", []string{"chirps:read", "chirps:write"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// refresh_tokens.scopes is the one nullable array, nil is stored as NULL like pq.Array
+			token, err := store.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+				Token: tt.name, UserID: user.ID, Scopes: tt.scopes, ExpiresAt: time.Now().Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (token.Scopes == nil) != (tt.scopes == nil) || len(token.Scopes) != len(tt.scopes) {
+				t.Fatalf("expected %#v, got %#v", tt.scopes, token.Scopes)
+			}
+			for i := range tt.scopes {
+				if token.Scopes[i] != tt.scopes[i] {
+					t.Errorf("expected %#v, got %#v", tt.scopes, token.Scopes)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	for want := int32(1); want <= 3; want++ {
+		throttle, err := store.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			ThrottleKey: "email:walt@example.com",
+			ResetBefore: time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != want {
+			t.Fatalf("expected %d failures, got %d", want, throttle.Failures)
+		}
+	}
+
+	throttle, err := store.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		ThrottleKey: "email:walt@example.com",
+		ResetBefore: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 1 {
+		t.Errorf("expected failures before reset_before to be forgotten, got %d", throttle.Failures)
+	}
+}
+
+func TestWebhookEndpointsForEvent(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+	for _, eventTypes := range [][]string{{"chirp.created"}, {"chirp.deleted"}, {"chirp.created", "chirp.deleted"}} {
+		_, err := store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{UserID: user.ID, Url: "https://example.com", EventTypes: eventTypes})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	endpoints, err := store.GetWebhookEndpointsForEvent(ctx, database.GetWebhookEndpointsForEventParams{UserID: user.ID, EventType: "chirp.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Errorf("expected 2 endpoints subscribed to chirp.created, got %d", len(endpoints))
+	}
+}
+
+func TestClaimDueWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	user := addUser(t, store, "walt@example.com")
+	endpoint, err := store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{UserID: user.ID, EventTypes: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{EndpointID: endpoint.ID, EventID: uuid.New(), Payload: "{}"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lease := time.Now().Add(time.Minute)
+	claimed, err := store.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{LeaseUntil: lease, MaxDeliveries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("expected 2 deliveries to be claimed, got %d", len(claimed))
+	}
+	claimed, err = store.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{LeaseUntil: lease, MaxDeliveries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 {
+		t.Errorf("expected leased deliveries to be skipped, claimed %d", len(claimed))
+	}
+}
+
+func TestListWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	for i, provider := range []string{"polka", "polka", "stripe"} {
+		_, err := store.RecordWebhookEvent(ctx, database.RecordWebhookEventParams{
+			Provider: provider, EventID: uuid.NewString(), EventType: "user.upgraded", Payload: "{}",
+		})
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+	tests := []struct {
+		name   string
+		params database.ListWebhookEventsParams
+		want   int
+	}{
+		{"All", database.ListWebhookEventsParams{Limit: 10}, 3},
+		{"Provider", database.ListWebhookEventsParams{Limit: 10, Provider: sql.NullString{String: "polka", Valid: true}}, 2},
+		{"Outcome", database.ListWebhookEventsParams{Limit: 10, Outcome: database.NullWebhookEventOutcome{
+			WebhookEventOutcome: database.WebhookEventOutcomeFailed, Valid: true,
+		}}, 0},
+		{"Page", database.ListWebhookEventsParams{Limit: 2, Offset: 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := store.ListWebhookEvents(ctx, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != tt.want {
+				t.Errorf("expected %d events, got %d", tt.want, len(events))
+			}
+		})
+	}
+}
+
+func TestTxRunner(t *testing.T) {
+	ctx := context.Background()
+	db := migratedDB(t)
+	store := NewStore(db)
+	errConflict := errors.New("conflict")
+	runner := NewTxRunner(db, func(tx database.DBTX) database.Querier { return NewStore(tx) })
+	runner.Retryable = func(err error) bool { return errors.Is(err, errConflict) }
+
+	tests := []struct {
+		name         string
+		failAttempts int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"Commits", 0, 1, false},
+		{"Retries", 1, 2, false},
+		{"Gives up", database.DefaultTxAttempts, database.DefaultTxAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []uuid.UUID
+			err := runner.InTx(ctx, func(q database.Querier) error {
+				user, err := q.CreateUser(ctx, database.CreateUserParams{Email: tt.name})
+				if err != nil {
+					return err
+				}
+				created = append(created, user.ID)
+				if len(created) <= tt.failAttempts {
+					return errConflict
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(created) != tt.wantAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.wantAttempts, len(created))
+			}
+			for i, id := range created {
+				_, err := store.GetUserById(ctx, id)
+				committed := !tt.wantErr && i == len(created)-1
+				if committed != (err == nil) {
+					t.Errorf("attempt %d: expected committed %v, got %v", i+1, committed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	impatient, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(0)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer impatient.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	_, err = impatient.BeginTx(ctx, nil)
+	if !IsBusy(err) {
+		t.Errorf("expected a busy error, got %v", err)
+	}
+	if IsBusy(errors.New("disk I/O error")) {
+		t.Error("expected other errors not to be busy")
+	}
+}
@@ -0,0 +1,541 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+var _ database.Querier = (*Store)(nil)
+
+// Store runs the SQLite queries and converts their rows and params to the
+// database package's. Most are identical structs; the exceptions are the JSON
+// array columns, integer params sqlc types as int64, publish_at which it can't
+// type and queries whose params it numbers in a different order.
+type Store struct {
+	q *Queries
+}
+
+func NewStore(db DBTX) *Store {
+	return &Store{q: New(utcDB{db: db})}
+}
+
+// convertRows applies convert to every row, keeping a nil slice nil
+func convertRows[From, To any](rows []From, convert func(From) To) []To {
+	if rows == nil {
+		return nil
+	}
+	converted := make([]To, len(rows))
+	for i, row := range rows {
+		converted[i] = convert(row)
+	}
+	return converted
+}
+
+func chirp(c Chirp) database.Chirp { return database.Chirp(c) }
+
+func user(u User) database.User { return database.User(u) }
+
+func revocation(r AccessTokenRevocation) database.AccessTokenRevocation {
+	return database.AccessTokenRevocation(r)
+}
+
+func loginThrottle(t LoginThrottle) database.LoginThrottle { return database.LoginThrottle(t) }
+
+func webhookDelivery(d WebhookDelivery) database.WebhookDelivery {
+	return database.WebhookDelivery(d)
+}
+
+func webhookEvent(e WebhookEvent) database.WebhookEvent { return database.WebhookEvent(e) }
+
+func subscription(s Subscription) database.Subscription { return database.Subscription(s) }
+
+func userIdentity(i UserIdentity) database.UserIdentity { return database.UserIdentity(i) }
+
+func refreshToken(t RefreshToken) database.RefreshToken {
+	return database.RefreshToken{
+		Token:     t.Token,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+		UserID:    t.UserID,
+		ExpiresAt: t.ExpiresAt,
+		RevokedAt: t.RevokedAt,
+		ClientID:  t.ClientID,
+		Scopes:    t.Scopes,
+	}
+}
+
+func personalAccessToken(t PersonalAccessToken) database.PersonalAccessToken {
+	return database.PersonalAccessToken{
+		ID:         t.ID,
+		CreatedAt:  t.CreatedAt,
+		UpdatedAt:  t.UpdatedAt,
+		UserID:     t.UserID,
+		Name:       t.Name,
+		TokenHash:  t.TokenHash,
+		Scopes:     t.Scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+func oauthClient(c OauthClient) database.OauthClient {
+	return database.OauthClient{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		UserID:       c.UserID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectUris: c.RedirectUris,
+	}
+}
+
+func oauthAuthorizationCode(c OauthAuthorizationCode) database.OauthAuthorizationCode {
+	return database.OauthAuthorizationCode{
+		CodeHash:      c.CodeHash,
+		CreatedAt:     c.CreatedAt,
+		ClientID:      c.ClientID,
+		UserID:        c.UserID,
+		RedirectUri:   c.RedirectUri,
+		Scopes:        c.Scopes,
+		CodeChallenge: c.CodeChallenge,
+		ExpiresAt:     c.ExpiresAt,
+		UsedAt:        c.UsedAt,
+	}
+}
+
+func webhookEndpoint(e WebhookEndpoint) database.WebhookEndpoint {
+	return database.WebhookEndpoint{
+		ID:                  e.ID,
+		CreatedAt:           e.CreatedAt,
+		UpdatedAt:           e.UpdatedAt,
+		UserID:              e.UserID,
+		Url:                 e.Url,
+		Secret:              e.Secret,
+		EventTypes:          e.EventTypes,
+		Enabled:             e.Enabled,
+		ConsecutiveFailures: e.ConsecutiveFailures,
+		DisabledAt:          e.DisabledAt,
+	}
+}
+
+// one converts a :one query's row, returning the zero row on error like the
+// Postgres queries do
+func one[From, To any](row From, err error, convert func(From) To) (To, error) {
+	if err != nil {
+		var zero To
+		return zero, err
+	}
+	return convert(row), nil
+}
+
+func many[From, To any](rows []From, err error, convert func(From) To) ([]To, error) {
+	if err != nil {
+		return nil, err
+	}
+	return convertRows(rows, convert), nil
+}
+
+func (s *Store) CreateAccessTokenRevocation(ctx context.Context, arg database.CreateAccessTokenRevocationParams) (database.AccessTokenRevocation, error) {
+	row, err := s.q.CreateAccessTokenRevocation(ctx, CreateAccessTokenRevocationParams(arg))
+	return one(row, err, revocation)
+}
+
+func (s *Store) DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error) {
+	return s.q.DeleteExpiredAccessTokenRevocations(ctx)
+}
+
+func (s *Store) GetActiveAccessTokenRevocations(ctx context.Context) ([]database.AccessTokenRevocation, error) {
+	rows, err := s.q.GetActiveAccessTokenRevocations(ctx)
+	return many(rows, err, revocation)
+}
+
+func (s *Store) RevokeAllAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	return s.q.RevokeAllAccessTokens(ctx, expiresAt)
+}
+
+func (s *Store) CountChirpsByUserSince(ctx context.Context, arg database.CountChirpsByUserSinceParams) (int64, error) {
+	return s.q.CountChirpsByUserSince(ctx, CountChirpsByUserSinceParams(arg))
+}
+
+func (s *Store) CountPinnedChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountPinnedChirpsByUser(ctx, userID)
+}
+
+func (s *Store) ClaimDueChirpAnnouncements(ctx context.Context, maxChirps int32) ([]database.Chirp, error) {
+	rows, err := s.q.ClaimDueChirpAnnouncements(ctx, int64(maxChirps))
+	return many(rows, err, chirp)
+}
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	row, err := s.q.CreateChirp(ctx, CreateChirpParams{Body: arg.Body, UserID: arg.UserID, PublishAt: arg.PublishAt})
+	return one(row, err, chirp)
+}
+
+func (s *Store) DeleteAnyChirpById(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteAnyChirpById(ctx, id)
+}
+
+func (s *Store) DeleteChirpById(ctx context.Context, arg database.DeleteChirpByIdParams) (int64, error) {
+	return s.q.DeleteChirpById(ctx, DeleteChirpByIdParams(arg))
+}
+
+func (s *Store) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	row, err := s.q.GetChirpById(ctx, id)
+	return one(row, err, chirp)
+}
+
+func (s *Store) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	rows, err := s.q.GetChirps(ctx)
+	return many(rows, err, chirp)
+}
+
+func (s *Store) ResetChirps(ctx context.Context) error {
+	return s.q.ResetChirps(ctx)
+}
+
+func (s *Store) SetChirpPinned(ctx context.Context, arg database.SetChirpPinnedParams) (database.Chirp, error) {
+	row, err := s.q.SetChirpPinned(ctx, SetChirpPinnedParams{Pinned: arg.Pinned, ID: arg.ID, UserID: arg.UserID})
+	return one(row, err, chirp)
+}
+
+func (s *Store) UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error) {
+	row, err := s.q.UpdateChirpBody(ctx, UpdateChirpBodyParams(arg))
+	return one(row, err, chirp)
+}
+
+func (s *Store) DeleteLoginThrottle(ctx context.Context, throttleKey string) (int64, error) {
+	return s.q.DeleteLoginThrottle(ctx, throttleKey)
+}
+
+func (s *Store) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) (int64, error) {
+	return s.q.DeleteStaleLoginThrottles(ctx, lastFailureAt)
+}
+
+func (s *Store) GetLoginThrottles(ctx context.Context, throttleKeys []string) ([]database.LoginThrottle, error) {
+	rows, err := s.q.GetLoginThrottles(ctx, throttleKeys)
+	return many(rows, err, loginThrottle)
+}
+
+func (s *Store) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	return s.q.LockLoginThrottle(ctx, LockLoginThrottleParams{LockedUntil: arg.LockedUntil, ThrottleKey: arg.ThrottleKey})
+}
+
+func (s *Store) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	row, err := s.q.RecordLoginFailure(ctx, RecordLoginFailureParams(arg))
+	return one(row, err, loginThrottle)
+}
+
+func (s *Store) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	row, err := s.q.ConsumeOAuthAuthorizationCode(ctx, codeHash)
+	return one(row, err, oauthAuthorizationCode)
+}
+
+func (s *Store) ConsumeOAuthRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	row, err := s.q.ConsumeOAuthRefreshToken(ctx, token)
+	return one(row, err, refreshToken)
+}
+
+func (s *Store) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	row, err := s.q.CreateOAuthAuthorizationCode(ctx, CreateOAuthAuthorizationCodeParams{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	})
+	return one(row, err, oauthAuthorizationCode)
+}
+
+func (s *Store) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	row, err := s.q.CreateOAuthClient(ctx, CreateOAuthClientParams{
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: arg.RedirectUris,
+	})
+	return one(row, err, oauthClient)
+}
+
+func (s *Store) CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	row, err := s.q.CreateOAuthRefreshToken(ctx, CreateOAuthRefreshTokenParams{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		ClientID:  arg.ClientID,
+		Scopes:    arg.Scopes,
+	})
+	return one(row, err, refreshToken)
+}
+
+func (s *Store) GetOAuthClientById(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	row, err := s.q.GetOAuthClientById(ctx, id)
+	return one(row, err, oauthClient)
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	row, err := s.q.CreatePersonalAccessToken(ctx, CreatePersonalAccessTokenParams{
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return one(row, err, personalAccessToken)
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	row, err := s.q.GetPersonalAccessTokenByHash(ctx, tokenHash)
+	return one(row, err, personalAccessToken)
+}
+
+func (s *Store) GetPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	rows, err := s.q.GetPersonalAccessTokensByUser(ctx, userID)
+	return many(rows, err, personalAccessToken)
+}
+
+func (s *Store) RevokeAllPersonalAccessTokens(ctx context.Context) (int64, error) {
+	return s.q.RevokeAllPersonalAccessTokens(ctx)
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	return s.q.RevokePersonalAccessToken(ctx, RevokePersonalAccessTokenParams(arg))
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	return s.q.TouchPersonalAccessToken(ctx, id)
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	row, err := s.q.CreateRefreshToken(ctx, CreateRefreshTokenParams(arg))
+	return one(row, err, refreshToken)
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	row, err := s.q.GetRefreshToken(ctx, token)
+	return one(row, err, refreshToken)
+}
+
+func (s *Store) GetUserFromRefreshToken(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+	row, err := s.q.GetUserFromRefreshToken(ctx, token)
+	return one(row, err, func(row GetUserFromRefreshTokenRow) database.GetUserFromRefreshTokenRow {
+		return database.GetUserFromRefreshTokenRow(row)
+	})
+}
+
+func (s *Store) RevokeAllRefreshTokens(ctx context.Context) (int64, error) {
+	return s.q.RevokeAllRefreshTokens(ctx)
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	row, err := s.q.RevokeRefreshToken(ctx, token)
+	return one(row, err, refreshToken)
+}
+
+func (s *Store) ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error) {
+	return s.q.ExpireLapsedSubscriptions(ctx)
+}
+
+func (s *Store) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	row, err := s.q.GetSubscriptionByUser(ctx, userID)
+	return one(row, err, subscription)
+}
+
+func (s *Store) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	row, err := s.q.UpsertSubscription(ctx, UpsertSubscriptionParams(arg))
+	return one(row, err, subscription)
+}
+
+func (s *Store) CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) (database.UserIdentity, error) {
+	row, err := s.q.CreateUserIdentity(ctx, CreateUserIdentityParams(arg))
+	return one(row, err, userIdentity)
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, arg database.GetUserIdentityParams) (database.UserIdentity, error) {
+	row, err := s.q.GetUserIdentity(ctx, GetUserIdentityParams(arg))
+	return one(row, err, userIdentity)
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	row, err := s.q.CreateUser(ctx, CreateUserParams(arg))
+	return one(row, err, user)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	row, err := s.q.GetUserByEmail(ctx, email)
+	return one(row, err, user)
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	row, err := s.q.GetUserById(ctx, id)
+	return one(row, err, user)
+}
+
+func (s *Store) IncrementAllUserTokenVersions(ctx context.Context) (int64, error) {
+	return s.q.IncrementAllUserTokenVersions(ctx)
+}
+
+func (s *Store) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	return s.q.IncrementUserTokenVersion(ctx, id)
+}
+
+func (s *Store) ResetUsers(ctx context.Context) error {
+	return s.q.ResetUsers(ctx)
+}
+
+func (s *Store) SetUserBanned(ctx context.Context, arg database.SetUserBannedParams) (database.User, error) {
+	row, err := s.q.SetUserBanned(ctx, SetUserBannedParams(arg))
+	return one(row, err, user)
+}
+
+func (s *Store) UpdateUserById(ctx context.Context, arg database.UpdateUserByIdParams) (database.User, error) {
+	row, err := s.q.UpdateUserById(ctx, UpdateUserByIdParams(arg))
+	return one(row, err, user)
+}
+
+func (s *Store) UpdateUserPasswordHash(ctx context.Context, arg database.UpdateUserPasswordHashParams) error {
+	return s.q.UpdateUserPasswordHash(ctx, UpdateUserPasswordHashParams(arg))
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (database.User, error) {
+	row, err := s.q.UpdateUserRole(ctx, UpdateUserRoleParams(arg))
+	return one(row, err, user)
+}
+
+func (s *Store) ClaimDueWebhookDeliveries(ctx context.Context, arg database.ClaimDueWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	rows, err := s.q.ClaimDueWebhookDeliveries(ctx, ClaimDueWebhookDeliveriesParams{
+		LeaseUntil:    arg.LeaseUntil,
+		MaxDeliveries: int64(arg.MaxDeliveries),
+	})
+	return many(rows, err, webhookDelivery)
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	row, err := s.q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams(arg))
+	return one(row, err, webhookDelivery)
+}
+
+func (s *Store) FinishWebhookDeliveryAttempt(ctx context.Context, arg database.FinishWebhookDeliveryAttemptParams) (database.WebhookDelivery, error) {
+	row, err := s.q.FinishWebhookDeliveryAttempt(ctx, FinishWebhookDeliveryAttemptParams{
+		Status:         arg.Status,
+		NextAttemptAt:  arg.NextAttemptAt,
+		ResponseStatus: arg.ResponseStatus,
+		LastError:      arg.LastError,
+		ID:             arg.ID,
+	})
+	return one(row, err, webhookDelivery)
+}
+
+func (s *Store) GetWebhookDeliveriesByEndpoint(ctx context.Context, arg database.GetWebhookDeliveriesByEndpointParams) ([]database.WebhookDelivery, error) {
+	rows, err := s.q.GetWebhookDeliveriesByEndpoint(ctx, GetWebhookDeliveriesByEndpointParams{
+		EndpointID: arg.EndpointID,
+		Limit:      int64(arg.Limit),
+	})
+	return many(rows, err, webhookDelivery)
+}
+
+func (s *Store) GetWebhookDeliveryById(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	row, err := s.q.GetWebhookDeliveryById(ctx, id)
+	return one(row, err, webhookDelivery)
+}
+
+func (s *Store) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	row, err := s.q.RedeliverWebhookDelivery(ctx, id)
+	return one(row, err, webhookDelivery)
+}
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	row, err := s.q.CreateWebhookEndpoint(ctx, CreateWebhookEndpointParams{
+		UserID:     arg.UserID,
+		Url:        arg.Url,
+		Secret:     arg.Secret,
+		EventTypes: arg.EventTypes,
+	})
+	return one(row, err, webhookEndpoint)
+}
+
+func (s *Store) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	return s.q.DeleteWebhookEndpoint(ctx, DeleteWebhookEndpointParams(arg))
+}
+
+func (s *Store) EnableWebhookEndpoint(ctx context.Context, arg database.EnableWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	row, err := s.q.EnableWebhookEndpoint(ctx, EnableWebhookEndpointParams(arg))
+	return one(row, err, webhookEndpoint)
+}
+
+func (s *Store) GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	row, err := s.q.GetWebhookEndpointById(ctx, id)
+	return one(row, err, webhookEndpoint)
+}
+
+func (s *Store) GetWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	rows, err := s.q.GetWebhookEndpointsByUser(ctx, userID)
+	return many(rows, err, webhookEndpoint)
+}
+
+func (s *Store) GetWebhookEndpointsForEvent(ctx context.Context, arg database.GetWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error) {
+	rows, err := s.q.GetWebhookEndpointsForEvent(ctx, GetWebhookEndpointsForEventParams(arg))
+	return many(rows, err, webhookEndpoint)
+}
+
+func (s *Store) RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error) {
+	row, err := s.q.RecordWebhookEndpointFailure(ctx, RecordWebhookEndpointFailureParams{
+		DisableAfter: int64(arg.DisableAfter),
+		ID:           arg.ID,
+	})
+	return one(row, err, webhookEndpoint)
+}
+
+func (s *Store) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	return s.q.RecordWebhookEndpointSuccess(ctx, id)
+}
+
+func (s *Store) ClaimWebhookEvent(ctx context.Context, arg database.ClaimWebhookEventParams) (database.WebhookEvent, error) {
+	row, err := s.q.ClaimWebhookEvent(ctx, ClaimWebhookEventParams{
+		ID:          arg.ID,
+		AnyOutcome:  arg.AnyOutcome,
+		StaleBefore: sql.NullTime{Time: arg.StaleBefore, Valid: true},
+	})
+	return one(row, err, webhookEvent)
+}
+
+func (s *Store) ReleaseWebhookEvent(ctx context.Context, id uuid.UUID) error {
+	return s.q.ReleaseWebhookEvent(ctx, id)
+}
+
+func (s *Store) FinishWebhookEvent(ctx context.Context, arg database.FinishWebhookEventParams) (database.WebhookEvent, error) {
+	row, err := s.q.FinishWebhookEvent(ctx, FinishWebhookEventParams{Outcome: arg.Outcome, Error: arg.Error, ID: arg.ID})
+	return one(row, err, webhookEvent)
+}
+
+func (s *Store) GetWebhookEventById(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	row, err := s.q.GetWebhookEventById(ctx, id)
+	return one(row, err, webhookEvent)
+}
+
+func (s *Store) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	rows, err := s.q.ListWebhookEvents(ctx, ListWebhookEventsParams{
+		Provider: arg.Provider,
+		Outcome:  sql.NullString{String: string(arg.Outcome.WebhookEventOutcome), Valid: arg.Outcome.Valid},
+		Offset:   int64(arg.Offset),
+		Limit:    int64(arg.Limit),
+	})
+	return many(rows, err, webhookEvent)
+}
+
+func (s *Store) RecordWebhookEvent(ctx context.Context, arg database.RecordWebhookEventParams) (database.WebhookEvent, error) {
+	row, err := s.q.RecordWebhookEvent(ctx, RecordWebhookEventParams(arg))
+	return one(row, err, webhookEvent)
+}
+
+func (s *Store) RetryWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	row, err := s.q.RetryWebhookEvent(ctx, id)
+	return one(row, err, webhookEvent)
+}
@@ -0,0 +1,228 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: users.sql
+
+package sqlite
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (email, hashed_password)
+VALUES (?, ?)
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+`
+
+type CreateUserParams struct {
+	Email          string
+	HashedPassword string
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+FROM users
+WHERE email = ?
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const getUserById = `-- name: GetUserById :one
+SELECT id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+FROM users
+WHERE id = ?
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const incrementAllUserTokenVersions = `-- name: IncrementAllUserTokenVersions :execrows
+UPDATE users
+SET token_version = token_version + 1
+`
+
+func (q *Queries) IncrementAllUserTokenVersions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, incrementAllUserTokenVersions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = ?
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const resetUsers = `-- name: ResetUsers :exec
+DELETE FROM users
+`
+
+func (q *Queries) ResetUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetUsers)
+	return err
+}
+
+const setUserBanned = `-- name: SetUserBanned :one
+UPDATE users
+SET
+    banned_at = CASE
+        WHEN CAST(?1 AS BOOLEAN) THEN coalesce(banned_at, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+    END,
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?2
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+`
+
+type SetUserBannedParams struct {
+	Banned bool
+	ID     uuid.UUID
+}
+
+func (q *Queries) SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserBanned, arg.Banned, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const updateUserById = `-- name: UpdateUserById :one
+UPDATE users
+SET
+    email = ?,
+    hashed_password = ?,
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+`
+
+type UpdateUserByIdParams struct {
+	Email          string
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserById(ctx context.Context, arg UpdateUserByIdParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserById, arg.Email, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const updateUserPasswordHash = `-- name: UpdateUserPasswordHash :exec
+UPDATE users
+SET hashed_password = ?
+WHERE id = ?
+`
+
+type UpdateUserPasswordHashParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPasswordHash, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+`
+
+type UpdateUserRoleParams struct {
+	Role database.UserRole
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,268 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_deliveries.sql
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+const claimDueWebhookDeliveries = `-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET
+    next_attempt_at = ?1,
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id IN (
+    SELECT d.id
+    FROM webhook_deliveries AS d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ORDER BY d.next_attempt_at ASC
+    LIMIT CAST(?2 AS INTEGER)
+)
+RETURNING id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+`
+
+type ClaimDueWebhookDeliveriesParams struct {
+	LeaseUntil    time.Time
+	MaxDeliveries int64
+}
+
+// Pushes next_attempt_at out to lease_until so other workers skip the
+// deliveries while they are being attempted, SQLite has one writer at a time
+// so there is no row locking to do
+func (q *Queries) ClaimDueWebhookDeliveries(ctx context.Context, arg ClaimDueWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueWebhookDeliveries, arg.LeaseUntil, arg.MaxDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.ResponseStatus,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+VALUES (?, ?, ?, ?)
+RETURNING id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+`
+
+type CreateWebhookDeliveryParams struct {
+	EndpointID uuid.UUID
+	EventID    uuid.UUID
+	EventType  string
+	Payload    string
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDelivery,
+		arg.EndpointID,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.ResponseStatus,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const finishWebhookDeliveryAttempt = `-- name: FinishWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    status = ?1,
+    attempts = attempts + 1,
+    next_attempt_at = ?2,
+    last_attempt_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    response_status = ?3,
+    last_error = ?4
+WHERE id = ?5
+RETURNING id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+`
+
+type FinishWebhookDeliveryAttemptParams struct {
+	Status         database.WebhookDeliveryStatus
+	NextAttemptAt  time.Time
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+	ID             uuid.UUID
+}
+
+func (q *Queries) FinishWebhookDeliveryAttempt(ctx context.Context, arg FinishWebhookDeliveryAttemptParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, finishWebhookDeliveryAttempt,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.ResponseStatus,
+		arg.LastError,
+		arg.ID,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.ResponseStatus,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const getWebhookDeliveriesByEndpoint = `-- name: GetWebhookDeliveriesByEndpoint :many
+SELECT id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+FROM webhook_deliveries
+WHERE endpoint_id = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT ?
+`
+
+type GetWebhookDeliveriesByEndpointParams struct {
+	EndpointID uuid.UUID
+	Limit      int64
+}
+
+func (q *Queries) GetWebhookDeliveriesByEndpoint(ctx context.Context, arg GetWebhookDeliveriesByEndpointParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookDeliveriesByEndpoint, arg.EndpointID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.ResponseStatus,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDeliveryById = `-- name: GetWebhookDeliveryById :one
+SELECT id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+FROM webhook_deliveries
+WHERE id = ?
+`
+
+func (q *Queries) GetWebhookDeliveryById(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDeliveryById, id)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.ResponseStatus,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const redeliverWebhookDelivery = `-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', next_attempt_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error
+`
+
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, redeliverWebhookDelivery, id)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.ResponseStatus,
+		&i.LastError,
+	)
+	return i, err
+}
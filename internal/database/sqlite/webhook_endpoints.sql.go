@@ -0,0 +1,269 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_endpoints.sql
+
+package sqlite
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createWebhookEndpoint = `-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (user_id, url, secret, event_types)
+VALUES (?, ?, ?, ?)
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type CreateWebhookEndpointParams struct {
+	UserID     uuid.UUID
+	Url        string
+	Secret     string
+	EventTypes Strings
+}
+
+func (q *Queries) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEndpoint,
+		arg.UserID,
+		arg.Url,
+		arg.Secret,
+		arg.EventTypes,
+	)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.EventTypes,
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const deleteWebhookEndpoint = `-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = ? AND user_id = ?
+`
+
+type DeleteWebhookEndpointParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteWebhookEndpoint(ctx context.Context, arg DeleteWebhookEndpointParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhookEndpoint, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enableWebhookEndpoint = `-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    enabled = true,
+    consecutive_failures = 0,
+    disabled_at = NULL
+WHERE id = ? AND user_id = ?
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type EnableWebhookEndpointParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) EnableWebhookEndpoint(ctx context.Context, arg EnableWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, enableWebhookEndpoint, arg.ID, arg.UserID)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.EventTypes,
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getWebhookEndpointById = `-- name: GetWebhookEndpointById :one
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE id = ?
+`
+
+func (q *Queries) GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEndpointById, id)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.EventTypes,
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getWebhookEndpointsByUser = `-- name: GetWebhookEndpointsByUser :many
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE user_id = ?
+ORDER BY created_at ASC, rowid ASC
+`
+
+func (q *Queries) GetWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEndpointsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			&i.EventTypes,
+			&i.Enabled,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookEndpointsForEvent = `-- name: GetWebhookEndpointsForEvent :many
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE
+    user_id = ?1
+    AND enabled
+    AND EXISTS (
+        SELECT 1
+        FROM json_each(webhook_endpoints.event_types)
+        WHERE json_each.value = CAST(?2 AS TEXT)
+    )
+`
+
+type GetWebhookEndpointsForEventParams struct {
+	UserID    uuid.UUID
+	EventType string
+}
+
+func (q *Queries) GetWebhookEndpointsForEvent(ctx context.Context, arg GetWebhookEndpointsForEventParams) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEndpointsForEvent, arg.UserID, arg.EventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			&i.EventTypes,
+			&i.Enabled,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookEndpointFailure = `-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+SET
+    consecutive_failures = consecutive_failures + 1,
+    enabled = enabled
+    AND consecutive_failures + 1 < CAST(?1 AS INTEGER),
+    disabled_at = CASE
+        WHEN
+            enabled
+            AND consecutive_failures + 1
+            >= CAST(?1 AS INTEGER)
+            THEN strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+        ELSE disabled_at
+    END
+WHERE id = ?2
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type RecordWebhookEndpointFailureParams struct {
+	DisableAfter int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) RecordWebhookEndpointFailure(ctx context.Context, arg RecordWebhookEndpointFailureParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookEndpointFailure, arg.DisableAfter, arg.ID)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.EventTypes,
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const recordWebhookEndpointSuccess = `-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = ?
+`
+
+func (q *Queries) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookEndpointSuccess, id)
+	return err
+}
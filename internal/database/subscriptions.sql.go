@@ -0,0 +1,137 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const expireLapsedSubscriptions = `-- name: ExpireLapsedSubscriptions :many
+UPDATE subscriptions
+SET status = 'expired', updated_at = now()
+WHERE status <> 'expired' AND access_until <= now()
+RETURNING user_id
+`
+
+func (q *Queries) ExpireLapsedSubscriptions(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, expireLapsedSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubscriptionByUser = `-- name: GetSubscriptionByUser :one
+SELECT id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end, grace_period_end, canceled_at, access_until
+FROM subscriptions
+WHERE user_id = $1
+`
+
+func (q *Queries) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscriptionByUser, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.GracePeriodEnd,
+		&i.CanceledAt,
+		&i.AccessUntil,
+	)
+	return i, err
+}
+
+const upsertSubscription = `-- name: UpsertSubscription :one
+INSERT INTO subscriptions (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    plan,
+    status,
+    current_period_start,
+    current_period_end,
+    grace_period_end,
+    canceled_at,
+    access_until
+) VALUES (
+    gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5, $6, $7, $8
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    updated_at = now(),
+    plan = excluded.plan,
+    status = excluded.status,
+    current_period_start = excluded.current_period_start,
+    current_period_end = excluded.current_period_end,
+    grace_period_end = excluded.grace_period_end,
+    canceled_at = excluded.canceled_at,
+    access_until = excluded.access_until
+RETURNING id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end, grace_period_end, canceled_at, access_until
+`
+
+type UpsertSubscriptionParams struct {
+	UserID             uuid.UUID
+	Plan               string
+	Status             SubscriptionStatus
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	GracePeriodEnd     sql.NullTime
+	CanceledAt         sql.NullTime
+	AccessUntil        time.Time
+}
+
+func (q *Queries) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertSubscription,
+		arg.UserID,
+		arg.Plan,
+		arg.Status,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+		arg.GracePeriodEnd,
+		arg.CanceledAt,
+		arg.AccessUntil,
+	)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.GracePeriodEnd,
+		&i.CanceledAt,
+		&i.AccessUntil,
+	)
+	return i, err
+}
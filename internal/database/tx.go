@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultTxAttempts is how many times a transaction is run before its
+// serialization failure is returned
+const DefaultTxAttempts = 3
+
+// Transactor runs fn in a transaction, committing when fn returns nil and
+// rolling back otherwise. fn may run more than once so it must only have
+// effects through q.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(q Querier) error) error
+}
+
+// TxRunner is a Transactor on a database/sql pool
+type TxRunner struct {
+	DB   *sql.DB
+	Opts sql.TxOptions
+	// NewQuerier runs the queries on the transaction, it is where the
+	// transaction is traced
+	NewQuerier func(tx DBTX) Querier
+	// Retryable reports errors the database aborted the transaction with that
+	// are worth running it again for
+	Retryable func(err error) bool
+	Attempts  int
+}
+
+// NewTxRunner runs serializable Postgres transactions on db, retrying them on
+// serialization failures and deadlocks
+func NewTxRunner(db *sql.DB, newQuerier func(tx DBTX) Querier) *TxRunner {
+	return &TxRunner{
+		DB:         db,
+		Opts:       sql.TxOptions{Isolation: sql.LevelSerializable},
+		NewQuerier: newQuerier,
+		Retryable:  IsSerializationFailure,
+		Attempts:   DefaultTxAttempts,
+	}
+}
+
+func (r *TxRunner) InTx(ctx context.Context, fn func(q Querier) error) error {
+	var err error
+	for attempt := range max(r.Attempts, 1) {
+		if attempt > 0 {
+			// Back off a little so the conflicting transaction can finish
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(time.Millisecond * 10 * time.Duration(attempt)):
+			}
+		}
+		err = r.run(ctx, fn)
+		if err == nil || r.Retryable == nil || !r.Retryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", max(r.Attempts, 1), err)
+}
+
+func (r *TxRunner) run(ctx context.Context, fn func(q Querier) error) error {
+	tx, err := r.DB.BeginTx(ctx, &r.Opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(r.NewQuerier(tx)); err != nil {
+		return errors.Join(err, ignoreDone(tx.Rollback()))
+	}
+	return tx.Commit()
+}
+
+// ignoreDone drops the error from rolling back a transaction the database
+// already ended, like after a serialization failure
+func ignoreDone(err error) error {
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// IsSerializationFailure reports whether Postgres aborted a transaction so it
+// could be serialized with another
+func IsSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
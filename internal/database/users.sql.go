@@ -17,10 +17,9 @@ INSERT INTO users (
     created_at,
     updated_at,
     email,
-    hashed_password,
-    is_chirpy_red
-) VALUES (gen_random_uuid(), now(), now(), $1, $2, false)
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+    hashed_password
+) VALUES (gen_random_uuid(), now(), now(), $1, $2)
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
 `
 
 type CreateUserParams struct {
@@ -37,13 +36,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red
+SELECT id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
 FROM users
 WHERE email = $1
 `
@@ -57,13 +58,15 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red
+SELECT id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
 FROM users
 WHERE id = $1
 `
@@ -77,11 +80,40 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
 
+const incrementAllUserTokenVersions = `-- name: IncrementAllUserTokenVersions :execrows
+UPDATE users
+SET token_version = token_version + 1
+`
+
+func (q *Queries) IncrementAllUserTokenVersions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, incrementAllUserTokenVersions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const resetUsers = `-- name: ResetUsers :exec
 DELETE FROM users
 `
@@ -91,11 +123,43 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
+const setUserBanned = `-- name: SetUserBanned :one
+UPDATE users
+SET
+    banned_at = CASE
+        WHEN $1::BOOLEAN THEN coalesce(banned_at, now())
+    END,
+    updated_at = now()
+WHERE id = $2
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
+`
+
+type SetUserBannedParams struct {
+	Banned bool
+	ID     uuid.UUID
+}
+
+func (q *Queries) SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserBanned, arg.Banned, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
 const updateUserById = `-- name: UpdateUserById :one
 UPDATE users
 SET email = $1, hashed_password = $2, updated_at = now()
 WHERE id = $3
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
 `
 
 type UpdateUserByIdParams struct {
@@ -113,20 +177,43 @@ func (q *Queries) UpdateUserById(ctx context.Context, arg UpdateUserByIdParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
 
-const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
+const updateUserPasswordHash = `-- name: UpdateUserPasswordHash :exec
 UPDATE users
-SET is_chirpy_red = true
-WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+SET hashed_password = $1
+WHERE id = $2
+`
+
+type UpdateUserPasswordHashParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPasswordHash, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $1, updated_at = now()
+WHERE id = $2
+RETURNING id, email, created_at, updated_at, hashed_password, role, token_version, banned_at
 `
 
-func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUserToChirpyRed, id)
+type UpdateUserRoleParams struct {
+	Role UserRole
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Role, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -134,7 +221,9 @@ func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (Use
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.BannedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,272 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_endpoints.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createWebhookEndpoint = `-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    url,
+    secret,
+    event_types
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4)
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type CreateWebhookEndpointParams struct {
+	UserID     uuid.UUID
+	Url        string
+	Secret     string
+	EventTypes []string
+}
+
+func (q *Queries) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEndpoint,
+		arg.UserID,
+		arg.Url,
+		arg.Secret,
+		pq.Array(arg.EventTypes),
+	)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.EventTypes),
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const deleteWebhookEndpoint = `-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebhookEndpointParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteWebhookEndpoint(ctx context.Context, arg DeleteWebhookEndpointParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhookEndpoint, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enableWebhookEndpoint = `-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET
+    updated_at = now(),
+    enabled = true,
+    consecutive_failures = 0,
+    disabled_at = NULL
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type EnableWebhookEndpointParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) EnableWebhookEndpoint(ctx context.Context, arg EnableWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, enableWebhookEndpoint, arg.ID, arg.UserID)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.EventTypes),
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getWebhookEndpointById = `-- name: GetWebhookEndpointById :one
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEndpointById, id)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.EventTypes),
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getWebhookEndpointsByUser = `-- name: GetWebhookEndpointsByUser :many
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetWebhookEndpointsByUser(ctx context.Context, userID uuid.UUID) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEndpointsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			pq.Array(&i.EventTypes),
+			&i.Enabled,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookEndpointsForEvent = `-- name: GetWebhookEndpointsForEvent :many
+SELECT id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+FROM webhook_endpoints
+WHERE
+    user_id = $1
+    AND enabled
+    AND $2::TEXT = ANY(event_types)
+`
+
+type GetWebhookEndpointsForEventParams struct {
+	UserID    uuid.UUID
+	EventType string
+}
+
+func (q *Queries) GetWebhookEndpointsForEvent(ctx context.Context, arg GetWebhookEndpointsForEventParams) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEndpointsForEvent, arg.UserID, arg.EventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			pq.Array(&i.EventTypes),
+			&i.Enabled,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookEndpointFailure = `-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+SET
+    consecutive_failures = consecutive_failures + 1,
+    enabled = enabled
+    AND consecutive_failures + 1 < $2::INTEGER,
+    disabled_at = CASE
+        WHEN
+            enabled
+            AND consecutive_failures + 1 >= $2::INTEGER
+            THEN now()
+        ELSE disabled_at
+    END
+WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, url, secret, event_types, enabled, consecutive_failures, disabled_at
+`
+
+type RecordWebhookEndpointFailureParams struct {
+	ID           uuid.UUID
+	DisableAfter int32
+}
+
+func (q *Queries) RecordWebhookEndpointFailure(ctx context.Context, arg RecordWebhookEndpointFailureParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookEndpointFailure, arg.ID, arg.DisableAfter)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.EventTypes),
+		&i.Enabled,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const recordWebhookEndpointSuccess = `-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = $1
+`
+
+func (q *Queries) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookEndpointSuccess, id)
+	return err
+}
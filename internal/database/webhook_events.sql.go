@@ -0,0 +1,255 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimWebhookEvent = `-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+SET claimed_at = now()
+WHERE
+    id = $1
+    AND (
+        $2::BOOLEAN
+        OR outcome IN ('pending', 'failed', 'invalid')
+    )
+    AND (
+        claimed_at IS NULL
+        OR claimed_at < $3::TIMESTAMP
+    )
+RETURNING id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+`
+
+type ClaimWebhookEventParams struct {
+	ID          uuid.UUID
+	AnyOutcome  bool
+	StaleBefore time.Time
+}
+
+func (q *Queries) ClaimWebhookEvent(ctx context.Context, arg ClaimWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimWebhookEvent, arg.ID, arg.AnyOutcome, arg.StaleBefore)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Outcome,
+		&i.Error,
+		&i.Attempts,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
+const finishWebhookEvent = `-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+SET outcome = $2, error = $3, processed_at = now(), claimed_at = NULL
+WHERE id = $1
+RETURNING id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+`
+
+type FinishWebhookEventParams struct {
+	ID      uuid.UUID
+	Outcome WebhookEventOutcome
+	Error   sql.NullString
+}
+
+func (q *Queries) FinishWebhookEvent(ctx context.Context, arg FinishWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, finishWebhookEvent, arg.ID, arg.Outcome, arg.Error)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Outcome,
+		&i.Error,
+		&i.Attempts,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
+const getWebhookEventById = `-- name: GetWebhookEventById :one
+SELECT id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+FROM webhook_events
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookEventById(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEventById, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Outcome,
+		&i.Error,
+		&i.Attempts,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
+const listWebhookEvents = `-- name: ListWebhookEvents :many
+SELECT id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+FROM webhook_events
+WHERE
+    ($3::TEXT IS NULL OR provider = $3)
+    AND (
+        $4::WEBHOOK_EVENT_OUTCOME IS NULL
+        OR outcome = $4
+    )
+ORDER BY received_at DESC
+LIMIT $1 OFFSET $2
+`
+
+type ListWebhookEventsParams struct {
+	Limit    int32
+	Offset   int32
+	Provider sql.NullString
+	Outcome  NullWebhookEventOutcome
+}
+
+func (q *Queries) ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEvents,
+		arg.Limit,
+		arg.Offset,
+		arg.Provider,
+		arg.Outcome,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Provider,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.ReceivedAt,
+			&i.ProcessedAt,
+			&i.Outcome,
+			&i.Error,
+			&i.Attempts,
+			&i.ClaimedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookEvent = `-- name: RecordWebhookEvent :one
+INSERT INTO webhook_events (
+    id,
+    provider,
+    event_id,
+    event_type,
+    payload,
+    received_at
+) VALUES (gen_random_uuid(), $1, $2, $3, $4, now())
+ON CONFLICT (provider, event_id) DO UPDATE
+SET attempts = webhook_events.attempts + 1
+RETURNING id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+`
+
+type RecordWebhookEventParams struct {
+	Provider  string
+	EventID   string
+	EventType string
+	Payload   string
+}
+
+func (q *Queries) RecordWebhookEvent(ctx context.Context, arg RecordWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookEvent,
+		arg.Provider,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Outcome,
+		&i.Error,
+		&i.Attempts,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
+const releaseWebhookEvent = `-- name: ReleaseWebhookEvent :exec
+UPDATE webhook_events
+SET claimed_at = NULL
+WHERE id = $1
+`
+
+// Gives up a claim without recording an outcome
+func (q *Queries) ReleaseWebhookEvent(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseWebhookEvent, id)
+	return err
+}
+
+const retryWebhookEvent = `-- name: RetryWebhookEvent :one
+UPDATE webhook_events
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING id, provider, event_id, event_type, payload, received_at, processed_at, outcome, error, attempts, claimed_at
+`
+
+func (q *Queries) RetryWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, retryWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Outcome,
+		&i.Error,
+		&i.Attempts,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,104 @@
+// Package entitlements decides what each user's plan lets them do. The limits
+// for every plan are configured here so handlers enforce them the same way.
+package entitlements
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/billing"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+var (
+	// ErrRequiresChirpyRed means upgrading to Chirpy Red would allow the action
+	ErrRequiresChirpyRed = errors.New("this requires a Chirpy Red membership")
+	// ErrLimitReached means the action is over the limit of every plan
+	ErrLimitReached = errors.New("this is over the limit")
+	// ErrRateLimited means the user has to wait before trying again
+	ErrRateLimited = errors.New("too many requests")
+)
+
+// Limits are what a plan allows, a zero value disables the feature
+type Limits struct {
+	MaxChirpLength  int
+	EditWindow      time.Duration
+	MaxPinnedChirps int
+	ChirpsPerHour   int
+	ScheduledChirps bool
+}
+
+var (
+	Free = Limits{
+		MaxChirpLength:  140,
+		MaxPinnedChirps: 1,
+		ChirpsPerHour:   30,
+	}
+	ChirpyRed = Limits{
+		MaxChirpLength:  1000,
+		EditWindow:      time.Minute * 15,
+		MaxPinnedChirps: 5,
+		ChirpsPerHour:   300,
+		ScheduledChirps: true,
+	}
+)
+
+// For returns the limits of the plan the user's subscription grants at now,
+// users who never subscribed have the zero Subscription
+func For(sub database.Subscription, now time.Time) Limits {
+	if billing.HasAccess(sub, now) {
+		return ChirpyRed
+	}
+	return Free
+}
+
+// CheckChirpLength checks a chirp body of length characters
+func (l Limits) CheckChirpLength(length int) error {
+	if length <= l.MaxChirpLength {
+		return nil
+	}
+	if length <= ChirpyRed.MaxChirpLength {
+		return fmt.Errorf("%w: chirps over %d characters", ErrRequiresChirpyRed, l.MaxChirpLength)
+	}
+	return fmt.Errorf("%w: chirps can't be over %d characters", ErrLimitReached, ChirpyRed.MaxChirpLength)
+}
+
+// CheckEdit checks editing a chirp that was created at createdAt
+func (l Limits) CheckEdit(createdAt, now time.Time) error {
+	if l.EditWindow == 0 {
+		return fmt.Errorf("%w: editing chirps", ErrRequiresChirpyRed)
+	}
+	if now.Sub(createdAt) > l.EditWindow {
+		return fmt.Errorf("%w: chirps can only be edited for %v after posting", ErrLimitReached, l.EditWindow)
+	}
+	return nil
+}
+
+// CheckPin checks pinning another chirp when pinned are already pinned
+func (l Limits) CheckPin(pinned int64) error {
+	if pinned < int64(l.MaxPinnedChirps) {
+		return nil
+	}
+	if pinned < int64(ChirpyRed.MaxPinnedChirps) {
+		return fmt.Errorf("%w: pinning more than %d chirps", ErrRequiresChirpyRed, l.MaxPinnedChirps)
+	}
+	return fmt.Errorf("%w: no more than %d chirps can be pinned", ErrLimitReached, ChirpyRed.MaxPinnedChirps)
+}
+
+// CheckChirpRate checks posting another chirp when posted were posted in the
+// last hour
+func (l Limits) CheckChirpRate(posted int64) error {
+	if posted < int64(l.ChirpsPerHour) {
+		return nil
+	}
+	return fmt.Errorf("%w: no more than %d chirps can be posted an hour", ErrRateLimited, l.ChirpsPerHour)
+}
+
+// CheckSchedule checks posting a chirp that is published in the future
+func (l Limits) CheckSchedule() error {
+	if !l.ScheduledChirps {
+		return fmt.Errorf("%w: scheduling chirps", ErrRequiresChirpyRed)
+	}
+	return nil
+}
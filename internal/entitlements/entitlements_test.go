@@ -0,0 +1,50 @@
+package entitlements
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+func TestLimits(t *testing.T) {
+	now := time.Now()
+	free := For(database.Subscription{}, now)
+	red := For(database.Subscription{Status: database.SubscriptionStatusActive, AccessUntil: now.Add(time.Hour)}, now)
+	lapsed := For(database.Subscription{Status: database.SubscriptionStatusActive, AccessUntil: now.Add(-time.Hour)}, now)
+	expired := For(database.Subscription{Status: database.SubscriptionStatusExpired, AccessUntil: now.Add(time.Hour)}, now)
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{"Free short chirp", free.CheckChirpLength(140), nil},
+		{"Free long chirp", free.CheckChirpLength(141), ErrRequiresChirpyRed},
+		{"Red long chirp", red.CheckChirpLength(1000), nil},
+		{"Chirp too long for any plan", free.CheckChirpLength(1001), ErrLimitReached},
+		{"Free edit", free.CheckEdit(now, now), ErrRequiresChirpyRed},
+		{"Red edit in window", red.CheckEdit(now.Add(-time.Minute), now), nil},
+		{"Red edit after window", red.CheckEdit(now.Add(-time.Hour), now), ErrLimitReached},
+		{"Free first pin", free.CheckPin(0), nil},
+		{"Free second pin", free.CheckPin(1), ErrRequiresChirpyRed},
+		{"Red fifth pin", red.CheckPin(4), nil},
+		{"Red sixth pin", red.CheckPin(5), ErrLimitReached},
+		{"Free under rate", free.CheckChirpRate(29), nil},
+		{"Free over rate", free.CheckChirpRate(30), ErrRateLimited},
+		{"Red over free rate", red.CheckChirpRate(30), nil},
+		{"Free schedule", free.CheckSchedule(), ErrRequiresChirpyRed},
+		{"Red schedule", red.CheckSchedule(), nil},
+		{"Lapsed subscription", lapsed.CheckSchedule(), ErrRequiresChirpyRed},
+		{"Expired subscription", expired.CheckSchedule(), ErrRequiresChirpyRed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.wantErr) || (tt.wantErr == nil && tt.err != nil) {
+				t.Errorf("got error %v, want %v", tt.err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,38 +1,151 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"net/http"
 
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
 	"github.com/jlargs64/chirpy/internal/utils"
 )
 
+type changeRoleReq struct {
+	Role database.UserRole `json:"role"`
+}
+
 func (config *APIConfig) HandlerReset(w http.ResponseWriter, req *http.Request) {
 	if config.Platform != "dev" {
 		utils.RespondWithError(w, http.StatusForbidden, "not allowed in prod", errors.New("not allowed in prod"))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	// Reset users and chirps
+	err := config.Service.Reset(req.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "users and chirps could not be reset", err)
+		return
+	}
 	// Reset metrics
 	config.FileserverHits.Store(0)
-	// Reset users
-	err := config.DBQueries.ResetUsers(req.Context())
+
+	// Write message back to admin
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte(http.StatusText(http.StatusOK)))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusForbidden, "users could not be reset", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not write a response back to user", err)
 		return
 	}
+}
 
-	// Reset chirps
-	err = config.DBQueries.ResetChirps(req.Context())
+func (config *APIConfig) HandleChangeUserRole(w http.ResponseWriter, req *http.Request) {
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusForbidden, "chirps could not be reset", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "user id is not a valid uuid", err)
 		return
 	}
 
-	// Write message back to admin
-	_, err = w.Write([]byte(http.StatusText(http.StatusOK)))
+	decoder := json.NewDecoder(req.Body)
+	params := &changeRoleReq{}
+	err = decoder.Decode(params)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "could not write a response back to user", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "change role params is not in a valid format", err)
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		utils.RespondWithError(w, http.StatusBadRequest, "unknown role", errors.New("unknown role"))
+		return
+	}
+
+	updatedUser, err := config.DBQueries.UpdateUserRole(req.Context(), database.UpdateUserRoleParams{
+		Role: params.Role,
+		ID:   userUUID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "user could not be found", err)
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "error updating the user's role", err)
+		}
+		return
+	}
+
+	config.respondWithUser(w, req, http.StatusOK, updatedUser)
+}
+
+// HandleBanUser bans the user in the path, they can no longer log in and
+// their outstanding tokens stop working
+func (config *APIConfig) HandleBanUser(w http.ResponseWriter, req *http.Request) {
+	config.setUserBanned(w, req, true)
+}
+
+// HandleUnbanUser lifts a ban, the user has to log in again
+func (config *APIConfig) HandleUnbanUser(w http.ResponseWriter, req *http.Request) {
+	config.setUserBanned(w, req, false)
+}
+
+func (config *APIConfig) setUserBanned(w http.ResponseWriter, req *http.Request, banned bool) {
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "user id is not a valid uuid", err)
+		return
+	}
+	if admin, _ := auth.UserFromContext(req.Context()); banned && admin.ID == userUUID {
+		utils.RespondWithError(w, http.StatusBadRequest, "admins can't ban themselves", errors.New("self ban"))
+		return
+	}
+
+	updatedUser, err := config.DBQueries.SetUserBanned(req.Context(), database.SetUserBannedParams{
+		Banned: banned,
+		ID:     userUUID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "user could not be found", err)
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "error updating the user's ban", err)
+		}
+		return
+	}
+
+	if banned {
+		err = config.Denylist.RevokeUser(req.Context(), updatedUser.ID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "error revoking the user's tokens", err)
+			return
+		}
+	}
+	config.respondWithUser(w, req, http.StatusOK, updatedUser)
+}
+
+type unlockLoginReq struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+// HandleUnlockLogin clears failed logins and lockouts for an email and or IP
+func (config *APIConfig) HandleUnlockLogin(w http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	params := &unlockLoginReq{}
+	err := decoder.Decode(params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "unlock params is not in a valid format", err)
+		return
+	}
+	if params.Email == "" && params.IP == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "an email or ip is required", errors.New("an email or ip is required"))
+		return
+	}
+
+	unlocked, err := config.LoginThrottle.Unlock(req.Context(), params.Email, params.IP)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not unlock logins", err)
+		return
+	}
+	if !unlocked {
+		utils.RespondWithError(w, http.StatusNotFound, "there are no failed logins to clear", errors.New("nothing to unlock"))
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
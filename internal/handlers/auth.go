@@ -9,23 +9,30 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/billing"
 	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/metrics"
 	"github.com/jlargs64/chirpy/internal/utils"
 )
 
 type loginReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// UseCookies stores the tokens in HttpOnly cookies for the web app
+	UseCookies bool `json:"use_cookies"`
 }
 
 type loginResp struct {
 	ID           uuid.UUID `json:"id"`
 	Email        string    `json:"email"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 	Updatedat    time.Time `json:"updated_at"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	CSRFToken    string    `json:"csrf_token,omitempty"`
 }
 
 type refreshResp struct {
@@ -47,57 +54,131 @@ func (config *APIConfig) HandleLogin(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Refuse locked out accounts and clients before doing any password work
+	clientIP := auth.ClientIP(req)
+	retryAfter, err := config.LoginThrottle.RetryAfter(req.Context(), loginReq.Email, clientIP)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not check for login lockouts", err)
+		return
+	}
+	if retryAfter > 0 {
+		config.Metrics.LoginAttempt(metrics.LoginPassword, metrics.LoginLocked)
+		respondWithLockout(w, retryAfter)
+		return
+	}
+
 	user, err := config.DBQueries.GetUserByEmail(req.Context(), loginReq.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "there was a problem getting the user with that email", err)
+		return
+	}
+
+	// Unknown emails still pay for a password check so they can't be told apart
+	// from wrong passwords by timing
+	var ok bool
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.RespondWithError(w, http.StatusUnauthorized, notAuthMsg, errors.New(notAuthMsg))
-		} else {
-			utils.RespondWithError(w, http.StatusInternalServerError, "there was a problem getting the user with that email", err)
+		auth.CheckDummyPassword(loginReq.Password)
+	} else {
+		ok, _ = auth.CheckPasswordHash(loginReq.Password, user.HashedPassword)
+	}
+	if !ok {
+		config.Metrics.LoginAttempt(metrics.LoginPassword, metrics.LoginFailure)
+		lockout, err := config.LoginThrottle.RecordFailure(req.Context(), loginReq.Email, clientIP)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not record the failed login", err)
+			return
+		}
+		if lockout > 0 {
+			respondWithLockout(w, lockout)
+			return
 		}
+		utils.RespondWithError(w, http.StatusUnauthorized, notAuthMsg, errors.New(notAuthMsg))
 		return
 	}
 
-	if ok, err := auth.CheckPasswordHash(loginReq.Password, user.HashedPassword); !ok {
-		utils.RespondWithError(w, http.StatusUnauthorized, notAuthMsg, err)
+	err = config.LoginThrottle.RecordSuccess(req.Context(), loginReq.Email)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not reset failed logins", err)
 		return
 	}
-	// Create refrsh token
-	refreshToken, err := auth.MakeRefreshToken()
+	config.Metrics.LoginAttempt(metrics.LoginPassword, metrics.LoginSuccess)
+	config.rehashPassword(req, user, loginReq.Password)
+	config.respondWithLogin(w, req, user, loginReq.UseCookies)
+}
+
+// rehashPassword upgrades hashes made with weaker parameters while the plain
+// password is at hand, failures only delay the upgrade to the next login
+func (config *APIConfig) rehashPassword(req *http.Request, user database.User, password string) {
+	needsRehash, err := auth.NeedsRehash(user.HashedPassword)
+	if err != nil || !needsRehash {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(password)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "the refresh token could not be generated", err)
+		logging.FromContext(req.Context()).Error("could not rehash password", "error", err)
 		return
 	}
-	dbRefreshToken, err := config.DBQueries.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+	err = config.DBQueries.UpdateUserPasswordHash(req.Context(), database.UpdateUserPasswordHashParams{
+		HashedPassword: hashedPassword,
+		ID:             user.ID,
 	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "the refresh token could not be saved to the database", err)
-		return
+		logging.FromContext(req.Context()).Error("could not save rehashed password", "error", err)
 	}
+}
 
-	// Create access token
-	expirationDuration := time.Hour * 1
-	token, err := auth.MakeJWT(user.ID, string(config.SigningKey), expirationDuration)
+func respondWithLockout(w http.ResponseWriter, lockout time.Duration) {
+	w.Header().Set("Retry-After", auth.RetryAfterSeconds(lockout))
+	utils.RespondWithError(w, http.StatusTooManyRequests, "too many failed logins, try again later", errors.New("login locked out"))
+}
+
+// respondWithLogin issues a new refresh and access token pair for user, in the
+// body or as session cookies with a CSRF token
+func (config *APIConfig) respondWithLogin(w http.ResponseWriter, req *http.Request, user database.User, useCookies bool) {
+	sub, err := config.subscription(req.Context(), user.ID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "the jwt could not be generated", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the user's subscription", err)
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, &loginResp{
+	session, err := config.Service.Login(req.Context(), user)
+	if errors.Is(err, auth.ErrUserBanned) {
+		utils.RespondWithError(w, http.StatusForbidden, err.Error(), err)
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the user could not be logged in", err)
+		return
+	}
+	resp := &loginResp{
 		ID:           user.ID,
 		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
+		IsChirpyRed:  billing.HasAccess(sub, time.Now().UTC()),
+		Role:         string(user.Role),
 		CreatedAt:    user.CreatedAt,
 		Updatedat:    user.UpdatedAt,
-		Token:        token,
-		RefreshToken: dbRefreshToken.Token,
-	})
+		Token:        session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}
+	if useCookies {
+		csrfToken, err := auth.MakeCSRFToken(user.ID, config.SigningKey)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "the csrf token could not be generated", err)
+			return
+		}
+		auth.SetSessionCookies(w, session.AccessToken, session.RefreshToken, csrfToken, config.secureCookies())
+		resp.Token, resp.RefreshToken, resp.CSRFToken = "", "", csrfToken
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// secureCookies is false in dev so cookies work over plain http on localhost
+func (config *APIConfig) secureCookies() bool {
+	return config.Platform != "dev"
 }
 
 func (config *APIConfig) HandleRefreshToken(w http.ResponseWriter, req *http.Request) {
-	// Get bearer from header
-	bearerToken, err := auth.GetBearerToken(req.Header)
+	// Get bearer from header or the session cookie
+	bearerToken, fromCookie, err := auth.RefreshTokenFromRequest(req)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusUnauthorized, "the token was not found or was expired", err)
 		return
@@ -109,35 +190,72 @@ func (config *APIConfig) HandleRefreshToken(w http.ResponseWriter, req *http.Req
 		return
 	}
 
-	// Check if refresh token is expired or revoked
+	// Check if refresh token is expired or revoked, tokens issued to OAuth
+	// clients must be refreshed through the OAuth token endpoint
 	utcNow := time.Now().UTC()
-	if res.ExpiresAt.UTC().Before(utcNow) || res.RevokedAt.Valid {
+	if res.ExpiresAt.UTC().Before(utcNow) || res.RevokedAt.Valid || res.ClientID.Valid {
 		utils.RespondWithError(w, http.StatusUnauthorized, "the token was not found or was expired", err)
 		return
 	}
+	if res.BannedAt.Valid {
+		utils.RespondWithError(w, http.StatusForbidden, auth.ErrUserBanned.Error(), auth.ErrUserBanned)
+		return
+	}
+	if fromCookie {
+		if err := auth.CheckCSRF(req, res.UserID, config.SigningKey); err != nil {
+			utils.RespondWithError(w, http.StatusForbidden, "the csrf token is missing or invalid", err)
+			return
+		}
+	}
 
 	// Generate new access token
-	accessToken, err := auth.MakeJWT(res.UserID, string(config.SigningKey), time.Hour*1)
+	accessToken, err := auth.MakeJWT(res.UserID, res.TokenVersion, string(config.SigningKey), auth.AccessTokenExpiry)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "could not get refresh access token", err)
 		return
 	}
+	if fromCookie {
+		auth.SetAccessTokenCookie(w, accessToken, config.secureCookies())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	utils.RespondWithJSON(w, http.StatusOK, &refreshResp{
 		Token: accessToken,
 	})
 }
 
 func (config *APIConfig) HandleRefreshRevoke(w http.ResponseWriter, req *http.Request) {
-	bearerToken, err := auth.GetBearerToken(req.Header)
+	bearerToken, fromCookie, err := auth.RefreshTokenFromRequest(req)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusUnauthorized, "the token was not found or was expired", err)
 		return
 	}
+	if fromCookie {
+		res, err := config.DBQueries.GetUserFromRefreshToken(req.Context(), bearerToken)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "the token was not found or was expired", err)
+			return
+		}
+		if err := auth.CheckCSRF(req, res.UserID, config.SigningKey); err != nil {
+			utils.RespondWithError(w, http.StatusForbidden, "the csrf token is missing or invalid", err)
+			return
+		}
+	}
 
-	_, err = config.DBQueries.RevokeRefreshToken(req.Context(), bearerToken)
+	refreshToken, err := config.DBQueries.RevokeRefreshToken(req.Context(), bearerToken)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "could not revoke token in the db", err)
 		return
 	}
+
+	// Revoke outstanding access tokens, other sessions can refresh theirs
+	err = config.Denylist.RevokeUser(req.Context(), refreshToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not revoke access tokens", err)
+		return
+	}
+	if fromCookie {
+		auth.ClearSessionCookies(w, config.secureCookies())
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
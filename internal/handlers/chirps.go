@@ -1,30 +1,81 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/jlargs64/chirpy/internal/auth"
 	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/entitlements"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/service"
 	"github.com/jlargs64/chirpy/internal/utils"
+	"github.com/jlargs64/chirpy/internal/webhooks"
 )
 
 type createChirpRequest struct {
 	Body   string    `json:"body"`
 	UserID uuid.UUID `json:"user_id"`
+	// PublishAt schedules the chirp, Chirpy Red only
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type editChirpRequest struct {
+	Body string `json:"body"`
 }
 
 type chirpResponse struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
 	Body      string    `json:"body"`
+	Pinned    bool      `json:"pinned"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	PublishAt time.Time `json:"publish_at"`
+}
+
+func toChirpResponse(chirp database.Chirp) *chirpResponse {
+	return &chirpResponse{
+		ID:        chirp.ID,
+		UserID:    chirp.UserID,
+		Body:      chirp.Body,
+		Pinned:    chirp.PinnedAt.Valid,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		PublishAt: chirp.PublishAt,
+	}
+}
+
+// limits returns the limits of the plan the user's subscription grants
+func (config *APIConfig) limits(w http.ResponseWriter, req *http.Request, userID uuid.UUID) (entitlements.Limits, bool) {
+	sub, err := config.subscription(req.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the user's subscription", err)
+		return entitlements.Limits{}, false
+	}
+	return entitlements.For(sub, time.Now().UTC()), true
+}
+
+// respondWithEntitlementError tells non-members what upgrading would unlock
+// and everyone else which limit they hit
+func respondWithEntitlementError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, entitlements.ErrRequiresChirpyRed):
+		utils.RespondWithError(w, http.StatusPaymentRequired, err.Error(), err)
+	case errors.Is(err, entitlements.ErrRateLimited):
+		w.Header().Set("Retry-After", "3600")
+		utils.RespondWithError(w, http.StatusTooManyRequests, err.Error(), err)
+	default:
+		utils.RespondWithError(w, http.StatusForbidden, err.Error(), err)
+	}
 }
 
 func (config *APIConfig) HandleGetChirps(w http.ResponseWriter, req *http.Request) {
@@ -34,15 +85,9 @@ func (config *APIConfig) HandleGetChirps(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	chripResp := make([]chirpResponse, len(chirps))
+	chripResp := make([]*chirpResponse, len(chirps))
 	for i, chirp := range chirps {
-		chripResp[i] = chirpResponse{
-			ID:        chirp.ID,
-			UserID:    chirp.UserID,
-			Body:      chirp.Body,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-		}
+		chripResp[i] = toChirpResponse(chirp)
 	}
 	utils.RespondWithJSON(w, http.StatusOK, chripResp)
 }
@@ -72,18 +117,22 @@ func (config *APIConfig) HandleGetChirpByID(w http.ResponseWriter, req *http.Req
 		}
 		return
 	}
+	// Scheduled chirps are only visible to their author until published
+	if user, ok := auth.UserFromContext(req.Context()); chirp.PublishAt.After(time.Now().UTC()) && (!ok || user.ID != chirp.UserID) {
+		utils.RespondWithError(w, http.StatusNotFound, "chirp could not be found", errors.New("chirp is not published yet"))
+		return
+	}
 
-	utils.RespondWithJSON(w, http.StatusOK,
-		&chirpResponse{
-			ID:        chirp.ID,
-			UserID:    chirp.UserID,
-			Body:      chirp.Body,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-		})
+	utils.RespondWithJSON(w, http.StatusOK, toChirpResponse(chirp))
 }
 
 func (config *APIConfig) HandleCreateChrip(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
 	decoder := json.NewDecoder(req.Body)
 	params := createChirpRequest{}
 	err := decoder.Decode(&params)
@@ -92,101 +141,259 @@ func (config *APIConfig) HandleCreateChrip(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	// Check user authorization
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", err)
+	// Validate chirp
+	limits, ok := config.limits(w, req, user.ID)
+	if !ok {
+		return
+	}
+	if err := limits.CheckChirpLength(utf8.RuneCountInString(params.Body)); err != nil {
+		respondWithEntitlementError(w, err)
 		return
 	}
-	userID, err := auth.ValidateJWT(bearerToken, string(config.SigningKey))
+	var publishAt sql.NullTime
+	if params.PublishAt != nil && params.PublishAt.After(time.Now().UTC()) {
+		if err := limits.CheckSchedule(); err != nil {
+			respondWithEntitlementError(w, err)
+			return
+		}
+		publishAt = sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}
+	}
+	posted, err := config.DBQueries.CountChirpsByUserSince(req.Context(), database.CountChirpsByUserSinceParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC().Add(-time.Hour),
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not count recent chirps", err)
+		return
+	}
+	if err := limits.CheckChirpRate(posted); err != nil {
+		respondWithEntitlementError(w, err)
 		return
 	}
 
-	// Validate chirp
-	if len(params.Body) > 140 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long", err)
+	// Create the chirp
+	chirpDBParams := database.CreateChirpParams{
+		Body:      cleanChirp(params.Body),
+		UserID:    user.ID,
+		PublishAt: publishAt,
+	}
+	chirp, err := config.DBQueries.CreateChirp(req.Context(), chirpDBParams)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not create chirp in db", err)
 		return
 	}
 
-	chirpSplit := strings.Split(params.Body, " ")
+	// Scheduled chirps are announced by AnnounceDueChirps once they are visible
+	resp := toChirpResponse(chirp)
+	if !publishAt.Valid {
+		config.publishWebhook(req, user.ID, webhooks.EventChirpCreated, resp)
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+// announceBatch is how many scheduled chirps are announced per run
+const announceBatch = 100
+
+// AnnounceDueChirps publishes chirp.created for scheduled chirps whose
+// publish_at has passed and returns how many it announced. Each chirp is
+// claimed once, so the event is published once however many instances run.
+func (config *APIConfig) AnnounceDueChirps(ctx context.Context) (int, error) {
+	chirps, err := config.DBQueries.ClaimDueChirpAnnouncements(ctx, announceBatch)
+	if err != nil {
+		return 0, err
+	}
+	for _, chirp := range chirps {
+		if err := config.Webhooks.Publish(ctx, chirp.UserID, webhooks.EventChirpCreated, toChirpResponse(chirp)); err != nil {
+			slog.Error("could not publish webhook", "event_type", webhooks.EventChirpCreated, "chirp_id", chirp.ID, "error", err)
+		}
+	}
+	return len(chirps), nil
+}
+
+// RunChirpAnnouncements announces due scheduled chirps every interval until
+// ctx is cancelled
+func (config *APIConfig) RunChirpAnnouncements(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := config.AnnounceDueChirps(ctx); err != nil {
+				slog.Error("could not announce scheduled chirps", "error", err)
+			}
+		}
+	}
+}
+
+// publishWebhook notifies the user's webhook endpoints, failing to queue the
+// deliveries doesn't fail the request
+func (config *APIConfig) publishWebhook(req *http.Request, userID uuid.UUID, eventType string, data any) {
+	if err := config.Webhooks.Publish(req.Context(), userID, eventType, data); err != nil {
+		logging.FromContext(req.Context()).Error("could not publish webhook", "event_type", eventType, "error", err)
+	}
+}
+
+// cleanChirp censors profane words
+func cleanChirp(body string) string {
+	chirpSplit := strings.Split(body, " ")
 	for i, word := range chirpSplit {
 		cleanedWord := strings.ToLower(word)
 		if cleanedWord == "kerfuffle" || cleanedWord == "sharbert" || cleanedWord == "fornax" {
 			chirpSplit[i] = "****"
 		}
 	}
-	cleanedChirp := strings.Join(chirpSplit, " ")
+	return strings.Join(chirpSplit, " ")
+}
 
-	// Create the chirp
-	chirpDBParams := database.CreateChirpParams{
-		Body:   cleanedChirp,
-		UserID: userID,
+// HandleEditChirp lets Chirpy Red members fix their chirps for a short time
+// after posting
+func (config *APIConfig) HandleEditChirp(w http.ResponseWriter, req *http.Request) {
+	user, chirp, ok := config.ownChirpFromPath(w, req)
+	if !ok {
+		return
 	}
-	chirp, err := config.DBQueries.CreateChirp(req.Context(), chirpDBParams)
+
+	decoder := json.NewDecoder(req.Body)
+	params := editChirpRequest{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "could not create chirp in db", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Bad JSON format", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, &chirpResponse{
-		ID:        chirp.ID,
-		UserID:    chirp.UserID,
-		Body:      chirp.Body,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
+	limits, ok := config.limits(w, req, user.ID)
+	if !ok {
+		return
+	}
+	if err := limits.CheckEdit(chirp.CreatedAt, time.Now().UTC()); err != nil {
+		respondWithEntitlementError(w, err)
+		return
+	}
+	if err := limits.CheckChirpLength(utf8.RuneCountInString(params.Body)); err != nil {
+		respondWithEntitlementError(w, err)
+		return
+	}
+
+	chirp, err = config.DBQueries.UpdateChirpBody(req.Context(), database.UpdateChirpBodyParams{
+		Body:   cleanChirp(params.Body),
+		ID:     chirp.ID,
+		UserID: user.ID,
 	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not update chirp in db", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, toChirpResponse(chirp))
 }
 
-func (config *APIConfig) HandleDeleteChirps(w http.ResponseWriter, req *http.Request) {
-	// Get chirp to delete id
-	chirpID := req.PathValue("chirpID")
-	if len(chirpID) == 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "missing chirp id", errors.New("missing chirp id"))
+// HandlePinChirp pins one of the user's chirps, up to their plan's limit
+func (config *APIConfig) HandlePinChirp(w http.ResponseWriter, req *http.Request) {
+	config.setChirpPinned(w, req, true)
+}
+
+func (config *APIConfig) HandleUnpinChirp(w http.ResponseWriter, req *http.Request) {
+	config.setChirpPinned(w, req, false)
+}
+
+func (config *APIConfig) setChirpPinned(w http.ResponseWriter, req *http.Request, pinned bool) {
+	user, chirp, ok := config.ownChirpFromPath(w, req)
+	if !ok {
 		return
 	}
-	chirpUUID, err := uuid.Parse(chirpID)
-	if err != nil {
 
-		utils.RespondWithError(w, http.StatusBadRequest, "bad chirp id provided", err)
-		return
+	if pinned && !chirp.PinnedAt.Valid {
+		count, err := config.DBQueries.CountPinnedChirpsByUser(req.Context(), user.ID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not count pinned chirps", err)
+			return
+		}
+		limits, ok := config.limits(w, req, user.ID)
+		if !ok {
+			return
+		}
+		if err := limits.CheckPin(count); err != nil {
+			respondWithEntitlementError(w, err)
+			return
+		}
 	}
-	// Check user authorization
-	bearerToken, err := auth.GetBearerToken(req.Header)
+
+	chirp, err := config.DBQueries.SetChirpPinned(req.Context(), database.SetChirpPinnedParams{
+		ID:     chirp.ID,
+		UserID: user.ID,
+		Pinned: pinned,
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not update chirp in db", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(bearerToken, string(config.SigningKey))
+	utils.RespondWithJSON(w, http.StatusOK, toChirpResponse(chirp))
+}
+
+// ownChirpFromPath gets the chirp in the path, which must belong to the user
+func (config *APIConfig) ownChirpFromPath(w http.ResponseWriter, req *http.Request) (database.User, database.Chirp, bool) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return database.User{}, database.Chirp{}, false
+	}
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", err)
-		return
+		utils.RespondWithError(w, http.StatusBadRequest, "bad chirp id provided", err)
+		return database.User{}, database.Chirp{}, false
 	}
-
-	// Check if chirp exists
-	_, err = config.DBQueries.GetChirpById(req.Context(), chirpUUID)
+	chirp, err := config.DBQueries.GetChirpById(req.Context(), chirpUUID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.RespondWithError(w, http.StatusNotFound, "chirp not found", err)
 		} else {
 			utils.RespondWithError(w, http.StatusInternalServerError, "db error could not get chirp", err)
 		}
+		return database.User{}, database.Chirp{}, false
+	}
+	if chirp.UserID != user.ID {
+		utils.RespondWithError(w, http.StatusForbidden, "chirp not owned by user", errors.New("user does not own chirp"))
+		return database.User{}, database.Chirp{}, false
+	}
+	return user, chirp, true
+}
+
+func (config *APIConfig) HandleDeleteChirps(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
 		return
 	}
 
-	rowsAffected, err := config.DBQueries.DeleteChirpById(req.Context(), database.DeleteChirpByIdParams{
-		ID:     chirpUUID,
-		UserID: userID,
-	})
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "unable to delete chirp", err)
+	// Get chirp to delete id
+	chirpID := req.PathValue("chirpID")
+	if len(chirpID) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "missing chirp id", errors.New("missing chirp id"))
 		return
 	}
-	if rowsAffected == 0 {
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
 
-		utils.RespondWithError(w, http.StatusForbidden, "chirp not found or not owned by user", errors.New("user does not own chirp"))
+		utils.RespondWithError(w, http.StatusBadRequest, "bad chirp id provided", err)
 		return
 	}
+	// Moderators can delete anyone's chirps
+	chirp, err := config.Service.DeleteChirp(req.Context(), user, chirpUUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChirpNotFound):
+			utils.RespondWithError(w, http.StatusNotFound, "chirp not found", err)
+		case errors.Is(err, service.ErrNotChirpAuthor):
+			utils.RespondWithError(w, http.StatusForbidden, "chirp not found or not owned by user", err)
+		default:
+			utils.RespondWithError(w, http.StatusInternalServerError, "unable to delete chirp", err)
+		}
+		return
+	}
+	// Endpoints only hear of a scheduled chirp's deletion if they heard of it
+	if chirp.AnnouncedAt.Valid {
+		config.publishWebhook(req, chirp.UserID, webhooks.EventChirpDeleted, toChirpResponse(chirp))
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,742 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/database/memory"
+	"github.com/jlargs64/chirpy/internal/database/sqlite"
+	"github.com/jlargs64/chirpy/internal/service"
+	"github.com/jlargs64/chirpy/internal/webhooks"
+	"github.com/jlargs64/chirpy/sql/schema"
+	sqliteschema "github.com/jlargs64/chirpy/sql/sqlite/schema"
+)
+
+// backends run every handler test, Postgres only when TEST_DB_URL names a
+// database the tests may create schemas in
+var backends = []struct {
+	name  string
+	store func(t *testing.T) (database.Querier, database.Transactor)
+}{
+	{"Memory", func(t *testing.T) (database.Querier, database.Transactor) {
+		store := memory.New()
+		return store, store
+	}},
+	{"SQLite", func(t *testing.T) (database.Querier, database.Transactor) {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "chirpy.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrate(t, db, sqliteschema.NewProvider)
+		return sqlite.NewStore(db), sqlite.NewTxRunner(db, func(tx database.DBTX) database.Querier { return sqlite.NewStore(tx) })
+	}},
+	{"Postgres", func(t *testing.T) (database.Querier, database.Transactor) {
+		dbURL := os.Getenv("TEST_DB_URL")
+		if dbURL == "" {
+			t.Skip("TEST_DB_URL is not set")
+		}
+		db := postgresSchema(t, dbURL)
+		migrate(t, db, schema.NewProvider)
+		return database.New(db), database.NewTxRunner(db, func(tx database.DBTX) database.Querier { return database.New(tx) })
+	}},
+}
+
+func migrate(t *testing.T, db *sql.DB, newProvider func(*sql.DB) (*goose.Provider, error)) {
+	t.Helper()
+	t.Cleanup(func() { db.Close() })
+	migrations, err := newProvider(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// postgresSchema opens dbURL in a schema of its own, dropped once the test
+// is done, so tests can run in parallel against the same database
+func postgresSchema(t *testing.T, dbURL string) *sql.DB {
+	t.Helper()
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + name + " CASCADE"); err != nil {
+			t.Errorf("could not drop schema %s: %v", name, err)
+		}
+		admin.Close()
+	})
+
+	// lib/pq sends unknown parameters to the server as settings
+	if u, err := url.Parse(dbURL); err == nil && u.Scheme != "" {
+		query := u.Query()
+		query.Set("search_path", name)
+		u.RawQuery = query.Encode()
+		dbURL = u.String()
+	} else {
+		dbURL += " search_path=" + name
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// forEachBackend runs test against a server for each backend
+func forEachBackend(t *testing.T, test func(t *testing.T, server *testServer)) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, tx := backend.store(t)
+			test(t, newTestServer(t, store, tx))
+		})
+	}
+}
+
+type testServer struct {
+	t       *testing.T
+	store   database.Querier
+	config  *APIConfig
+	handler http.Handler
+}
+
+// newTestServer serves the user, chirp, webhook and admin routes against
+// store, with transactions run by tx. Tests register the webhook providers
+// they send deliveries from.
+func newTestServer(t *testing.T, store database.Querier, tx database.Transactor) *testServer {
+	t.Helper()
+	signingKey := []byte("test-signing-key")
+	denylist := auth.NewDenylist(store, auth.AccessTokenExpiry)
+	config := &APIConfig{
+		DBQueries:        store,
+		Service:          service.New(tx, signingKey),
+		Platform:         "dev",
+		SigningKey:       signingKey,
+		Webhooks:         webhooks.NewDispatcher(store),
+		Denylist:         denylist,
+		LoginThrottle:    auth.NewLoginThrottle(store),
+		WebhookProviders: webhooks.NewRegistry(),
+	}
+	authorizer := &auth.Authorizer{
+		Users:      store,
+		Tokens:     store,
+		SigningKey: signingKey,
+		Denylist:   denylist,
+	}
+	requireScope := func(scope auth.Scope, handler http.HandlerFunc) http.Handler {
+		return authorizer.RequireScope(scope, handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/users", config.HandleCreateUser)
+	mux.Handle("PUT /api/users", requireScope(auth.ScopeUsersWrite, config.HandleChangeUser))
+	mux.HandleFunc("POST /api/login", config.HandleLogin)
+	mux.HandleFunc("POST /api/refresh", config.HandleRefreshToken)
+	mux.HandleFunc("POST /api/revoke", config.HandleRefreshRevoke)
+	mux.HandleFunc("GET /api/chirps", config.HandleGetChirps)
+	mux.Handle("GET /api/chirps/{chirpID}", authorizer.OptionalAuth(http.HandlerFunc(config.HandleGetChirpByID)))
+	mux.Handle("POST /api/chirps", requireScope(auth.ScopeChirpsWrite, config.HandleCreateChrip))
+	mux.Handle("DELETE /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, config.HandleDeleteChirps))
+	mux.HandleFunc("POST /api/{provider}/webhooks", config.HandleProviderWebhook)
+	requireAdmin := func(handler http.HandlerFunc) http.Handler {
+		return authorizer.RequireScope(auth.ScopeAdmin, authorizer.RequireRole(database.UserRoleAdmin, handler))
+	}
+	mux.Handle("POST /admin/reset", requireAdmin(config.HandlerReset))
+	mux.Handle("POST /admin/users/{userID}/ban", requireAdmin(config.HandleBanUser))
+	mux.Handle("DELETE /admin/users/{userID}/ban", requireAdmin(config.HandleUnbanUser))
+	mux.Handle("GET /admin/webhooks/events", requireAdmin(config.HandleGetWebhookEvents))
+	mux.Handle("GET /admin/webhooks/events/{eventID}", requireAdmin(config.HandleGetWebhookEvent))
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", requireAdmin(config.HandleReplayWebhookEvent))
+	return &testServer{t: t, store: store, config: config, handler: mux}
+}
+
+// do sends the request with body encoded as JSON and decodes the response
+// into resp when it is not nil
+func (s *testServer) do(method, path, token string, body, resp any) int {
+	s.t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	if resp != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(resp); err != nil {
+			s.t.Fatalf("%s %s: could not decode the response: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// signUp creates a user and logs them in
+func (s *testServer) signUp(email string) loginResp {
+	s.t.Helper()
+	creds := userReqParams{Email: email, Password: "hunter2"}
+	if code := s.do(http.MethodPost, "/api/users", "", creds, nil); code != http.StatusCreated {
+		s.t.Fatalf("expected the user to be created, got %d", code)
+	}
+	var login loginResp
+	if code := s.do(http.MethodPost, "/api/login", "", creds, &login); code != http.StatusOK {
+		s.t.Fatalf("expected the user to log in, got %d", code)
+	}
+	return login
+}
+
+// subscribe gives the user a Chirpy Red subscription with access until
+// accessUntil
+func (s *testServer) subscribe(userID uuid.UUID, accessUntil time.Time) {
+	s.t.Helper()
+	_, err := s.store.UpsertSubscription(context.Background(), database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Plan:               "chirpy_red",
+		Status:             database.SubscriptionStatusActive,
+		CurrentPeriodStart: accessUntil.Add(-time.Hour * 24 * 30),
+		CurrentPeriodEnd:   accessUntil,
+		AccessUntil:        accessUntil,
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *testServer) chirp(token, body string) chirpResponse {
+	s.t.Helper()
+	var chirp chirpResponse
+	if code := s.do(http.MethodPost, "/api/chirps", token, createChirpRequest{Body: body}, &chirp); code != http.StatusCreated {
+		s.t.Fatalf("expected the chirp to be created, got %d", code)
+	}
+	return chirp
+}
+
+func TestLogin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		server.signUp("walt@example.com")
+		tests := []struct {
+			name     string
+			email    string
+			password string
+			wantCode int
+		}{
+			{"Correct password", "walt@example.com", "hunter2", http.StatusOK},
+			{"Wrong password", "walt@example.com", "hunter3", http.StatusUnauthorized},
+			{"Unknown email", "saul@example.com", "hunter2", http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var login loginResp
+				code := server.do(http.MethodPost, "/api/login", "", userReqParams{Email: tt.email, Password: tt.password}, &login)
+				if code != tt.wantCode {
+					t.Fatalf("expected %d, got %d", tt.wantCode, code)
+				}
+				if code == http.StatusOK && (login.Token == "" || login.RefreshToken == "") {
+					t.Errorf("expected an access and a refresh token, got %+v", login)
+				}
+			})
+		}
+	})
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		login := server.signUp("walt@example.com")
+
+		var refreshed refreshResp
+		if code := server.do(http.MethodPost, "/api/refresh", login.RefreshToken, nil, &refreshed); code != http.StatusOK {
+			t.Fatalf("expected the token to be refreshed, got %d", code)
+		}
+		if _, err := auth.ValidateJWT(refreshed.Token, "test-signing-key", nil); err != nil {
+			t.Errorf("expected a valid access token, got %v", err)
+		}
+
+		if code := server.do(http.MethodPost, "/api/revoke", login.RefreshToken, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("expected the token to be revoked, got %d", code)
+		}
+		if code := server.do(http.MethodPost, "/api/refresh", login.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected a revoked token to be refused, got %d", code)
+		}
+		if code := server.do(http.MethodPost, "/api/chirps", login.Token, createChirpRequest{Body: "hello"}, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected the access token to be revoked with it, got %d", code)
+		}
+
+		// Logging in again within the same second as the revocation must work
+		var relogin loginResp
+		if code := server.do(http.MethodPost, "/api/login", "", userReqParams{Email: "walt@example.com", Password: "hunter2"}, &relogin); code != http.StatusOK {
+			t.Fatalf("expected the user to log in again, got %d", code)
+		}
+		server.chirp(relogin.Token, "I am the one who knocks")
+	})
+}
+
+func TestChirps(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		walt := server.signUp("walt@example.com")
+		saul := server.signUp("saul@example.com")
+
+		first := server.chirp(walt.Token, "I am the one who knocks")
+		second := server.chirp(saul.Token, "what a kerfuffle")
+		if second.Body != "what a ****" {
+			t.Errorf("expected profanity to be censored, got %q", second.Body)
+		}
+		// Lengths are counted in characters, not bytes
+		server.chirp(walt.Token, strings.Repeat("é", 140))
+
+		var chirps []chirpResponse
+		if code := server.do(http.MethodGet, "/api/chirps", "", nil, &chirps); code != http.StatusOK {
+			t.Fatalf("expected the chirps, got %d", code)
+		}
+		if len(chirps) != 3 || chirps[0].ID != first.ID || chirps[1].ID != second.ID {
+			t.Errorf("expected the chirps oldest first, got %+v", chirps)
+		}
+
+		tests := []struct {
+			name     string
+			method   string
+			path     string
+			token    string
+			wantCode int
+		}{
+			{"Get", http.MethodGet, "/api/chirps/" + first.ID.String(), "", http.StatusOK},
+			{"Get missing", http.MethodGet, "/api/chirps/" + walt.ID.String(), "", http.StatusNotFound},
+			{"Get bad id", http.MethodGet, "/api/chirps/abc", "", http.StatusBadRequest},
+			{"Create unauthenticated", http.MethodPost, "/api/chirps", "", http.StatusUnauthorized},
+			{"Delete someone else's", http.MethodDelete, "/api/chirps/" + first.ID.String(), saul.Token, http.StatusForbidden},
+			{"Delete own", http.MethodDelete, "/api/chirps/" + first.ID.String(), walt.Token, http.StatusNoContent},
+			{"Delete again", http.MethodDelete, "/api/chirps/" + first.ID.String(), walt.Token, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				body := any(nil)
+				if tt.method == http.MethodPost {
+					body = createChirpRequest{Body: "hello"}
+				}
+				if code := server.do(tt.method, tt.path, tt.token, body, nil); code != tt.wantCode {
+					t.Errorf("expected %d, got %d", tt.wantCode, code)
+				}
+			})
+		}
+	})
+}
+
+func TestChangeUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		walt := server.signUp("walt@example.com")
+
+		var user User
+		code := server.do(http.MethodPut, "/api/users", walt.Token, userReqParams{Email: "heisenberg@example.com", Password: "hunter3"}, &user)
+		if code != http.StatusOK {
+			t.Fatalf("expected the user to be updated, got %d", code)
+		}
+		if user.Email != "heisenberg@example.com" {
+			t.Errorf("expected the new email, got %q", user.Email)
+		}
+		if code := server.do(http.MethodPost, "/api/login", "", userReqParams{Email: "heisenberg@example.com", Password: "hunter3"}, nil); code != http.StatusOK {
+			t.Errorf("expected the new credentials to log in, got %d", code)
+		}
+	})
+}
+
+func TestReset(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		walt := server.signUp("walt@example.com")
+		server.chirp(walt.Token, "say my name")
+
+		if code := server.do(http.MethodPost, "/admin/reset", walt.Token, nil, nil); code != http.StatusForbidden {
+			t.Errorf("expected users to be refused, got %d", code)
+		}
+
+		_, err := server.store.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: walt.ID, Role: database.UserRoleAdmin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := server.do(http.MethodPost, "/admin/reset", walt.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("expected admins to reset, got %d", code)
+		}
+		var chirps []chirpResponse
+		server.do(http.MethodGet, "/api/chirps", "", nil, &chirps)
+		if len(chirps) != 0 {
+			t.Errorf("expected the chirps to be deleted, got %d", len(chirps))
+		}
+		if code := server.do(http.MethodPost, "/api/login", "", userReqParams{Email: "walt@example.com", Password: "hunter2"}, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected the users to be deleted, got %d", code)
+		}
+	})
+}
+
+func TestBanUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		walt := server.signUp("walt@example.com")
+		admin := server.signUp("gus@example.com")
+		_, err := server.store.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: admin.ID, Role: database.UserRoleAdmin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		banPath := "/admin/users/" + walt.ID.String() + "/ban"
+		creds := userReqParams{Email: "walt@example.com", Password: "hunter2"}
+
+		if code := server.do(http.MethodPost, banPath, walt.Token, nil, nil); code != http.StatusForbidden {
+			t.Errorf("expected users to be refused, got %d", code)
+		}
+		if code := server.do(http.MethodPost, "/admin/users/"+admin.ID.String()+"/ban", admin.Token, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("expected admins not to ban themselves, got %d", code)
+		}
+		var banned User
+		if code := server.do(http.MethodPost, banPath, admin.Token, nil, &banned); code != http.StatusOK {
+			t.Fatalf("expected the user to be banned, got %d", code)
+		}
+		if banned.BannedAt == nil {
+			t.Error("expected banned_at to be set")
+		}
+
+		tests := []struct {
+			name     string
+			method   string
+			path     string
+			token    string
+			body     any
+			wantCode int
+		}{
+			{"Access token", http.MethodPost, "/api/chirps", walt.Token, createChirpRequest{Body: "hello"}, http.StatusUnauthorized},
+			{"Refresh", http.MethodPost, "/api/refresh", walt.RefreshToken, nil, http.StatusForbidden},
+			{"Login", http.MethodPost, "/api/login", "", creds, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if code := server.do(tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+					t.Errorf("expected %d, got %d", tt.wantCode, code)
+				}
+			})
+		}
+
+		if code := server.do(http.MethodDelete, banPath, admin.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("expected the ban to be lifted, got %d", code)
+		}
+		var login loginResp
+		if code := server.do(http.MethodPost, "/api/login", "", creds, &login); code != http.StatusOK {
+			t.Fatalf("expected the user to log in after the ban is lifted, got %d", code)
+		}
+		server.chirp(login.Token, "I am the one who knocks")
+	})
+}
+
+func TestConcurrentDuplicateWebhook(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		var handled atomic.Int32
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		provider := webhooks.NewProvider("test", func(http.Header, []byte) error { return nil })
+		webhooks.Handle(provider, "test.event", func(ctx context.Context, data struct{}) error {
+			if handled.Add(1) == 1 {
+				entered <- struct{}{}
+				<-release
+			}
+			return nil
+		})
+		server.config.WebhookProviders.Register(provider)
+		delivery := map[string]any{"id": "evt_1", "event": "test.event", "data": map[string]any{}}
+
+		first := make(chan int)
+		go func() {
+			first <- server.do(http.MethodPost, "/api/test/webhooks", "", delivery, nil)
+		}()
+		<-entered
+
+		if code := server.do(http.MethodPost, "/api/test/webhooks", "", delivery, nil); code != http.StatusConflict {
+			t.Errorf("expected a duplicate delivery to be turned away while the first is processed, got %d", code)
+		}
+		events, err := server.store.ListWebhookEvents(context.Background(), database.ListWebhookEventsParams{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected one recorded event, got %d", len(events))
+		}
+		admin := server.signUp("gus@example.com")
+		if _, err := server.store.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: admin.ID, Role: database.UserRoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+		replayPath := "/admin/webhooks/events/" + events[0].ID.String() + "/replay"
+		if code := server.do(http.MethodPost, replayPath, admin.Token, nil, nil); code != http.StatusConflict {
+			t.Errorf("expected a replay to be turned away while the event is processed, got %d", code)
+		}
+
+		close(release)
+		if code := <-first; code != http.StatusNoContent {
+			t.Fatalf("expected the first delivery to be processed, got %d", code)
+		}
+		if code := server.do(http.MethodPost, "/api/test/webhooks", "", delivery, nil); code != http.StatusNoContent {
+			t.Errorf("expected a later duplicate to be acknowledged, got %d", code)
+		}
+		if n := handled.Load(); n != 1 {
+			t.Errorf("expected the event to be handled once, got %d", n)
+		}
+		if code := server.do(http.MethodPost, replayPath, admin.Token, nil, nil); code != http.StatusOK {
+			t.Errorf("expected the finished event to be replayed, got %d", code)
+		}
+	})
+}
+
+func TestChirpyRedFromSubscription(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		walt := server.signUp("walt@example.com")
+		creds := userReqParams{Email: "walt@example.com", Password: "hunter2"}
+		publishAt := time.Now().Add(time.Hour)
+		scheduled := createChirpRequest{Body: "say my name", PublishAt: &publishAt}
+
+		if walt.IsChirpyRed {
+			t.Error("expected a new user not to be a member")
+		}
+		if code := server.do(http.MethodPost, "/api/chirps", walt.Token, scheduled, nil); code != http.StatusPaymentRequired {
+			t.Errorf("expected scheduling to need Chirpy Red, got %d", code)
+		}
+
+		server.subscribe(walt.ID, time.Now().Add(time.Hour))
+		var login loginResp
+		if code := server.do(http.MethodPost, "/api/login", "", creds, &login); code != http.StatusOK || !login.IsChirpyRed {
+			t.Errorf("expected an active subscription to make the user a member, got %d %+v", code, login)
+		}
+		if code := server.do(http.MethodPost, "/api/chirps", walt.Token, scheduled, nil); code != http.StatusCreated {
+			t.Errorf("expected a member to schedule a chirp, got %d", code)
+		}
+
+		// Access ends with the subscription even before it is marked expired
+		server.subscribe(walt.ID, time.Now().Add(-time.Minute))
+		if code := server.do(http.MethodPost, "/api/login", "", creds, &login); code != http.StatusOK || login.IsChirpyRed {
+			t.Errorf("expected a lapsed subscription to end the membership, got %d %+v", code, login)
+		}
+		if code := server.do(http.MethodPost, "/api/chirps", walt.Token, scheduled, nil); code != http.StatusPaymentRequired {
+			t.Errorf("expected a lapsed member to be refused, got %d", code)
+		}
+	})
+}
+
+func TestScheduledChirpAnnouncement(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		ctx := context.Background()
+		walt := server.signUp("walt@example.com")
+		server.subscribe(walt.ID, time.Now().Add(time.Hour))
+		endpoint, err := server.store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+			UserID:     walt.ID,
+			Url:        "https://example.com/hooks",
+			Secret:     "secret",
+			EventTypes: []string{webhooks.EventChirpCreated},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deliveries := func() []database.WebhookDelivery {
+			t.Helper()
+			deliveries, err := server.store.GetWebhookDeliveriesByEndpoint(ctx, database.GetWebhookDeliveriesByEndpointParams{EndpointID: endpoint.ID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return deliveries
+		}
+		announce := func() int {
+			t.Helper()
+			announced, err := server.config.AnnounceDueChirps(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return announced
+		}
+
+		server.chirp(walt.Token, "I am the one who knocks")
+		if n := len(deliveries()); n != 1 {
+			t.Fatalf("expected a chirp to be announced when it is posted, got %d deliveries", n)
+		}
+
+		publishAt := time.Now().Add(time.Millisecond * 300)
+		var scheduled chirpResponse
+		if code := server.do(http.MethodPost, "/api/chirps", walt.Token, createChirpRequest{Body: "say my name", PublishAt: &publishAt}, &scheduled); code != http.StatusCreated {
+			t.Fatalf("expected the chirp to be scheduled, got %d", code)
+		}
+		if n := announce(); n != 0 || len(deliveries()) != 1 {
+			t.Fatalf("expected the scheduled chirp not to be announced before it is published, announced %d", n)
+		}
+
+		// SQLite's clock only counts milliseconds, so wait until the one after
+		// publish_at
+		time.Sleep(time.Until(publishAt.Add(time.Millisecond * 2)))
+		if n := announce(); n != 1 {
+			t.Fatalf("expected the published chirp to be announced, announced %d", n)
+		}
+		if n := announce(); n != 0 {
+			t.Errorf("expected the chirp to be announced once, announced %d more", n)
+		}
+		got := deliveries()
+		if len(got) != 2 || got[0].EventType != webhooks.EventChirpCreated || !strings.Contains(got[0].Payload, scheduled.ID.String()) {
+			t.Errorf("expected a chirp.created delivery for the scheduled chirp, got %+v", got)
+		}
+	})
+}
+
+func TestWebhookEventWithInvalidPayload(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		server.config.WebhookProviders.Register(webhooks.NewProvider("test", func(http.Header, []byte) error { return nil }))
+		admin := server.signUp("gus@example.com")
+		if _, err := server.store.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: admin.ID, Role: database.UserRoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A string encodes to JSON but doesn't decode as an event
+		if code := server.do(http.MethodPost, "/api/test/webhooks", "", "not an event", nil); code != http.StatusBadRequest {
+			t.Fatalf("expected the delivery to be rejected, got %d", code)
+		}
+		event, err := server.store.RecordWebhookEvent(context.Background(), database.RecordWebhookEventParams{
+			Provider: "test",
+			EventID:  "evt_garbled",
+			Payload:  "{not json",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var events []WebhookEvent
+		if code := server.do(http.MethodGet, "/admin/webhooks/events", admin.Token, nil, &events); code != http.StatusOK || len(events) != 2 {
+			t.Fatalf("expected both events to be listed, got %d %+v", code, events)
+		}
+		var got WebhookEvent
+		if code := server.do(http.MethodGet, "/admin/webhooks/events/"+event.ID.String(), admin.Token, nil, &got); code != http.StatusOK {
+			t.Fatalf("expected the event, got %d", code)
+		}
+		if got.Payload != nil || got.RawPayload != "{not json" {
+			t.Errorf("expected the payload as a string, got %+v", got)
+		}
+	})
+}
+
+func TestProviderWebhookDedupe(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		var handled atomic.Int32
+		provider := webhooks.NewProvider("test", func(http.Header, []byte) error { return nil })
+		webhooks.Handle(provider, "test.event", func(ctx context.Context, data struct{}) error {
+			handled.Add(1)
+			return nil
+		})
+		provider.Ignore("test.ignored")
+		server.config.WebhookProviders.Register(provider)
+		deliver := func(delivery map[string]any) {
+			t.Helper()
+			if code := server.do(http.MethodPost, "/api/test/webhooks", "", delivery, nil); code != http.StatusNoContent {
+				t.Fatalf("expected the delivery to be acknowledged, got %d", code)
+			}
+		}
+		events := func() int {
+			t.Helper()
+			events, err := server.store.ListWebhookEvents(context.Background(), database.ListWebhookEventsParams{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return len(events)
+		}
+
+		t.Run("Same id", func(t *testing.T) {
+			handled.Store(0)
+			delivery := map[string]any{"id": "evt_1", "event": "test.event", "data": map[string]any{}}
+			deliver(delivery)
+			deliver(delivery)
+			if n := handled.Load(); n != 1 {
+				t.Errorf("expected a redelivered event to be handled once, got %d", n)
+			}
+		})
+		t.Run("Repeat without an id", func(t *testing.T) {
+			handled.Store(0)
+			before := events()
+			delivery := map[string]any{"event": "test.event", "data": map[string]any{}}
+			deliver(delivery)
+			deliver(delivery)
+			if n := handled.Load(); n != 2 {
+				t.Errorf("expected both deliveries without an id to be handled, got %d", n)
+			}
+			if n := events() - before; n != 2 {
+				t.Errorf("expected both deliveries to be recorded, got %d", n)
+			}
+		})
+		t.Run("Ignored", func(t *testing.T) {
+			handled.Store(0)
+			delivery := map[string]any{"id": "evt_2", "event": "test.ignored", "data": map[string]any{}}
+			deliver(delivery)
+			deliver(delivery)
+			if n := handled.Load(); n != 0 {
+				t.Errorf("expected an ignored event not to be handled, got %d", n)
+			}
+		})
+	})
+}
+
+// failingRetryStore fails to mark the next replayed event as retried
+type failingRetryStore struct {
+	database.Querier
+	fail atomic.Bool
+}
+
+func (s *failingRetryStore) RetryWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	if s.fail.Swap(false) {
+		return database.WebhookEvent{}, errors.New("connection reset")
+	}
+	return s.Querier.RetryWebhookEvent(ctx, id)
+}
+
+func TestReplayReleasesClaimOnError(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			querier, tx := backend.store(t)
+			store := &failingRetryStore{Querier: querier}
+			server := newTestServer(t, store, tx)
+			provider := webhooks.NewProvider("test", func(http.Header, []byte) error { return nil })
+			webhooks.Handle(provider, "test.event", func(ctx context.Context, data struct{}) error { return nil })
+			server.config.WebhookProviders.Register(provider)
+			delivery := map[string]any{"id": "evt_1", "event": "test.event", "data": map[string]any{}}
+			if code := server.do(http.MethodPost, "/api/test/webhooks", "", delivery, nil); code != http.StatusNoContent {
+				t.Fatalf("expected the delivery to be processed, got %d", code)
+			}
+			events, err := store.ListWebhookEvents(context.Background(), database.ListWebhookEventsParams{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			admin := server.signUp("gus@example.com")
+			if _, err := store.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: admin.ID, Role: database.UserRoleAdmin}); err != nil {
+				t.Fatal(err)
+			}
+
+			replayPath := "/admin/webhooks/events/" + events[0].ID.String() + "/replay"
+			store.fail.Store(true)
+			if code := server.do(http.MethodPost, replayPath, admin.Token, nil, nil); code != http.StatusInternalServerError {
+				t.Fatalf("expected the replay to fail, got %d", code)
+			}
+			if code := server.do(http.MethodPost, replayPath, admin.Token, nil, nil); code != http.StatusOK {
+				t.Errorf("expected the event to be replayable after a failed replay, got %d", code)
+			}
+		})
+	}
+}
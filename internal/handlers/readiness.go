@@ -1,15 +1,46 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
+
+	"github.com/jlargs64/chirpy/internal/health"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/utils"
 )
 
-func HandlerReadiness(w http.ResponseWriter, r *http.Request) {
+// HandlerLiveness only reports that the process is serving requests, it
+// doesn't check dependencies so an outage can't get every instance restarted
+func (config *APIConfig) HandlerLiveness(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte(http.StatusText(http.StatusOK)))
 	if err != nil {
-		log.Println("handlerReadiness failed to write:", err)
+		logging.FromContext(r.Context()).Error("could not write liveness", "error", err)
+	}
+}
+
+// HandlerReadiness runs the health checks and fails when a required one does,
+// or once the server starts draining so load balancers stop sending it
+// requests before it shuts down
+func (config *APIConfig) HandlerReadiness(w http.ResponseWriter, r *http.Request) {
+	if config.Draining.Load() {
+		utils.RespondWithJSON(w, http.StatusServiceUnavailable, health.Report{
+			Status: health.StatusDraining,
+			Checks: []health.Result{},
+		})
+		return
+	}
+	report := config.Health.Run(r.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+		for _, result := range report.Checks {
+			if result.Status != health.StatusOK {
+				logging.FromContext(r.Context()).Warn("readiness check failed",
+					"check", result.Name, "error", result.Error)
+			}
+		}
 	}
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, status, report)
 }
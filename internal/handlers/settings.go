@@ -3,13 +3,33 @@ package handlers
 import (
 	"sync/atomic"
 
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/billing"
 	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/health"
+	"github.com/jlargs64/chirpy/internal/metrics"
+	"github.com/jlargs64/chirpy/internal/service"
+	"github.com/jlargs64/chirpy/internal/sso"
+	"github.com/jlargs64/chirpy/internal/webhooks"
 )
 
 type APIConfig struct {
 	FileserverHits atomic.Int32
-	DBQueries      *database.Queries
-	Platform       string
-	SigningKey     []byte
-	PolkaAPIKey    string
+	// Draining is set when the server is shutting down
+	Draining      atomic.Bool
+	DBQueries     database.Querier
+	Platform      string
+	SigningKey    []byte
+	PolkaAPIKey   string
+	PolkaVerifier *webhooks.Verifier
+	// WebhookProviders are the senders of webhooks the API receives
+	WebhookProviders *webhooks.Registry
+	Billing          *billing.Service
+	Service          *service.Service
+	Webhooks         *webhooks.Dispatcher
+	Denylist         *auth.Denylist
+	LoginThrottle    *auth.LoginThrottle
+	Metrics          *metrics.Metrics
+	Health           *health.Checker
+	SSOProviders     map[string]*sso.Provider
 }
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/sso"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+func (config *APIConfig) ssoProvider(w http.ResponseWriter, req *http.Request) (*sso.Provider, bool) {
+	provider, ok := config.SSOProviders[req.PathValue("provider")]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "unknown sign in provider", errors.New("unknown sign in provider"))
+	}
+	return provider, ok
+}
+
+// HandleSSOLogin sends the user to the provider to sign in
+func (config *APIConfig) HandleSSOLogin(w http.ResponseWriter, req *http.Request) {
+	provider, ok := config.ssoProvider(w, req)
+	if !ok {
+		return
+	}
+
+	state, err := sso.NewLoginState(provider.Name())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the login state could not be generated", err)
+		return
+	}
+	err = sso.SetLoginStateCookie(w, state, config.SigningKey, config.Platform != "dev")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the login state could not be saved", err)
+		return
+	}
+	http.Redirect(w, req, provider.AuthCodeURL(state), http.StatusFound)
+}
+
+// HandleSSOCallback finishes signing in with the provider, linking the identity
+// to the user with the same verified email or creating a new user
+func (config *APIConfig) HandleSSOCallback(w http.ResponseWriter, req *http.Request) {
+	provider, ok := config.ssoProvider(w, req)
+	if !ok {
+		return
+	}
+
+	state, err := sso.ReadLoginStateCookie(w, req, provider.Name(), config.SigningKey)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "the sign in could not be verified, please try again", err)
+		return
+	}
+	query := req.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "the provider did not sign the user in", errors.New(providerErr))
+		return
+	}
+	if query.Get("state") != state.State {
+		utils.RespondWithError(w, http.StatusBadRequest, "the sign in could not be verified, please try again", errors.New("state mismatch"))
+		return
+	}
+
+	identity, err := provider.Exchange(req.Context(), query.Get("code"), state)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "the provider's response could not be verified", err)
+		return
+	}
+	if !identity.EmailVerified {
+		utils.RespondWithError(w, http.StatusForbidden, "the provider has not verified the email", errors.New("unverified email"))
+		return
+	}
+
+	// Find the linked user
+	link, err := config.DBQueries.GetUserIdentity(req.Context(), database.GetUserIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		user, err := config.DBQueries.GetUserById(req.Context(), link.UserID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not get the linked user", err)
+			return
+		}
+		config.respondWithLogin(w, req, user, false)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the linked identity", err)
+		return
+	}
+
+	// Link to the user with the same email or create one
+	user, err := config.DBQueries.GetUserByEmail(req.Context(), identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = config.createSSOUser(req, identity)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get or create the user", err)
+		return
+	}
+	_, err = config.DBQueries.CreateUserIdentity(req.Context(), database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not link the identity to the user", err)
+		return
+	}
+	config.respondWithLogin(w, req, user, false)
+}
+
+// createSSOUser creates a user who can only sign in through providers until
+// they set a password
+func (config *APIConfig) createSSOUser(req *http.Request, identity *sso.Identity) (database.User, error) {
+	randomPassword, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(randomPassword)
+	if err != nil {
+		return database.User{}, err
+	}
+	return config.DBQueries.CreateUser(req.Context(), database.CreateUserParams{
+		Email:          identity.Email,
+		HashedPassword: hashedPassword,
+	})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+const (
+	defaultTokenExpiryDays = 30
+	maxTokenExpiryDays     = 365
+)
+
+type createTokenReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type tokenResp struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Token is only set in the response to creating the token
+	Token string `json:"token,omitempty"`
+}
+
+func newTokenResp(pat database.PersonalAccessToken) tokenResp {
+	resp := tokenResp{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		CreatedAt: pat.CreatedAt,
+		ExpiresAt: pat.ExpiresAt,
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	if pat.RevokedAt.Valid {
+		resp.RevokedAt = &pat.RevokedAt.Time
+	}
+	return resp
+}
+
+func (config *APIConfig) HandleCreateToken(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := &createTokenReq{}
+	err := decoder.Decode(params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "create token params is not in a valid format", err)
+		return
+	}
+
+	// Validate token params
+	if len(params.Name) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "a token name is required", errors.New("missing token name"))
+		return
+	}
+	scopes, ok := auth.ParseGrantableScopes(params.Scopes)
+	if !ok || len(scopes) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "scopes must be a non empty list of grantable scopes", errors.New("invalid scopes"))
+		return
+	}
+	if params.ExpiresInDays == 0 {
+		params.ExpiresInDays = defaultTokenExpiryDays
+	}
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxTokenExpiryDays {
+		utils.RespondWithError(w, http.StatusBadRequest, "expires_in_days must be between 1 and 365", errors.New("invalid token expiry"))
+		return
+	}
+
+	token, tokenHash, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the token could not be generated", err)
+		return
+	}
+	scopeNames := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeNames[i] = string(scope)
+	}
+	pat, err := config.DBQueries.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    user.ID,
+		Name:      params.Name,
+		TokenHash: tokenHash,
+		Scopes:    scopeNames,
+		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * time.Duration(params.ExpiresInDays)),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the token could not be saved to the database", err)
+		return
+	}
+
+	resp := newTokenResp(pat)
+	resp.Token = token
+	utils.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (config *APIConfig) HandleGetTokens(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	pats, err := config.DBQueries.GetPersonalAccessTokensByUser(req.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "there was an error getting tokens from the database", err)
+		return
+	}
+
+	tokensResp := make([]tokenResp, len(pats))
+	for i, pat := range pats {
+		tokensResp[i] = newTokenResp(pat)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, tokensResp)
+}
+
+func (config *APIConfig) HandleRevokeToken(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	tokenUUID, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "token id is not a valid uuid", err)
+		return
+	}
+
+	rowsAffected, err := config.DBQueries.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenUUID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not revoke token in the db", err)
+		return
+	}
+	if rowsAffected == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "token not found", errors.New("token not found or already revoked"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,22 +1,64 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/billing"
 	"github.com/jlargs64/chirpy/internal/database"
 	"github.com/jlargs64/chirpy/internal/utils"
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Email       string     `json:"email"`
+	IsChirpyRed bool       `json:"is_chirpy_red"`
+	Role        string     `json:"role"`
+	BannedAt    *time.Time `json:"banned_at,omitempty"`
+}
+
+func toUser(dbUser database.User, sub database.Subscription) *User {
+	user := &User{
+		ID:          dbUser.ID,
+		Email:       dbUser.Email,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		IsChirpyRed: billing.HasAccess(sub, time.Now().UTC()),
+		Role:        string(dbUser.Role),
+	}
+	if dbUser.BannedAt.Valid {
+		user.BannedAt = &dbUser.BannedAt.Time
+	}
+	return user
+}
+
+// subscription returns the user's subscription, the zero Subscription when
+// they never subscribed
+func (config *APIConfig) subscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := config.DBQueries.GetSubscriptionByUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Subscription{}, nil
+	}
+	return sub, err
+}
+
+// respondWithUser responds with the user and the membership their
+// subscription grants
+func (config *APIConfig) respondWithUser(w http.ResponseWriter, req *http.Request, code int, dbUser database.User) {
+	sub, err := config.subscription(req.Context(), dbUser.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the user's subscription", err)
+		return
+	}
+	utils.RespondWithJSON(w, code, toUser(dbUser, sub))
 }
 
 type userReqParams struct {
@@ -50,33 +92,20 @@ func (config *APIConfig) HandleCreateUser(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	user := &User{
-		ID:          dbUser.ID,
-		Email:       dbUser.Email,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		IsChirpyRed: dbUser.IsChirpyRed,
-	}
-	utils.RespondWithJSON(w, http.StatusCreated, user)
+	config.respondWithUser(w, req, http.StatusCreated, dbUser)
 }
 
 func (config *APIConfig) HandleChangeUser(w http.ResponseWriter, req *http.Request) {
-	// Check the auth req
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "bearer token is missing", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(bearerToken, string(config.SigningKey))
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "uh uh uh you didn't say the magic word", err)
+	authUser, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
 		return
 	}
 
 	// Parse update req
 	decoder := json.NewDecoder(req.Body)
 	userParams := &userReqParams{}
-	err = decoder.Decode(userParams)
+	err := decoder.Decode(userParams)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "update user params is not in a valid format", err)
 		return
@@ -91,19 +120,19 @@ func (config *APIConfig) HandleChangeUser(w http.ResponseWriter, req *http.Reque
 	updatedUser, err := config.DBQueries.UpdateUserById(req.Context(), database.UpdateUserByIdParams{
 		Email:          userParams.Email,
 		HashedPassword: hashedPassword,
-		ID:             userID,
+		ID:             authUser.ID,
 	})
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "error updating the user", err)
 		return
 	}
 
-	user := &User{
-		ID:          updatedUser.ID,
-		Email:       updatedUser.Email,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		IsChirpyRed: updatedUser.IsChirpyRed,
+	// Tokens issued with the old credentials should no longer work
+	err = config.Denylist.RevokeUser(req.Context(), authUser.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "error revoking the user's tokens", err)
+		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, user)
+
+	config.respondWithUser(w, req, http.StatusOK, updatedUser)
 }
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/utils"
+	"github.com/jlargs64/chirpy/internal/webhooks"
+)
+
+// deliveryHistoryLimit is how many of an endpoint's latest deliveries are listed
+const deliveryHistoryLimit = 100
+
+type createWebhookEndpointReq struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type webhookEndpointResp struct {
+	ID                  uuid.UUID  `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	// Secret is only set in the response to creating the endpoint
+	Secret string `json:"secret,omitempty"`
+}
+
+type webhookDeliveryResp struct {
+	ID             uuid.UUID  `json:"id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	CreatedAt      time.Time  `json:"created_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus *int32     `json:"response_status"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+func newWebhookEndpointResp(endpoint database.WebhookEndpoint) webhookEndpointResp {
+	resp := webhookEndpointResp{
+		ID:                  endpoint.ID,
+		URL:                 endpoint.Url,
+		EventTypes:          endpoint.EventTypes,
+		Enabled:             endpoint.Enabled,
+		ConsecutiveFailures: endpoint.ConsecutiveFailures,
+		CreatedAt:           endpoint.CreatedAt,
+	}
+	if endpoint.DisabledAt.Valid {
+		resp.DisabledAt = &endpoint.DisabledAt.Time
+	}
+	return resp
+}
+
+func newWebhookDeliveryResp(delivery database.WebhookDelivery) webhookDeliveryResp {
+	resp := webhookDeliveryResp{
+		ID:        delivery.ID,
+		EventID:   delivery.EventID,
+		EventType: delivery.EventType,
+		Status:    string(delivery.Status),
+		Attempts:  delivery.Attempts,
+		CreatedAt: delivery.CreatedAt,
+		LastError: delivery.LastError.String,
+	}
+	if delivery.Status == database.WebhookDeliveryStatusPending {
+		resp.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		resp.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.ResponseStatus.Valid {
+		resp.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	return resp
+}
+
+func (config *APIConfig) HandleCreateWebhookEndpoint(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := &createWebhookEndpointReq{}
+	err := decoder.Decode(params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "create webhook params is not in a valid format", err)
+		return
+	}
+	if err := webhooks.ValidateEndpointURL(params.URL, config.Platform == "dev"); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if !webhooks.ValidEventTypes(params.EventTypes) {
+		utils.RespondWithError(w, http.StatusBadRequest, "event_types must be a non empty list of known event types", errors.New("invalid event types"))
+		return
+	}
+
+	secret, err := webhooks.MakeSecret()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the webhook secret could not be generated", err)
+		return
+	}
+	endpoint, err := config.DBQueries.CreateWebhookEndpoint(req.Context(), database.CreateWebhookEndpointParams{
+		UserID:     user.ID,
+		Url:        params.URL,
+		Secret:     secret,
+		EventTypes: params.EventTypes,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the webhook endpoint could not be saved to the database", err)
+		return
+	}
+
+	resp := newWebhookEndpointResp(endpoint)
+	resp.Secret = secret
+	utils.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (config *APIConfig) HandleGetWebhookEndpoints(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	endpoints, err := config.DBQueries.GetWebhookEndpointsByUser(req.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get webhook endpoints", err)
+		return
+	}
+	resp := make([]webhookEndpointResp, len(endpoints))
+	for i, endpoint := range endpoints {
+		resp[i] = newWebhookEndpointResp(endpoint)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+func (config *APIConfig) HandleDeleteWebhookEndpoint(w http.ResponseWriter, req *http.Request) {
+	user, endpoint, ok := config.ownWebhookEndpointFromPath(w, req)
+	if !ok {
+		return
+	}
+	_, err := config.DBQueries.DeleteWebhookEndpoint(req.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpoint.ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not delete the webhook endpoint", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEnableWebhookEndpoint turns an endpoint back on after it was disabled
+// for failing
+func (config *APIConfig) HandleEnableWebhookEndpoint(w http.ResponseWriter, req *http.Request) {
+	user, endpoint, ok := config.ownWebhookEndpointFromPath(w, req)
+	if !ok {
+		return
+	}
+	endpoint, err := config.DBQueries.EnableWebhookEndpoint(req.Context(), database.EnableWebhookEndpointParams{
+		ID:     endpoint.ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not enable the webhook endpoint", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, newWebhookEndpointResp(endpoint))
+}
+
+// HandleGetWebhookDeliveries lists an endpoint's latest deliveries
+func (config *APIConfig) HandleGetWebhookDeliveries(w http.ResponseWriter, req *http.Request) {
+	_, endpoint, ok := config.ownWebhookEndpointFromPath(w, req)
+	if !ok {
+		return
+	}
+	deliveries, err := config.DBQueries.GetWebhookDeliveriesByEndpoint(req.Context(), database.GetWebhookDeliveriesByEndpointParams{
+		EndpointID: endpoint.ID,
+		Limit:      deliveryHistoryLimit,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get webhook deliveries", err)
+		return
+	}
+	resp := make([]webhookDeliveryResp, len(deliveries))
+	for i, delivery := range deliveries {
+		resp[i] = newWebhookDeliveryResp(delivery)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleRedeliverWebhook queues a past delivery to be sent again
+func (config *APIConfig) HandleRedeliverWebhook(w http.ResponseWriter, req *http.Request) {
+	_, endpoint, ok := config.ownWebhookEndpointFromPath(w, req)
+	if !ok {
+		return
+	}
+	deliveryUUID, err := uuid.Parse(req.PathValue("deliveryID"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "delivery id is not a valid uuid", err)
+		return
+	}
+	delivery, err := config.DBQueries.GetWebhookDeliveryById(req.Context(), deliveryUUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the webhook delivery", err)
+		return
+	}
+	if err != nil || delivery.EndpointID != endpoint.ID {
+		utils.RespondWithError(w, http.StatusNotFound, "webhook delivery could not be found", errors.New("webhook delivery not found"))
+		return
+	}
+	if !endpoint.Enabled {
+		utils.RespondWithError(w, http.StatusConflict, "the webhook endpoint is disabled", errors.New("webhook endpoint disabled"))
+		return
+	}
+
+	delivery, err = config.Webhooks.Redeliver(req.Context(), delivery.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not queue the webhook delivery", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusAccepted, newWebhookDeliveryResp(delivery))
+}
+
+// ownWebhookEndpointFromPath gets the endpoint in the path, which must belong
+// to the user. Other users' endpoints are reported as not found.
+func (config *APIConfig) ownWebhookEndpointFromPath(w http.ResponseWriter, req *http.Request) (database.User, database.WebhookEndpoint, bool) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return database.User{}, database.WebhookEndpoint{}, false
+	}
+	endpointUUID, err := uuid.Parse(req.PathValue("endpointID"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "endpoint id is not a valid uuid", err)
+		return database.User{}, database.WebhookEndpoint{}, false
+	}
+	endpoint, err := config.DBQueries.GetWebhookEndpointById(req.Context(), endpointUUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get the webhook endpoint", err)
+		return database.User{}, database.WebhookEndpoint{}, false
+	}
+	if err != nil || endpoint.UserID != user.ID {
+		utils.RespondWithError(w, http.StatusNotFound, "webhook endpoint could not be found", errors.New("webhook endpoint not found"))
+		return database.User{}, database.WebhookEndpoint{}, false
+	}
+	return user, endpoint, true
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+const (
+	defaultWebhookEventsLimit = 50
+	maxWebhookEventsLimit     = 500
+)
+
+type WebhookEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	Provider  string          `json:"provider"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	// RawPayload holds deliveries whose body isn't JSON
+	RawPayload  string     `json:"raw_payload,omitempty"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	ProcessedAt *time.Time `json:"processed_at"`
+	Outcome     string     `json:"outcome"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int32      `json:"attempts"`
+}
+
+func toWebhookEvent(event database.WebhookEvent, withPayload bool) WebhookEvent {
+	resp := WebhookEvent{
+		ID:         event.ID,
+		Provider:   event.Provider,
+		EventID:    event.EventID,
+		EventType:  event.EventType,
+		ReceivedAt: event.ReceivedAt,
+		Outcome:    string(event.Outcome),
+		Error:      event.Error.String,
+		Attempts:   event.Attempts,
+	}
+	if withPayload {
+		if json.Valid([]byte(event.Payload)) {
+			resp.Payload = json.RawMessage(event.Payload)
+		} else {
+			resp.RawPayload = event.Payload
+		}
+	}
+	if event.ProcessedAt.Valid {
+		resp.ProcessedAt = &event.ProcessedAt.Time
+	}
+	return resp
+}
+
+// HandleGetWebhookEvents lists received webhook events newest first, filtered
+// by the optional provider and outcome query params
+func (config *APIConfig) HandleGetWebhookEvents(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params := database.ListWebhookEventsParams{Limit: defaultWebhookEventsLimit}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxWebhookEventsLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and 500", err)
+			return
+		}
+		params.Limit = int32(parsed)
+	}
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "offset must not be negative", err)
+			return
+		}
+		params.Offset = int32(parsed)
+	}
+	if provider := query.Get("provider"); provider != "" {
+		params.Provider = sql.NullString{String: provider, Valid: true}
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		switch database.WebhookEventOutcome(outcome) {
+		case database.WebhookEventOutcomePending, database.WebhookEventOutcomeProcessed,
+			database.WebhookEventOutcomeIgnored, database.WebhookEventOutcomeFailed,
+			database.WebhookEventOutcomeUnhandled, database.WebhookEventOutcomeInvalid:
+			params.Outcome = database.NullWebhookEventOutcome{WebhookEventOutcome: database.WebhookEventOutcome(outcome), Valid: true}
+		default:
+			utils.RespondWithError(w, http.StatusBadRequest, "unknown outcome", errors.New("unknown outcome"))
+			return
+		}
+	}
+
+	events, err := config.DBQueries.ListWebhookEvents(req.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not get webhook events", err)
+		return
+	}
+	resp := make([]WebhookEvent, len(events))
+	for i, event := range events {
+		resp[i] = toWebhookEvent(event, false)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleGetWebhookEvent returns one webhook event with its raw payload
+func (config *APIConfig) HandleGetWebhookEvent(w http.ResponseWriter, req *http.Request) {
+	event, ok := config.webhookEventFromPath(w, req)
+	if !ok {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, toWebhookEvent(event, true))
+}
+
+// HandleReplayWebhookEvent processes a stored event again, whatever its
+// outcome, unless a delivery or another replay is processing it
+func (config *APIConfig) HandleReplayWebhookEvent(w http.ResponseWriter, req *http.Request) {
+	event, ok := config.webhookEventFromPath(w, req)
+	if !ok {
+		return
+	}
+	provider, ok := config.WebhookProviders.Provider(event.Provider)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "events from this provider can't be replayed", errors.New("unknown provider"))
+		return
+	}
+
+	if webhookErr := config.claimWebhookEvent(req.Context(), event.ID, true); webhookErr != nil {
+		utils.RespondWithError(w, webhookErr.status, webhookErr.msg, webhookErr.err)
+		return
+	}
+	retried, err := config.DBQueries.RetryWebhookEvent(req.Context(), event.ID)
+	if err != nil {
+		config.releaseWebhookEvent(req.Context(), event.ID)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not update the webhook event", err)
+		return
+	}
+
+	// A failed replay is reported through the event's outcome and error, only
+	// failing to record the outcome is an error here
+	event, webhookErr := config.processWebhookEvent(req.Context(), provider, retried.ID, []byte(retried.Payload))
+	if webhookErr != nil && event.ID == uuid.Nil {
+		utils.RespondWithError(w, webhookErr.status, webhookErr.msg, webhookErr.err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, toWebhookEvent(event, true))
+}
+
+func (config *APIConfig) webhookEventFromPath(w http.ResponseWriter, req *http.Request) (database.WebhookEvent, bool) {
+	eventUUID, err := uuid.Parse(req.PathValue("eventID"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "event id is not a valid uuid", err)
+		return database.WebhookEvent{}, false
+	}
+	event, err := config.DBQueries.GetWebhookEventById(req.Context(), eventUUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "webhook event could not be found", err)
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "could not get the webhook event", err)
+		}
+		return database.WebhookEvent{}, false
+	}
+	return event, true
+}
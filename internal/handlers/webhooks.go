@@ -1,66 +1,255 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/billing"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/logging"
 	"github.com/jlargs64/chirpy/internal/utils"
+	"github.com/jlargs64/chirpy/internal/webhooks"
 )
 
-type webhookEvent struct {
-	Event string         `json:"event"`
-	Data  map[string]any `json:"data"`
+// polkaProvider names Polka in the webhook event log
+const polkaProvider = "polka"
+
+// webhookError is why an event failed and the status the sender is given,
+// a 5XX makes the provider retry the delivery
+type webhookError struct {
+	status int
+	msg    string
+	err    error
 }
 
-func (config *APIConfig) HandlePolkaWebhook(w http.ResponseWriter, req *http.Request) {
-	// Check authorization
-	apiKey, err := auth.GetAPIKey(req.Header)
+func (e *webhookError) Error() string {
+	if e.err == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *webhookError) Unwrap() error {
+	return e.err
+}
+
+// polkaSignatureHeader carries the "t=...,v1=..." signature of signed deliveries
+const polkaSignatureHeader = "Polka-Signature"
+
+// maxWebhookBodySize bounds how much of a delivery is read before verifying it
+const maxWebhookBodySize = 1 << 20
+
+// HandleProviderWebhook receives deliveries from the provider named in the
+// path. Every authenticated delivery is recorded in the event log, including
+// ones with unknown event types or payloads that don't match their schema.
+func (config *APIConfig) HandleProviderWebhook(w http.ResponseWriter, req *http.Request) {
+	provider, ok := config.WebhookProviders.Provider(req.PathValue("provider"))
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "webhook provider could not be found", errors.New("unknown webhook provider"))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookBodySize))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "missing api key", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "the webhook body could not be read", err)
 		return
 	}
-	if apiKey != config.PolkaAPIKey {
-		utils.RespondWithError(w, http.StatusUnauthorized, "bad api key", err)
+
+	// Check authorization
+	if err := provider.Authenticate(req.Header, body); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "the webhook could not be authenticated", err)
 		return
 	}
-	// Parse webhook response
-	decoder := json.NewDecoder(req.Body)
-	var event webhookEvent
-	err = decoder.Decode(&event)
+
+	// Record the event, retried deliveries of a finished event are acknowledged
+	// without processing them again. Deliveries that can't be decoded are
+	// recorded too and marked invalid when they are processed.
+	// Only an id the provider sent dedupes deliveries, the same body can be a
+	// legitimate repeat of an event, e.g. a second renewal
+	event, _ := provider.Decode(body)
+	eventID := event.ID
+	if eventID == "" {
+		eventID = "delivery:" + uuid.NewString()
+	}
+	record, err := config.DBQueries.RecordWebhookEvent(req.Context(), database.RecordWebhookEventParams{
+		Provider:  provider.Name,
+		EventID:   eventID,
+		EventType: event.Type,
+		Payload:   string(body),
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "the webhook event schema was not in the expected format", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "the webhook event could not be recorded", err)
 		return
 	}
-
-	// Handle event types
-	eventType := event.Event
-	switch eventType {
-	case "user.upgraded":
-		upgradeUserToChirpyRed(config, w, req, event.Data)
-	default:
+	switch record.Outcome {
+	case database.WebhookEventOutcomeProcessed, database.WebhookEventOutcomeIgnored,
+		database.WebhookEventOutcomeUnhandled:
 		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-}
 
-func upgradeUserToChirpyRed(config *APIConfig, w http.ResponseWriter, req *http.Request, data map[string]any) {
-	userID, ok := data["user_id"].(string)
-	if !ok {
-		utils.RespondWithError(w, http.StatusBadRequest, "missing user id", errors.New("missing user id"))
+	// Only the delivery that claims the event processes it, a concurrent
+	// duplicate is turned away until the claim is released or goes stale
+	if webhookErr := config.claimWebhookEvent(req.Context(), record.ID, false); webhookErr != nil {
+		utils.RespondWithError(w, webhookErr.status, webhookErr.msg, webhookErr.err)
 		return
 	}
+	if _, webhookErr := config.processWebhookEvent(req.Context(), provider, record.ID, body); webhookErr != nil {
+		utils.RespondWithError(w, webhookErr.status, webhookErr.msg, webhookErr.err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookClaimTimeout is how long an event stays claimed by the request
+// processing it, an older claim was abandoned and can be taken over
+const webhookClaimTimeout = time.Minute
+
+// claimWebhookEvent marks the event as being processed by this request.
+// Finished events are only claimed when anyOutcome is set.
+func (config *APIConfig) claimWebhookEvent(ctx context.Context, recordID uuid.UUID, anyOutcome bool) *webhookError {
+	_, err := config.DBQueries.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		ID:          recordID,
+		AnyOutcome:  anyOutcome,
+		StaleBefore: time.Now().Add(-webhookClaimTimeout),
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &webhookError{http.StatusConflict, "the webhook event is already being processed", err}
+	case err != nil:
+		return &webhookError{http.StatusInternalServerError, "the webhook event could not be claimed", err}
+	}
+	return nil
+}
+
+// releaseWebhookEvent gives up the claim on an event that won't be processed,
+// if that fails too the claim is taken over once it goes stale
+func (config *APIConfig) releaseWebhookEvent(ctx context.Context, recordID uuid.UUID) {
+	if err := config.DBQueries.ReleaseWebhookEvent(ctx, recordID); err != nil {
+		logging.FromContext(ctx).Error("could not release the webhook event", "event_id", recordID, "error", err)
+	}
+}
 
-	userUUID, err := uuid.Parse(userID)
+// processWebhookEvent decodes and handles the delivery body and stores its
+// outcome in the event log, which releases the claim on the event
+func (config *APIConfig) processWebhookEvent(ctx context.Context, provider *webhooks.Provider, recordID uuid.UUID, body []byte) (database.WebhookEvent, *webhookError) {
+	event, err := provider.Decode(body)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "invalid user id", err)
-		return
+		return config.finishWebhookEvent(ctx, recordID, database.WebhookEventOutcomeInvalid, err)
+	}
+	if provider.Ignores(event.Type) {
+		return config.finishWebhookEvent(ctx, recordID, database.WebhookEventOutcomeIgnored, nil)
+	}
+	err = provider.Dispatch(ctx, event)
+	return config.finishWebhookEvent(ctx, recordID, database.WebhookEventOutcomeProcessed, err)
+}
+
+// finishWebhookEvent records the event's outcome, handleErr overrides it.
+// Unknown event types are acknowledged so the provider doesn't retry them,
+// invalid payloads are rejected and any other error fails the event.
+func (config *APIConfig) finishWebhookEvent(ctx context.Context, recordID uuid.UUID, outcome database.WebhookEventOutcome, handleErr error) (database.WebhookEvent, *webhookError) {
+	params := database.FinishWebhookEventParams{ID: recordID, Outcome: outcome}
+	var webhookErr *webhookError
+	if handleErr != nil {
+		params.Error = sql.NullString{String: handleErr.Error(), Valid: true}
+		switch {
+		case errors.Is(handleErr, webhooks.ErrUnknownEvent):
+			logging.FromContext(ctx).Warn("unhandled webhook event", "error", handleErr)
+			params.Outcome = database.WebhookEventOutcomeUnhandled
+		case errors.Is(handleErr, webhooks.ErrInvalidPayload):
+			params.Outcome = database.WebhookEventOutcomeInvalid
+			webhookErr = &webhookError{http.StatusBadRequest, "the webhook event schema was not in the expected format", handleErr}
+		case errors.As(handleErr, &webhookErr):
+			params.Outcome = database.WebhookEventOutcomeFailed
+		default:
+			params.Outcome = database.WebhookEventOutcomeFailed
+			webhookErr = &webhookError{http.StatusInternalServerError, "the webhook event could not be handled", handleErr}
+		}
 	}
-	_, err = config.DBQueries.UpgradeUserToChirpyRed(req.Context(), userUUID)
+
+	record, err := config.DBQueries.FinishWebhookEvent(ctx, params)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "user could not be upgraded in the database", err)
-		return
+		if webhookErr == nil {
+			webhookErr = &webhookError{http.StatusInternalServerError, "the webhook event outcome could not be recorded", err}
+		}
+		return record, webhookErr
 	}
-	w.WriteHeader(http.StatusNoContent)
+	config.Metrics.WebhookEvent(record.Provider, string(record.Outcome))
+	return record, webhookErr
+}
+
+// NewPolkaProvider authenticates Polka's signed deliveries and, while
+// PolkaAPIKey is set, the legacy ApiKey header for deliveries that aren't
+// signed. Polka's subscription events drive Chirpy Red billing.
+func (config *APIConfig) NewPolkaProvider() *webhooks.Provider {
+	provider := webhooks.NewProvider(polkaProvider, webhooks.Fallback(
+		webhooks.SignatureAuth(polkaSignatureHeader, config.PolkaVerifier),
+		webhooks.APIKeyAuth(config.PolkaAPIKey),
+	))
+	webhooks.Handle(provider, "user.upgraded", func(ctx context.Context, data polkaSubscriptionData) error {
+		_, err := config.Billing.Activate(ctx, data.UserID, data.period())
+		return subscriptionError(err)
+	})
+	webhooks.Handle(provider, "subscription.renewed", func(ctx context.Context, data polkaSubscriptionData) error {
+		_, err := config.Billing.Renew(ctx, data.UserID, data.period())
+		return subscriptionError(err)
+	})
+	webhooks.Handle(provider, "subscription.canceled", func(ctx context.Context, data polkaSubscriptionData) error {
+		_, err := config.Billing.Cancel(ctx, data.UserID)
+		return subscriptionError(err)
+	})
+	webhooks.Handle(provider, "subscription.payment_failed", func(ctx context.Context, data polkaSubscriptionData) error {
+		_, err := config.Billing.PaymentFailed(ctx, data.UserID)
+		return subscriptionError(err)
+	})
+	webhooks.Handle(provider, "user.downgraded", func(ctx context.Context, data polkaSubscriptionData) error {
+		_, err := config.Billing.Downgrade(ctx, data.UserID)
+		return subscriptionError(err)
+	})
+	return provider
+}
+
+// polkaSubscriptionData is the data of Polka's subscription events, the plan
+// and period are optional
+type polkaSubscriptionData struct {
+	UserID      uuid.UUID  `json:"user_id"`
+	Plan        string     `json:"plan"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end"`
+}
+
+func (d polkaSubscriptionData) Validate() error {
+	if d.UserID == uuid.Nil {
+		return errors.New("missing user_id")
+	}
+	if d.PeriodStart != nil && d.PeriodEnd != nil && !d.PeriodEnd.After(*d.PeriodStart) {
+		return errors.New("period_end must be after period_start")
+	}
+	return nil
+}
+
+func (d polkaSubscriptionData) period() billing.Period {
+	period := billing.Period{Plan: d.Plan}
+	if d.PeriodStart != nil {
+		period.Start = *d.PeriodStart
+	}
+	if d.PeriodEnd != nil {
+		period.End = *d.PeriodEnd
+	}
+	return period
+}
+
+// subscriptionError gives billing errors the status Polka is sent
+func subscriptionError(err error) error {
+	switch {
+	case errors.Is(err, billing.ErrUnknownUser), errors.Is(err, billing.ErrNoSubscription):
+		return &webhookError{http.StatusNotFound, err.Error(), err}
+	case err != nil:
+		return &webhookError{http.StatusInternalServerError, "the subscription could not be updated in the database", err}
+	}
+	return nil
 }
@@ -0,0 +1,158 @@
+// Package health runs the checks behind the readiness probe
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each check when the Checker has no timeout set
+const DefaultTimeout = time.Second * 2
+
+// Statuses of a check and of the whole report
+const (
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check is a dependency the API needs to serve requests. A failing optional
+// check degrades the report but leaves the API ready.
+type Check struct {
+	Name     string
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness probe's body
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every required check passed
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+// Checker runs its checks concurrently, each with its own timeout
+type Checker struct {
+	Timeout time.Duration
+	Checks  []Check
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{Timeout: timeout, Checks: checks}
+}
+
+// Run runs every check, a nil Checker has no checks and is always ready
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: []Result{}}
+	if c == nil {
+		return report
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	report.Checks = make([]Result, len(c.Checks))
+	var wg sync.WaitGroup
+	for i, check := range c.Checks {
+		wg.Go(func() {
+			report.Checks[i] = run(ctx, check, timeout)
+		})
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusOK {
+			continue
+		}
+		if !result.Optional {
+			report.Status = StatusUnavailable
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+func run(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- check.Run(ctx) }()
+	// Checks that ignore ctx still can't hold up the probe
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusOK,
+		Optional:  check.Optional,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("timed out after %s", timeout)
+		}
+	}
+	return result
+}
+
+// Pinger is satisfied by *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Database checks the database accepts connections
+func Database(db Pinger) Check {
+	return Check{Name: "database", Run: db.PingContext}
+}
+
+// MigrationStatus is satisfied by *goose.Provider
+type MigrationStatus interface {
+	HasPending(ctx context.Context) (bool, error)
+	GetVersions(ctx context.Context) (current, target int64, err error)
+}
+
+// Migrations checks every embedded migration has been applied
+func Migrations(migrations MigrationStatus) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		pending, err := migrations.HasPending(ctx)
+		if err != nil {
+			return err
+		}
+		if !pending {
+			return nil
+		}
+		current, target, err := migrations.GetVersions(ctx)
+		if err != nil {
+			return errors.New("migrations are pending")
+		}
+		return fmt.Errorf("migrations are pending, the database is at version %d of %d", current, target)
+	}}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pass(context.Context) error { return nil }
+
+func fail(context.Context) error { return errors.New("connection refused") }
+
+// hang ignores ctx so the checker's own timeout has to stop it
+func hang(context.Context) error {
+	time.Sleep(time.Second)
+	return nil
+}
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus string
+		wantReady  bool
+		wantErrors map[string]string
+	}{
+		{
+			name:       "No checks",
+			wantStatus: StatusOK,
+			wantReady:  true,
+		},
+		{
+			name: "Every check passes",
+			checks: []Check{
+				{Name: "database", Run: pass},
+				{Name: "webhook_queue", Optional: true, Run: pass},
+			},
+			wantStatus: StatusOK,
+			wantReady:  true,
+		},
+		{
+			name: "Optional check fails",
+			checks: []Check{
+				{Name: "database", Run: pass},
+				{Name: "webhook_queue", Optional: true, Run: fail},
+			},
+			wantStatus: StatusDegraded,
+			wantReady:  true,
+			wantErrors: map[string]string{"webhook_queue": "connection refused"},
+		},
+		{
+			name: "Required check fails",
+			checks: []Check{
+				{Name: "webhook_queue", Optional: true, Run: fail},
+				{Name: "database", Run: fail},
+			},
+			wantStatus: StatusUnavailable,
+			wantErrors: map[string]string{"database": "connection refused", "webhook_queue": "connection refused"},
+		},
+		{
+			name:       "Check times out",
+			checks:     []Check{{Name: "database", Run: hang}},
+			wantStatus: StatusUnavailable,
+			wantErrors: map[string]string{"database": "timed out after 10ms"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			report := NewChecker(time.Millisecond*10, tt.checks...).Run(context.Background())
+			if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+				t.Errorf("expected the checks to be cut off by the timeout, took %s", elapsed)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, report.Status)
+			}
+			if report.Ready() != tt.wantReady {
+				t.Errorf("expected ready to be %v", tt.wantReady)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Fatalf("expected %d results, got %d", len(tt.checks), len(report.Checks))
+			}
+			for i, result := range report.Checks {
+				if result.Name != tt.checks[i].Name {
+					t.Errorf("expected results in the order of the checks, got %q at %d", result.Name, i)
+				}
+				wantErr, failed := tt.wantErrors[result.Name]
+				if failed != (result.Status == StatusFailed) || !strings.Contains(result.Error, wantErr) {
+					t.Errorf("unexpected result for %s: %+v", result.Name, result)
+				}
+			}
+		})
+	}
+
+	t.Run("Nil checker is ready", func(t *testing.T) {
+		var c *Checker
+		if report := c.Run(context.Background()); !report.Ready() || report.Checks == nil {
+			t.Errorf("expected a ready report with no checks, got %+v", report)
+		}
+	})
+}
+
+type fakeMigrations struct {
+	pending bool
+	err     error
+}
+
+func (m fakeMigrations) HasPending(context.Context) (bool, error) {
+	return m.pending, m.err
+}
+
+func (m fakeMigrations) GetVersions(context.Context) (int64, int64, error) {
+	return 15, 16, nil
+}
+
+func TestMigrations(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations fakeMigrations
+		wantErr    string
+	}{
+		{"Up to date", fakeMigrations{}, ""},
+		{"Pending", fakeMigrations{pending: true}, "version 15 of 16"},
+		{"Database error", fakeMigrations{err: errors.New("connection refused")}, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Migrations(tt.migrations).Run(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
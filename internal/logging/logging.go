@@ -0,0 +1,182 @@
+// Package logging sets up structured logging and gives every request an id
+// and a logger carrying it
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is read from requests and set on every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request ids that are kept
+const maxRequestIDLength = 128
+
+// Formats the logs can be written in
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	requestContextKey
+)
+
+// New returns a logger writing format to out
+func New(out io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	}
+	return nil, fmt.Errorf("log format must be %q or %q, not %q", FormatJSON, FormatText, format)
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext returns the request's logger, or the default logger outside of
+// a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// RequestID returns the id of the request ctx belongs to
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestContextKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// WithUserID adds the authenticated user to the request's logger and its
+// access log
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	if info, ok := ctx.Value(requestContextKey).(*requestInfo); ok {
+		info.userID = userID
+	}
+	return WithLogger(ctx, FromContext(ctx).With("user_id", userID))
+}
+
+// requestInfo is filled in by handlers for the access log
+type requestInfo struct {
+	id     string
+	userID uuid.UUID
+}
+
+// Middleware gives each request an id, reusing a well formed X-Request-ID, and
+// a logger carrying it, then writes an access log line once it is served
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: req.Header.Get(RequestIDHeader)}
+		if !validRequestID(info.id) {
+			info.id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+
+		reqLogger := logger.With("request_id", info.id)
+		ctx := context.WithValue(req.Context(), requestContextKey, info)
+		ctx = WithLogger(ctx, reqLogger)
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		inner := req.WithContext(ctx)
+		next.ServeHTTP(rw, inner)
+
+		// The mux sets the pattern on the request it was given, copy it back
+		// so the middlewares this one is wrapped in see the route too
+		req.Pattern = inner.Pattern
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("route", req.Pattern),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", rw.status),
+			slog.Int("bytes", rw.bytes),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if info.userID != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", info.userID.String()))
+		}
+		level := slog.LevelInfo
+		if rw.err != nil {
+			attrs = append(attrs, slog.String("error", rw.err.Error()))
+		}
+		if rw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		reqLogger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// RecordError attaches err to the access log of the request w responds to,
+// outside of Middleware it is logged straight away
+func RecordError(w http.ResponseWriter, err error) {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			rw.err = err
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			slog.Error("request failed", "error", err)
+			return
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '-' || r == '_' || r == '.' || r == ':')
+	})
+}
+
+// responseWriter records what was written for the access log
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	err         error
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
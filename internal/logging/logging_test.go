@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMiddleware(t *testing.T) {
+	userID := uuid.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, req *http.Request) {
+		ctx := WithUserID(req.Context(), userID)
+		FromContext(ctx).Info("handling")
+		RecordError(w, errors.New("chirp not found"))
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantKept  bool
+	}{
+		{"Incoming request id is kept", "req-123.abc", true},
+		{"Missing request id is generated", "", false},
+		{"Malformed request id is replaced", "bad id\n", false},
+		{"Overlong request id is replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := New(&out, FormatJSON, slog.LevelInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			Middleware(logger, mux).ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if tt.wantKept && requestID != tt.requestID {
+				t.Errorf("expected request id %q, got %q", tt.requestID, requestID)
+			}
+			if !tt.wantKept && (requestID == tt.requestID || !validRequestID(requestID)) {
+				t.Errorf("expected a generated request id, got %q", requestID)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("expected a handler log and an access log, got %q", out.String())
+			}
+			var handlerLog, accessLog map[string]any
+			if err := json.Unmarshal([]byte(lines[0]), &handlerLog); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(lines[1]), &accessLog); err != nil {
+				t.Fatal(err)
+			}
+			if handlerLog["request_id"] != requestID || handlerLog["user_id"] != userID.String() {
+				t.Errorf("expected the handler's logger to carry the request and user, got %v", handlerLog)
+			}
+			want := map[string]any{
+				"request_id": requestID,
+				"method":     "GET",
+				"route":      "GET /api/chirps/{chirpID}",
+				"status":     float64(http.StatusNotFound),
+				"user_id":    userID.String(),
+				"error":      "chirp not found",
+			}
+			for key, value := range want {
+				if accessLog[key] != value {
+					t.Errorf("expected access log %s = %v, got %v", key, value, accessLog[key])
+				}
+			}
+			if _, ok := accessLog["latency"]; !ok {
+				t.Error("expected the access log to have the latency")
+			}
+		})
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != slog.Default() {
+		t.Error("expected the default logger outside of a request")
+	}
+}
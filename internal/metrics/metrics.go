@@ -0,0 +1,184 @@
+// Package metrics exports chirpy's Prometheus metrics. Every method is safe to
+// call on a nil *Metrics so metrics stay optional.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chirpy"
+
+// Login methods and results
+const (
+	LoginPassword = "password"
+	LoginOAuth    = "oauth"
+
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginLocked  = "locked"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths can't
+// grow the number of series
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	Registry          *prometheus.Registry
+	requests          *prometheus.CounterVec
+	duration          *prometheus.HistogramVec
+	inFlight          prometheus.Gauge
+	logins            *prometheus.CounterVec
+	webhookEvents     *prometheus.CounterVec
+	webhookDeliveries *prometheus.CounterVec
+}
+
+// New registers the API's metrics along with the Go runtime, process and db
+// pool stats
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served by route and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being served.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Password logins by method and result.",
+		}, []string{"method", "result"}),
+		webhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_events_total",
+			Help:      "Received webhook events by provider and outcome.",
+		}, []string{"provider", "outcome"}),
+		webhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_delivery_attempts_total",
+			Help:      "Outbound webhook delivery attempts by resulting status.",
+		}, []string{"status"}),
+	}
+	m.Registry.MustRegister(
+		m.requests, m.duration, m.inFlight, m.logins, m.webhookEvents, m.webhookDeliveries,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format. When token
+// is set scrapers must send it as a bearer token.
+func (m *Metrics) Handler(token string) http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	handler := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+	if token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bearer, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// Middleware counts and times requests by the route pattern they matched
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, req)
+
+		// The mux sets the pattern on the request it was given
+		route := req.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.requests.WithLabelValues(req.Method, route, strconv.Itoa(rw.status)).Inc()
+		m.duration.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// LoginAttempt counts a login by method with its result
+func (m *Metrics) LoginAttempt(method, result string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(method, result).Inc()
+}
+
+// WebhookEvent counts a received webhook event's outcome
+func (m *Metrics) WebhookEvent(provider, outcome string) {
+	if m == nil {
+		return
+	}
+	m.webhookEvents.WithLabelValues(provider, outcome).Inc()
+}
+
+// WebhookDelivery counts an outbound delivery attempt by the status it left
+// the delivery in
+func (m *Metrics) WebhookDelivery(status string) {
+	if m == nil {
+		return
+	}
+	m.webhookDeliveries.WithLabelValues(status).Inc()
+}
+
+// statusWriter records the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController and logging reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, handler http.Handler, token string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Result().Body)
+	return w.Code, string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := m.Middleware(mux)
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	m.LoginAttempt(LoginPassword, LoginFailure)
+	m.WebhookEvent("polka", "processed")
+	m.WebhookDelivery("failed")
+
+	code, body := scrape(t, m.Handler(""), "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	for _, want := range []string{
+		`chirpy_http_requests_total{method="GET",route="GET /api/chirps/{chirpID}",status="404"} 2`,
+		`chirpy_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`chirpy_http_request_duration_seconds_count{method="GET",route="GET /api/chirps/{chirpID}"} 2`,
+		`chirpy_http_requests_in_flight 0`,
+		`chirpy_logins_total{method="password",result="failure"} 1`,
+		`chirpy_webhook_events_total{outcome="processed",provider="polka"} 1`,
+		`chirpy_webhook_delivery_attempts_total{status="failed"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the metrics to contain %s", want)
+		}
+	}
+
+	t.Run("Token required", func(t *testing.T) {
+		handler := m.Handler("scrape-token")
+		if code, _ := scrape(t, handler, ""); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without the token, got %d", code)
+		}
+		if code, _ := scrape(t, handler, "wrong"); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with the wrong token, got %d", code)
+		}
+		if code, _ := scrape(t, handler, "scrape-token"); code != http.StatusOK {
+			t.Errorf("expected 200 with the token, got %d", code)
+		}
+	})
+
+	t.Run("Nil metrics are a no-op", func(t *testing.T) {
+		var m *Metrics
+		m.LoginAttempt(LoginPassword, LoginSuccess)
+		if m.Middleware(mux) == nil {
+			t.Error("expected the handler to be passed through")
+		}
+	})
+}
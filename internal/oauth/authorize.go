@@ -0,0 +1,277 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/metrics"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+// scopeDescriptions are shown to users on the consent screen
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeChirpsRead:    "Read chirps",
+	auth.ScopeChirpsWrite:   "Post and delete chirps as you",
+	auth.ScopeWebhooksWrite: "Get notified when you post or delete chirps",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<html>
+  <body>
+    <h1>Authorize {{.ClientName}}</h1>
+    <p>{{.ClientName}} would like to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>
+      {{end}}
+    </ul>
+    {{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+    <form method="post" action="{{.Action}}">
+      {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+      {{end}}
+      <label>Email <input type="email" name="email" required></label>
+      <label>Password <input type="password" name="password" required></label>
+      <button type="submit" name="decision" value="allow">Allow</button>
+      <button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+    </form>
+  </body>
+</html>`))
+
+type consentPage struct {
+	ClientName string
+	Scopes     []string
+	Error      string
+	Action     string
+	Params     map[string]string
+}
+
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	state         string
+	scopes        []auth.Scope
+	codeChallenge string
+}
+
+// HandleAuthorize shows the consent screen on GET and handles the user's
+// decision on POST, redirecting back to the client with a code or an error
+func (s *Server) HandleAuthorize(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "the authorization request is not in a valid format", err)
+		return
+	}
+	params := req.Form
+	if req.Method == http.MethodPost {
+		params = req.PostForm
+	}
+
+	authReq, oauthErr := s.parseAuthorizeRequest(req, params)
+	if oauthErr != nil {
+		// Never redirect to a uri that isn't registered to the client
+		if authReq == nil {
+			utils.RespondWithError(w, oauthErr.status, oauthErr.description, oauthErr.err)
+			return
+		}
+		redirectWithError(w, req, authReq, oauthErr)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		renderConsent(w, req, http.StatusOK, authReq, params, "")
+		return
+	}
+
+	if params.Get("decision") != "allow" {
+		redirectWithError(w, req, authReq, newOAuthError(http.StatusForbidden, errAccessDenied, "the user denied the request", nil))
+		return
+	}
+
+	// Authenticate the resource owner
+	email, clientIP := params.Get("email"), auth.ClientIP(req)
+	if s.LoginThrottle != nil {
+		retryAfter, err := s.LoginThrottle.RetryAfter(req.Context(), email, clientIP)
+		if err != nil {
+			redirectWithError(w, req, authReq, newOAuthError(http.StatusInternalServerError, errServerError, "could not check for login lockouts", err))
+			return
+		}
+		if retryAfter > 0 {
+			s.Metrics.LoginAttempt(metrics.LoginOAuth, metrics.LoginLocked)
+			w.Header().Set("Retry-After", auth.RetryAfterSeconds(retryAfter))
+			renderConsent(w, req, http.StatusTooManyRequests, authReq, params, "too many failed logins, try again later")
+			return
+		}
+	}
+	user, err := s.Store.GetUserByEmail(req.Context(), email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		redirectWithError(w, req, authReq, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the user", err))
+		return
+	}
+	var ok bool
+	if err != nil {
+		auth.CheckDummyPassword(params.Get("password"))
+	} else {
+		ok, _ = auth.CheckPasswordHash(params.Get("password"), user.HashedPassword)
+	}
+	if !ok {
+		s.Metrics.LoginAttempt(metrics.LoginOAuth, metrics.LoginFailure)
+		s.recordLoginFailure(req, email, clientIP)
+		renderConsent(w, req, http.StatusUnauthorized, authReq, params, "the email or password do not match")
+		return
+	}
+	if user.BannedAt.Valid {
+		renderConsent(w, req, http.StatusForbidden, authReq, params, auth.ErrUserBanned.Error())
+		return
+	}
+	s.Metrics.LoginAttempt(metrics.LoginOAuth, metrics.LoginSuccess)
+	if s.LoginThrottle != nil {
+		if err := s.LoginThrottle.RecordSuccess(req.Context(), email); err != nil {
+			logging.FromContext(req.Context()).Error("could not reset failed logins", "error", err)
+		}
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		redirectWithError(w, req, authReq, newOAuthError(http.StatusInternalServerError, errServerError, "the code could not be generated", err))
+		return
+	}
+	_, err = s.Store.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      authReq.client.ID,
+		UserID:        user.ID,
+		RedirectUri:   authReq.redirectURI,
+		Scopes:        scopeNames(authReq.scopes),
+		CodeChallenge: authReq.codeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(authorizationCodeExpiry),
+	})
+	if err != nil {
+		redirectWithError(w, req, authReq, newOAuthError(http.StatusInternalServerError, errServerError, "the code could not be saved", err))
+		return
+	}
+
+	redirectToClient(w, req, authReq, url.Values{"code": {code}})
+}
+
+func (s *Server) recordLoginFailure(req *http.Request, email, clientIP string) {
+	if s.LoginThrottle == nil {
+		return
+	}
+	if _, err := s.LoginThrottle.RecordFailure(req.Context(), email, clientIP); err != nil {
+		logging.FromContext(req.Context()).Error("could not record the failed login", "error", err)
+	}
+}
+
+// parseAuthorizeRequest validates the authorization request. When the returned
+// request is nil the client or redirect uri could not be trusted.
+func (s *Server) parseAuthorizeRequest(req *http.Request, params url.Values) (*authorizeRequest, *oauthError) {
+	clientID, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "client_id is not a valid uuid", err)
+	}
+	client, err := s.Store.GetOAuthClientById(req.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidClient, "unknown client", err)
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the client", err)
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "redirect_uri is not registered for the client", errors.New("unregistered redirect uri"))
+	}
+
+	authReq := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		state:         params.Get("state"),
+		codeChallenge: params.Get("code_challenge"),
+	}
+	if params.Get("response_type") != "code" {
+		return authReq, newOAuthError(http.StatusBadRequest, errUnsupportedResponseType, "response_type must be code", nil)
+	}
+	if params.Get("code_challenge_method") != "S256" || !validPKCEValue(authReq.codeChallenge) {
+		return authReq, newOAuthError(http.StatusBadRequest, errInvalidRequest, "a S256 code_challenge is required", nil)
+	}
+	scopes, ok := auth.ParseGrantableScopes(strings.Fields(params.Get("scope")))
+	if !ok || len(scopes) == 0 {
+		return authReq, newOAuthError(http.StatusBadRequest, errInvalidScope, "scope must list grantable scopes", nil)
+	}
+	authReq.scopes = scopes
+	return authReq, nil
+}
+
+func renderConsent(w http.ResponseWriter, req *http.Request, code int, authReq *authorizeRequest, params url.Values, errMsg string) {
+	page := consentPage{
+		ClientName: authReq.client.Name,
+		Error:      errMsg,
+		Action:     req.URL.Path,
+		Params:     map[string]string{},
+	}
+	for _, scope := range authReq.scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	for _, name := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "code_challenge", "code_challenge_method"} {
+		page.Params[name] = params.Get(name)
+	}
+
+	// The consent screen must not be framed by other sites
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		logging.FromContext(req.Context()).Error("could not render the consent screen", "error", err)
+	}
+}
+
+func redirectWithError(w http.ResponseWriter, req *http.Request, authReq *authorizeRequest, oauthErr *oauthError) {
+	if oauthErr.err != nil {
+		logging.RecordError(w, oauthErr.err)
+	}
+	redirectToClient(w, req, authReq, url.Values{
+		"error":             {oauthErr.code},
+		"error_description": {oauthErr.description},
+	})
+}
+
+func redirectToClient(w http.ResponseWriter, req *http.Request, authReq *authorizeRequest, values url.Values) {
+	// Registered uris were validated when the client was registered
+	redirectURL, _ := url.Parse(authReq.redirectURI)
+	query := redirectURL.Query()
+	for name, value := range values {
+		query[name] = value
+	}
+	if authReq.state != "" {
+		query.Set("state", authReq.state)
+	}
+	redirectURL.RawQuery = query.Encode()
+	http.Redirect(w, req, redirectURL.String(), http.StatusFound)
+}
+
+func scopeNames(scopes []auth.Scope) []string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return names
+}
+
+func toScopes(names []string) []auth.Scope {
+	scopes := make([]auth.Scope, len(names))
+	for i, name := range names {
+		scopes[i] = auth.Scope(name)
+	}
+	return scopes
+}
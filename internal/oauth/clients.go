@@ -0,0 +1,119 @@
+package oauth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+type registerClientReq struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Confidential clients can keep a secret, e.g. server side apps
+	Confidential bool `json:"confidential"`
+}
+
+type clientResp struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	// ClientSecret is only set in the response to registering the client
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// HandleRegisterClient registers a client owned by the authenticated user
+func (s *Server) HandleRegisterClient(w http.ResponseWriter, req *http.Request) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "user is unauthorized", errors.New("no user in request context"))
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := &registerClientReq{}
+	err := decoder.Decode(params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "register client params is not in a valid format", err)
+		return
+	}
+
+	// Validate client params
+	if len(params.Name) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "a client name is required", errors.New("missing client name"))
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "at least one redirect uri is required", errors.New("missing redirect uris"))
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "invalid redirect uri: "+err.Error(), err)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "the client secret could not be generated", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := s.Store.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		UserID:       user.ID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "the client could not be saved to the database", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, &clientResp{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		ClientSecret: secret,
+	})
+}
+
+// validateRedirectURI requires absolute https URIs without fragments, plain
+// http is only allowed for loopback addresses used by native apps
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return errors.New("must be an absolute uri")
+	}
+	if parsed.Fragment != "" {
+		return errors.New("must not contain a fragment")
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return errors.New("http is only allowed for loopback addresses")
+	default:
+		return errors.New("scheme must be https")
+	}
+}
@@ -0,0 +1,91 @@
+// Package oauth contains the OAuth 2.0 authorization server that lets third
+// party clients act on behalf of chirpy users
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/metrics"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+// authorizationCodeExpiry is how long clients have to exchange a code
+const authorizationCodeExpiry = time.Minute * 10
+
+// Store holds clients, authorization codes and the tokens issued to clients
+type Store interface {
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	GetOAuthClientById(ctx context.Context, id uuid.UUID) (database.OauthClient, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error)
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error)
+	CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	ConsumeOAuthRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+// Server serves the OAuth endpoints
+type Server struct {
+	Store      Store
+	SigningKey []byte
+	Denylist   *auth.Denylist
+	// LoginThrottle is optional, when set consent logins share the lockouts
+	// of the login endpoint
+	LoginThrottle *auth.LoginThrottle
+	// Metrics is optional, consent logins are counted with the oauth method
+	Metrics *metrics.Metrics
+}
+
+// RFC 6749 section 5.2 and 4.1.2.1 error codes
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errInvalidScope            = "invalid_scope"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errAccessDenied            = "access_denied"
+	errServerError             = "server_error"
+)
+
+type oauthError struct {
+	code        string
+	description string
+	status      int
+	err         error
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+func newOAuthError(status int, code, description string, err error) *oauthError {
+	return &oauthError{code: code, description: description, status: status, err: err}
+}
+
+type errorResp struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// respondWithOAuthError writes the JSON error body used by the token and
+// revocation endpoints
+func respondWithOAuthError(w http.ResponseWriter, oauthErr *oauthError) {
+	if oauthErr.err != nil {
+		logging.RecordError(w, oauthErr.err)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	utils.RespondWithJSON(w, oauthErr.status, &errorResp{
+		Error:            oauthErr.code,
+		ErrorDescription: oauthErr.description,
+	})
+}
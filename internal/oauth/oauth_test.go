@@ -0,0 +1,543 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+type fakeStore struct {
+	users         map[string]database.User
+	clients       map[uuid.UUID]database.OauthClient
+	codes         map[string]database.OauthAuthorizationCode
+	refreshTokens map[string]database.RefreshToken
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:         map[string]database.User{},
+		clients:       map[uuid.UUID]database.OauthClient{},
+		codes:         map[string]database.OauthAuthorizationCode{},
+		refreshTokens: map[string]database.RefreshToken{},
+	}
+}
+
+func (s *fakeStore) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	client := database.OauthClient{
+		ID:           uuid.New(),
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: arg.RedirectUris,
+	}
+	s.clients[client.ID] = client
+	return client, nil
+}
+
+func (s *fakeStore) GetOAuthClientById(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	client, ok := s.clients[id]
+	if !ok {
+		return database.OauthClient{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func (s *fakeStore) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	code := database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	}
+	s.codes[code.CodeHash] = code
+	return code, nil
+}
+
+func (s *fakeStore) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	code, ok := s.codes[codeHash]
+	if !ok || code.UsedAt.Valid {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+	code.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s.codes[codeHash] = code
+	return code, nil
+}
+
+func (s *fakeStore) CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	refreshToken := database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		ClientID:  arg.ClientID,
+		Scopes:    arg.Scopes,
+	}
+	s.refreshTokens[refreshToken.Token] = refreshToken
+	return refreshToken, nil
+}
+
+func (s *fakeStore) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refreshToken, nil
+}
+
+func (s *fakeStore) RevokeRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	refreshToken.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s.refreshTokens[token] = refreshToken
+	return refreshToken, nil
+}
+
+func (s *fakeStore) ConsumeOAuthRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok || refreshToken.RevokedAt.Valid {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return s.RevokeRefreshToken(ctx, token)
+}
+
+func (s *fakeStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	user, ok := s.users[email]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeStore) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+type fakeRevocationStore struct{}
+
+func (fakeRevocationStore) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	return 1, nil
+}
+
+func (fakeRevocationStore) CreateAccessTokenRevocation(ctx context.Context, arg database.CreateAccessTokenRevocationParams) (database.AccessTokenRevocation, error) {
+	return database.AccessTokenRevocation{UserID: arg.UserID, Jti: arg.Jti, ExpiresAt: arg.ExpiresAt, CreatedAt: time.Now().UTC()}, nil
+}
+
+func (fakeRevocationStore) GetActiveAccessTokenRevocations(ctx context.Context) ([]database.AccessTokenRevocation, error) {
+	return nil, nil
+}
+
+func (fakeRevocationStore) DeleteExpiredAccessTokenRevocations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+const (
+	testEmail       = "walt@breakingbad.com"
+	testPassword    = "04234"
+	testRedirectURI = "https://client.example.com/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type testEnv struct {
+	server *Server
+	store  *fakeStore
+	user   database.User
+	client clientResp
+}
+
+func newTestEnv(t *testing.T, confidential bool) *testEnv {
+	t.Helper()
+	hashedPassword, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("could not hash password: %v", err)
+	}
+	store := newFakeStore()
+	user := database.User{ID: uuid.New(), Email: testEmail, HashedPassword: hashedPassword}
+	store.users[user.Email] = user
+
+	env := &testEnv{
+		server: &Server{
+			Store:      store,
+			SigningKey: []byte("mysecrettoken"),
+			Denylist:   auth.NewDenylist(fakeRevocationStore{}, auth.AccessTokenExpiry),
+		},
+		store: store,
+		user:  user,
+	}
+
+	body, _ := json.Marshal(registerClientReq{Name: "Chirp Scheduler", RedirectURIs: []string{testRedirectURI}, Confidential: confidential})
+	req := httptest.NewRequest(http.MethodPost, "/api/oauth/clients", bytes.NewReader(body))
+	req = req.WithContext(auth.ContextWithUser(req.Context(), user))
+	rec := httptest.NewRecorder()
+	env.server.HandleRegisterClient(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("could not register client: %d %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env.client); err != nil {
+		t.Fatalf("could not decode client: %v", err)
+	}
+	return env
+}
+
+func challengeFor(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (env *testEnv) authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {env.client.ClientID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"chirps:read chirps:write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challengeFor(testVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func (env *testEnv) postForm(handler http.HandlerFunc, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// authorize approves the consent screen and returns the redirect back to the client
+func (env *testEnv) authorize(t *testing.T, params url.Values) *url.URL {
+	t.Helper()
+	rec := env.postForm(env.server.HandleAuthorize, "/api/oauth/authorize", params)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect but got %d %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect location: %v", err)
+	}
+	return location
+}
+
+func (env *testEnv) approvedParams() url.Values {
+	params := env.authorizeParams()
+	params.Set("email", testEmail)
+	params.Set("password", testPassword)
+	params.Set("decision", "allow")
+	return params
+}
+
+func decodeTokenResp(t *testing.T, rec *httptest.ResponseRecorder) tokenResp {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected tokens but got %d %s", rec.Code, rec.Body.String())
+	}
+	var resp tokenResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("could not decode tokens: %v", err)
+	}
+	return resp
+}
+
+func expectOAuthError(t *testing.T, rec *httptest.ResponseRecorder, wantStatus int, wantError string) {
+	t.Helper()
+	var resp errorResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != wantStatus || resp.Error != wantError {
+		t.Errorf("expected %d %s but got %d %s", wantStatus, wantError, rec.Code, rec.Body.String())
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	// Consent screen
+	req := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+env.authorizeParams().Encode(), nil)
+	rec := httptest.NewRecorder()
+	env.server.HandleAuthorize(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Chirp Scheduler") {
+		t.Fatalf("expected the consent screen but got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("the consent screen should not be frameable")
+	}
+
+	// Approve and exchange the code
+	location := env.authorize(t, env.approvedParams())
+	if location.Query().Get("state") != "xyz" {
+		t.Errorf("expected state to be passed back but got %q", location.Query().Get("state"))
+	}
+	code := location.Query().Get("code")
+	tokenForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {env.client.ClientID.String()},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	}
+	tokens := decodeTokenResp(t, env.postForm(env.server.HandleToken, "/api/oauth/token", tokenForm))
+	if tokens.TokenType != "Bearer" || tokens.Scope != "chirps:read chirps:write" {
+		t.Errorf("unexpected token response %+v", tokens)
+	}
+	claims, userID, err := auth.ParseJWT(tokens.AccessToken, string(env.server.SigningKey), env.server.Denylist)
+	if err != nil {
+		t.Fatalf("the access token is not valid: %v", err)
+	}
+	if userID != env.user.ID || claims.ClientID != env.client.ClientID.String() {
+		t.Errorf("the access token was issued to %v for %v", userID, claims.ClientID)
+	}
+	if slices.Contains(claims.Scopes(), auth.ScopeUsersWrite) {
+		t.Error("the access token should not hold session scopes")
+	}
+
+	// Codes are single use
+	expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", tokenForm), http.StatusBadRequest, errInvalidGrant)
+
+	// Refresh rotates the refresh token and can narrow scopes
+	refreshForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {env.client.ClientID.String()},
+		"refresh_token": {tokens.RefreshToken},
+		"scope":         {"chirps:read"},
+	}
+	refreshed := decodeTokenResp(t, env.postForm(env.server.HandleToken, "/api/oauth/token", refreshForm))
+	if refreshed.Scope != "chirps:read" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("unexpected refresh response %+v", refreshed)
+	}
+	expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", refreshForm), http.StatusBadRequest, errInvalidGrant)
+
+	widenForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {env.client.ClientID.String()},
+		"refresh_token": {refreshed.RefreshToken},
+		"scope":         {"chirps:read chirps:write"},
+	}
+	expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", widenForm), http.StatusBadRequest, errInvalidScope)
+
+	// Revoking the access token puts it on the denylist
+	rec = env.postForm(env.server.HandleRevoke, "/api/oauth/revoke", url.Values{
+		"client_id": {env.client.ClientID.String()},
+		"token":     {refreshed.AccessToken},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the token to be revoked but got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := auth.ValidateJWT(refreshed.AccessToken, string(env.server.SigningKey), env.server.Denylist); err == nil {
+		t.Error("expected the revoked access token to be rejected")
+	}
+
+	// Revoking the refresh token stops it from being used
+	env.postForm(env.server.HandleRevoke, "/api/oauth/revoke", url.Values{
+		"client_id": {env.client.ClientID.String()},
+		"token":     {refreshed.RefreshToken},
+	})
+	refreshForm.Set("refresh_token", refreshed.RefreshToken)
+	refreshForm.Del("scope")
+	expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", refreshForm), http.StatusBadRequest, errInvalidGrant)
+}
+
+// racingStore runs race between reading a refresh token and revoking it, like
+// a concurrent request with the same token
+type racingStore struct {
+	*fakeStore
+	race func()
+}
+
+func (s *racingStore) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	refreshToken, err := s.fakeStore.GetRefreshToken(ctx, token)
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return refreshToken, err
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	env := newTestEnv(t, false)
+	location := env.authorize(t, env.approvedParams())
+	tokens := decodeTokenResp(t, env.postForm(env.server.HandleToken, "/api/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {env.client.ClientID.String()},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	}))
+
+	refreshForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {env.client.ClientID.String()},
+		"refresh_token": {tokens.RefreshToken},
+	}
+	var raced *httptest.ResponseRecorder
+	env.server.Store = &racingStore{fakeStore: env.store, race: func() {
+		raced = env.postForm(env.server.HandleToken, "/api/oauth/token", refreshForm)
+	}}
+	rec := env.postForm(env.server.HandleToken, "/api/oauth/token", refreshForm)
+	decodeTokenResp(t, raced)
+	expectOAuthError(t, rec, http.StatusBadRequest, errInvalidGrant)
+}
+
+func TestTokenRequestErrors(t *testing.T) {
+	env := newTestEnv(t, false)
+	code := env.authorize(t, env.approvedParams()).Query().Get("code")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{
+			"Unknown client",
+			url.Values{"grant_type": {"authorization_code"}, "client_id": {uuid.NewString()}, "code": {code}},
+			http.StatusUnauthorized,
+			errInvalidClient,
+		},
+		{
+			"Unsupported grant",
+			url.Values{"grant_type": {"password"}, "client_id": {env.client.ClientID.String()}},
+			http.StatusBadRequest,
+			errUnsupportedGrantType,
+		},
+		{
+			"Wrong code verifier",
+			url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {env.client.ClientID.String()},
+				"code":          {code},
+				"redirect_uri":  {testRedirectURI},
+				"code_verifier": {strings.Repeat("a", 43)},
+			},
+			http.StatusBadRequest,
+			errInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", tt.form), tt.wantStatus, tt.wantError)
+		})
+	}
+}
+
+func TestConfidentialClient(t *testing.T) {
+	env := newTestEnv(t, true)
+	if env.client.ClientSecret == "" {
+		t.Fatal("expected a client secret for a confidential client")
+	}
+	code := env.authorize(t, env.approvedParams()).Query().Get("code")
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	}
+
+	// Missing secret
+	form.Set("client_id", env.client.ClientID.String())
+	expectOAuthError(t, env.postForm(env.server.HandleToken, "/api/oauth/token", form), http.StatusUnauthorized, errInvalidClient)
+
+	// HTTP Basic client authentication
+	form.Del("client_id")
+	req := httptest.NewRequest(http.MethodPost, "/api/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(env.client.ClientID.String(), env.client.ClientSecret)
+	rec := httptest.NewRecorder()
+	env.server.HandleToken(rec, req)
+	decodeTokenResp(t, rec)
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	t.Run("Unregistered redirect uri is never redirected to", func(t *testing.T) {
+		params := env.authorizeParams()
+		params.Set("redirect_uri", "https://evil.example.com/callback")
+		req := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+params.Encode(), nil)
+		rec := httptest.NewRecorder()
+		env.server.HandleAuthorize(rec, req)
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+			t.Errorf("expected a 400 without a redirect but got %d to %q", rec.Code, rec.Header().Get("Location"))
+		}
+	})
+
+	t.Run("Missing PKCE", func(t *testing.T) {
+		params := env.approvedParams()
+		params.Del("code_challenge")
+		location := env.authorize(t, params)
+		if location.Query().Get("error") != errInvalidRequest {
+			t.Errorf("expected %s but got %q", errInvalidRequest, location.Query().Get("error"))
+		}
+	})
+
+	t.Run("Ungrantable scope", func(t *testing.T) {
+		params := env.approvedParams()
+		params.Set("scope", "users:write")
+		location := env.authorize(t, params)
+		if location.Query().Get("error") != errInvalidScope {
+			t.Errorf("expected %s but got %q", errInvalidScope, location.Query().Get("error"))
+		}
+	})
+
+	t.Run("User denies", func(t *testing.T) {
+		params := env.approvedParams()
+		params.Set("decision", "deny")
+		location := env.authorize(t, params)
+		if location.Query().Get("error") != errAccessDenied || location.Query().Get("state") != "xyz" {
+			t.Errorf("expected %s with state but got %q", errAccessDenied, location.RawQuery)
+		}
+	})
+
+	t.Run("Wrong password shows the consent screen again", func(t *testing.T) {
+		params := env.approvedParams()
+		params.Set("password", "wrong")
+		rec := env.postForm(env.server.HandleAuthorize, "/api/oauth/authorize", params)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "do not match") {
+			t.Errorf("expected the consent screen with an error but got %d", rec.Code)
+		}
+	})
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		redirectURI string
+		wantErr     bool
+	}{
+		{"https://client.example.com/callback", false},
+		{"http://127.0.0.1:8000/callback", false},
+		{"http://localhost/callback", false},
+		{"http://client.example.com/callback", true},
+		{"https://client.example.com/callback#fragment", true},
+		{"/callback", true},
+		{"javascript:alert(1)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.redirectURI, func(t *testing.T) {
+			if err := validateRedirectURI(tt.redirectURI); (err != nil) != tt.wantErr {
+				t.Errorf("validateRedirectURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/utils"
+)
+
+type tokenResp struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// HandleToken exchanges authorization codes and refresh tokens for tokens
+func (s *Server) HandleToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "the token request is not in a valid format", err))
+		return
+	}
+
+	client, oauthErr := s.authenticateClient(w, req)
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	var resp *tokenResp
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		resp, oauthErr = s.exchangeAuthorizationCode(req, client)
+	case "refresh_token":
+		resp, oauthErr = s.exchangeRefreshToken(req, client)
+	default:
+		oauthErr = newOAuthError(http.StatusBadRequest, errUnsupportedGrantType, "grant_type must be authorization_code or refresh_token", nil)
+	}
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleRevoke revokes refresh and access tokens issued to the client as
+// described in RFC 7009
+func (s *Server) HandleRevoke(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "the revocation request is not in a valid format", err))
+		return
+	}
+
+	client, oauthErr := s.authenticateClient(w, req)
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+	token := req.PostForm.Get("token")
+	if token == "" {
+		respondWithOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "token is required", nil))
+		return
+	}
+
+	// Unknown tokens and tokens of other clients are ignored so the response
+	// can't be used to probe for valid tokens
+	refreshToken, err := s.Store.GetRefreshToken(req.Context(), token)
+	switch {
+	case err == nil:
+		if refreshToken.ClientID.Valid && refreshToken.ClientID.UUID == client.ID && !refreshToken.RevokedAt.Valid {
+			if _, err := s.Store.RevokeRefreshToken(req.Context(), token); err != nil {
+				respondWithOAuthError(w, newOAuthError(http.StatusServiceUnavailable, errServerError, "could not revoke the token", err))
+				return
+			}
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		claims, userID, err := auth.ParseJWT(token, string(s.SigningKey), nil)
+		if err == nil && claims.ClientID == client.ID.String() && claims.ExpiresAt != nil && s.Denylist != nil {
+			err = s.Denylist.RevokeToken(req.Context(), claims.ID, userID, claims.ExpiresAt.Time)
+			if err != nil {
+				respondWithOAuthError(w, newOAuthError(http.StatusServiceUnavailable, errServerError, "could not revoke the token", err))
+				return
+			}
+		}
+	default:
+		respondWithOAuthError(w, newOAuthError(http.StatusServiceUnavailable, errServerError, "could not get the token", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) exchangeAuthorizationCode(req *http.Request, client database.OauthClient) (*tokenResp, *oauthError) {
+	params := req.PostForm
+	code, err := s.Store.ConsumeOAuthAuthorizationCode(req.Context(), auth.HashToken(params.Get("code")))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the code is invalid or was already used", nil)
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the code", err)
+	}
+
+	if code.ClientID != client.ID || code.ExpiresAt.UTC().Before(time.Now().UTC()) {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the code is invalid or has expired", nil)
+	}
+	if code.RedirectUri != params.Get("redirect_uri") {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "redirect_uri does not match the authorization request", nil)
+	}
+	if !verifyPKCE(params.Get("code_verifier"), code.CodeChallenge) {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the code_verifier does not match the code_challenge", nil)
+	}
+
+	return s.issueTokens(req, client, code.UserID, toScopes(code.Scopes))
+}
+
+func (s *Server) exchangeRefreshToken(req *http.Request, client database.OauthClient) (*tokenResp, *oauthError) {
+	params := req.PostForm
+	refreshToken, err := s.Store.GetRefreshToken(req.Context(), params.Get("refresh_token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the refresh token is invalid", nil)
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the refresh token", err)
+	}
+	if !refreshToken.ClientID.Valid || refreshToken.ClientID.UUID != client.ID ||
+		refreshToken.RevokedAt.Valid || refreshToken.ExpiresAt.UTC().Before(time.Now().UTC()) {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the refresh token is invalid or has expired", nil)
+	}
+
+	// Clients may narrow but never widen the original grant
+	scopes := toScopes(refreshToken.Scopes)
+	if requested := params.Get("scope"); requested != "" {
+		requestedScopes := auth.ParseScopeString(requested)
+		for _, scope := range requestedScopes {
+			if !slices.Contains(scopes, scope) {
+				return nil, newOAuthError(http.StatusBadRequest, errInvalidScope, "scope exceeds the original grant", nil)
+			}
+		}
+		scopes = requestedScopes
+	}
+
+	// Rotate refresh tokens so a leaked one can only be used once. Revoking is
+	// conditional on the token still being active, when concurrent requests
+	// use the same token only the first one to revoke it gets new tokens.
+	_, err = s.Store.ConsumeOAuthRefreshToken(req.Context(), refreshToken.Token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the refresh token was already used", nil)
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "could not revoke the refresh token", err)
+	}
+	return s.issueTokens(req, client, refreshToken.UserID, scopes)
+}
+
+func (s *Server) issueTokens(req *http.Request, client database.OauthClient, userID uuid.UUID, scopes []auth.Scope) (*tokenResp, *oauthError) {
+	user, err := s.Store.GetUserById(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, "the user no longer exists", nil)
+		}
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the user", err)
+	}
+	if user.BannedAt.Valid {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidGrant, auth.ErrUserBanned.Error(), nil)
+	}
+	accessToken, err := auth.MakeClientJWT(user.ID, user.TokenVersion, client.ID, scopes, string(s.SigningKey), auth.AccessTokenExpiry)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "the access token could not be generated", err)
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "the refresh token could not be generated", err)
+	}
+	_, err = s.Store.CreateOAuthRefreshToken(req.Context(), database.CreateOAuthRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(auth.RefreshTokenExpiry),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    scopeNames(scopes),
+	})
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, errServerError, "the refresh token could not be saved to the database", err)
+	}
+
+	return &tokenResp{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.JoinScopes(scopes),
+	}, nil
+}
+
+// authenticateClient accepts client_secret_basic, client_secret_post and, for
+// public clients, a bare client_id
+func (s *Server) authenticateClient(w http.ResponseWriter, req *http.Request) (database.OauthClient, *oauthError) {
+	clientIDParam, secret, usedBasic := req.BasicAuth()
+	if usedBasic {
+		// RFC 6749 section 2.3.1 form encodes the credentials
+		clientIDParam, _ = url.QueryUnescape(clientIDParam)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientIDParam = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+
+	invalidClient := func(err error) *oauthError {
+		if usedBasic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		return newOAuthError(http.StatusUnauthorized, errInvalidClient, "client authentication failed", err)
+	}
+
+	clientID, err := uuid.Parse(clientIDParam)
+	if err != nil {
+		return database.OauthClient{}, invalidClient(err)
+	}
+	client, err := s.Store.GetOAuthClientById(req.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthClient{}, invalidClient(err)
+		}
+		return database.OauthClient{}, newOAuthError(http.StatusInternalServerError, errServerError, "could not get the client", err)
+	}
+
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, invalidClient(errors.New("bad client secret"))
+		}
+	} else if secret != "" {
+		return database.OauthClient{}, invalidClient(errors.New("public client sent a secret"))
+	}
+	return client, nil
+}
+
+// validPKCEValue checks the length and alphabet RFC 7636 allows for code
+// verifiers, S256 challenges are always 43 characters from the same alphabet
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	hash := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,115 @@
+// Package service runs the operations that take more than one statement, each
+// in one transaction, so handlers only translate between HTTP and them
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+var (
+	ErrChirpNotFound  = errors.New("the chirp could not be found")
+	ErrNotChirpAuthor = errors.New("the chirp was not written by the user")
+)
+
+// Service runs its operations in transactions started by Tx
+type Service struct {
+	Tx         database.Transactor
+	SigningKey []byte
+	// Now is overridden in tests
+	Now func() time.Time
+}
+
+func New(tx database.Transactor, signingKey []byte) *Service {
+	return &Service{Tx: tx, SigningKey: signingKey, Now: time.Now}
+}
+
+// Reset deletes every user and chirp
+func (s *Service) Reset(ctx context.Context) error {
+	return s.Tx.InTx(ctx, func(q database.Querier) error {
+		if err := q.ResetUsers(ctx); err != nil {
+			return fmt.Errorf("could not reset users: %w", err)
+		}
+		if err := q.ResetChirps(ctx); err != nil {
+			return fmt.Errorf("could not reset chirps: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteChirp deletes a chirp written by user, moderators can delete anyone's.
+// It returns the deleted chirp.
+func (s *Service) DeleteChirp(ctx context.Context, user database.User, chirpID uuid.UUID) (database.Chirp, error) {
+	var chirp database.Chirp
+	err := s.Tx.InTx(ctx, func(q database.Querier) error {
+		var err error
+		chirp, err = q.GetChirpById(ctx, chirpID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrChirpNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var deleted int64
+		if auth.HasRole(user.Role, database.UserRoleModerator) {
+			deleted, err = q.DeleteAnyChirpById(ctx, chirpID)
+		} else {
+			deleted, err = q.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: chirpID, UserID: user.ID})
+		}
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrNotChirpAuthor
+		}
+		return nil
+	})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// Session is the token pair a user is signed in with
+type Session struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// Login signs user in, the refresh token is only saved when the access token
+// could be made too. Banned users get auth.ErrUserBanned.
+func (s *Service) Login(ctx context.Context, user database.User) (Session, error) {
+	if user.BannedAt.Valid {
+		return Session{}, auth.ErrUserBanned
+	}
+	var session Session
+	err := s.Tx.InTx(ctx, func(q database.Querier) error {
+		refreshToken, err := auth.MakeRefreshToken()
+		if err != nil {
+			return fmt.Errorf("the refresh token could not be generated: %w", err)
+		}
+		dbRefreshToken, err := q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token:     refreshToken,
+			UserID:    user.ID,
+			ExpiresAt: s.Now().UTC().Add(auth.RefreshTokenExpiry),
+		})
+		if err != nil {
+			return fmt.Errorf("the refresh token could not be saved: %w", err)
+		}
+		accessToken, err := auth.MakeJWT(user.ID, user.TokenVersion, string(s.SigningKey), auth.AccessTokenExpiry)
+		if err != nil {
+			return fmt.Errorf("the jwt could not be generated: %w", err)
+		}
+		session = Session{AccessToken: accessToken, RefreshToken: dbRefreshToken.Token}
+		return nil
+	})
+	return session, err
+}
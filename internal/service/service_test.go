@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/database/memory"
+)
+
+const testSigningKey = "test-signing-key"
+
+// failingTx runs transactions on the store where resetting chirps fails
+type failingTx struct {
+	store *memory.Store
+}
+
+func (f failingTx) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	return f.store.InTx(ctx, func(q database.Querier) error {
+		return fn(failingQuerier{q})
+	})
+}
+
+type failingQuerier struct {
+	database.Querier
+}
+
+func (failingQuerier) ResetChirps(context.Context) error {
+	return errors.New("connection reset")
+}
+
+func createUser(t *testing.T, store *memory.Store, email string, role database.UserRole) database.User {
+	t.Helper()
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = store.UpdateUserRole(ctx, database.UpdateUserRoleParams{ID: user.ID, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	user := createUser(t, store, "walt@example.com", database.UserRoleUser)
+
+	if err := New(failingTx{store}, []byte(testSigningKey)).Reset(ctx); err == nil {
+		t.Fatal("expected the reset to fail")
+	}
+	if _, err := store.GetUserById(ctx, user.ID); err != nil {
+		t.Errorf("expected the users to be rolled back, got %v", err)
+	}
+
+	if err := New(store, []byte(testSigningKey)).Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetUserById(ctx, user.ID); err == nil {
+		t.Error("expected the users to be deleted")
+	}
+}
+
+func TestDeleteChirp(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	svc := New(store, []byte(testSigningKey))
+	walt := createUser(t, store, "walt@example.com", database.UserRoleUser)
+	saul := createUser(t, store, "saul@example.com", database.UserRoleUser)
+	mod := createUser(t, store, "mike@example.com", database.UserRoleModerator)
+	newChirp := func() uuid.UUID {
+		chirp, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: "say my name", UserID: walt.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID
+	}
+
+	tests := []struct {
+		name    string
+		user    database.User
+		chirpID uuid.UUID
+		wantErr error
+	}{
+		{"Author", walt, newChirp(), nil},
+		{"Someone else", saul, newChirp(), ErrNotChirpAuthor},
+		{"Moderator", mod, newChirp(), nil},
+		{"Missing", walt, uuid.New(), ErrChirpNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chirp, err := svc.DeleteChirp(ctx, tt.user, tt.chirpID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && chirp.ID != tt.chirpID {
+				t.Errorf("expected the deleted chirp to be returned, got %+v", chirp)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	user := createUser(t, store, "walt@example.com", database.UserRoleUser)
+
+	session, err := New(store, []byte(testSigningKey)).Login(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := auth.ValidateJWT(session.AccessToken, testSigningKey, nil)
+	if err != nil {
+		t.Fatalf("expected a valid access token, got %v", err)
+	}
+	if userID != user.ID {
+		t.Errorf("expected the access token to be for %s, got %s", user.ID, userID)
+	}
+	refreshToken, err := store.GetRefreshToken(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatalf("expected the refresh token to be saved, got %v", err)
+	}
+	if refreshToken.UserID != user.ID {
+		t.Errorf("expected the refresh token to be for %s, got %s", user.ID, refreshToken.UserID)
+	}
+
+	banned, err := store.SetUserBanned(ctx, database.SetUserBannedParams{ID: user.ID, Banned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(store, []byte(testSigningKey)).Login(ctx, banned); !errors.Is(err, auth.ErrUserBanned) {
+		t.Errorf("expected %v for a banned user, got %v", auth.ErrUserBanned, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Package sso signs users in through external OpenID Connect providers
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ProviderConfig configures an OpenID Connect provider
+type ProviderConfig struct {
+	// Name identifies the provider in routes and linked identities
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Identity is the verified user an ID token was issued for
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider runs the authorization code flow against one OpenID Connect provider
+type Provider struct {
+	name     string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider fetches the provider's discovery document and signing keys
+// location. The context is also used for later key fetches.
+func NewProvider(ctx context.Context, cfg ProviderConfig) (*Provider, error) {
+	discovered, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover the %s provider: %w", cfg.Name, err)
+	}
+
+	return &Provider{
+		name: cfg.Name,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL is where users are sent to sign in with the provider
+func (p *Provider) AuthCodeURL(state LoginState) string {
+	return p.config.AuthCodeURL(state.State,
+		oidc.Nonce(state.Nonce),
+		oauth2.S256ChallengeOption(state.Verifier))
+}
+
+// Exchange trades the code from the provider's callback for an ID token and
+// verifies its signature, issuer, audience, expiry and nonce
+func (p *Provider) Exchange(ctx context.Context, code string, state LoginState) (*Identity, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange the code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("the token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify the id token: %w", err)
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, errors.New("the id token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("could not read the id token claims: %w", err)
+	}
+	if claims.Email == "" {
+		return nil, errors.New("the id token has no email")
+	}
+
+	return &Identity{
+		Provider:      p.name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
@@ -0,0 +1,240 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "chirpy"
+	testKeyID    = "test-key"
+)
+
+// mockIdP is an in-process OpenID Connect provider
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// codes maps issued codes to the PKCE challenge and nonce they were issued for
+	codes map[string]mockAuthorization
+	// claims are put in the next ID token, tests tweak them to break verification
+	claims jwt.MapClaims
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": testKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, req *http.Request) {
+		_ = req.ParseForm()
+		idp.mu.Lock()
+		authorization, ok := idp.codes[req.PostForm.Get("code")]
+		delete(idp.codes, req.PostForm.Get("code"))
+		claims := jwt.MapClaims{}
+		for name, value := range idp.claims {
+			claims[name] = value
+		}
+		idp.mu.Unlock()
+
+		hash := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(hash[:]) != authorization.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		if _, ok := claims["nonce"]; !ok {
+			claims["nonce"] = authorization.nonce
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = testKeyID
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "provider-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            "provider-user-1",
+		"email":          "walt@breakingbad.com",
+		"email_verified": true,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	return idp
+}
+
+// authorize simulates the user signing in at the provider for the given
+// authorization url and returns the code the provider redirects back with
+func (idp *mockIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("bad authorization url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization request %s", parsed.RawQuery)
+	}
+	code := "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = mockAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	idp.mu.Unlock()
+	return code
+}
+
+func newTestProvider(t *testing.T, idp *mockIdP) *Provider {
+	t.Helper()
+	provider, err := NewProvider(context.Background(), ProviderConfig{
+		Name:        "mock",
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:8080/api/sso/mock/callback",
+	})
+	if err != nil {
+		t.Fatalf("could not create provider: %v", err)
+	}
+	return provider
+}
+
+func TestProviderExchange(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{"Valid id token", nil, false},
+		{"Wrong audience", jwt.MapClaims{"aud": "someone-else"}, true},
+		{"Wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, true},
+		{"Expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, true},
+		{"Replayed nonce", jwt.MapClaims{"nonce": "old-nonce"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			for name, value := range tt.claims {
+				idp.claims[name] = value
+			}
+			provider := newTestProvider(t, idp)
+			state, err := NewLoginState(provider.Name())
+			if err != nil {
+				t.Fatalf("could not create login state: %v", err)
+			}
+
+			code := idp.authorize(t, provider.AuthCodeURL(state))
+			identity, err := provider.Exchange(context.Background(), code, state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if identity.Subject != "provider-user-1" || identity.Email != "walt@breakingbad.com" || !identity.EmailVerified {
+				t.Errorf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+func TestProviderExchangeRequiresVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(t, idp)
+	state, _ := NewLoginState(provider.Name())
+	code := idp.authorize(t, provider.AuthCodeURL(state))
+
+	otherState, _ := NewLoginState(provider.Name())
+	state.Verifier = otherState.Verifier
+	if _, err := provider.Exchange(context.Background(), code, state); err == nil {
+		t.Error("expected the exchange to fail with the wrong code verifier")
+	}
+}
+
+func TestLoginStateCookie(t *testing.T) {
+	key := []byte("mysecrettoken")
+	state, _ := NewLoginState("mock")
+
+	rec := httptest.NewRecorder()
+	if err := SetLoginStateCookie(rec, state, key, true); err != nil {
+		t.Fatalf("could not set cookie: %v", err)
+	}
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("the cookie is missing security attributes: %+v", cookie)
+	}
+
+	readCookie := func(value, provider string) (LoginState, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/sso/"+provider+"/callback", nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: value})
+		return ReadLoginStateCookie(httptest.NewRecorder(), req, provider, key)
+	}
+
+	got, err := readCookie(cookie.Value, "mock")
+	if err != nil || got.State != state.State || got.Verifier != state.Verifier {
+		t.Errorf("expected the state back but got %+v (%v)", got, err)
+	}
+
+	encoded, signature, _ := strings.Cut(cookie.Value, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"provider":"mock","state":"forged"}`))
+	if _, err := readCookie(tampered+"."+signature, "mock"); err == nil {
+		t.Error("expected a tampered cookie to be rejected")
+	}
+	if _, err := readCookie(encoded+"."+signature, "other"); err == nil {
+		t.Error("expected a cookie for another provider to be rejected")
+	}
+}
@@ -0,0 +1,107 @@
+package sso
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+	"golang.org/x/oauth2"
+)
+
+// loginStateExpiry is how long users have to finish signing in with a provider
+const loginStateExpiry = time.Minute * 10
+
+// LoginState ties a provider callback to the browser that started the login
+type LoginState struct {
+	Provider  string    `json:"provider"`
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewLoginState(provider string) (LoginState, error) {
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		return LoginState{}, err
+	}
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		return LoginState{}, err
+	}
+	return LoginState{
+		Provider:  provider,
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().UTC().Add(loginStateExpiry),
+	}, nil
+}
+
+func stateCookieName(provider string) string {
+	return "chirpy_sso_" + provider
+}
+
+// SetLoginStateCookie stores the login state in a signed cookie so the
+// callback can be checked without any server side storage
+func SetLoginStateCookie(w http.ResponseWriter, state LoginState, key []byte, secure bool) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName(state.Provider),
+		Value:    encoded + "." + sign(encoded, key),
+		Path:     "/api/sso/" + state.Provider,
+		Expires:  state.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		// Lax so the cookie is sent on the provider's top level redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// ReadLoginStateCookie returns the login state for provider if the cookie is
+// present, correctly signed and not expired, and clears the cookie
+func ReadLoginStateCookie(w http.ResponseWriter, req *http.Request, provider string, key []byte) (LoginState, error) {
+	cookie, err := req.Cookie(stateCookieName(provider))
+	if err != nil {
+		return LoginState{}, errors.New("the login state cookie is missing")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   cookie.Name,
+		Path:   "/api/sso/" + provider,
+		MaxAge: -1,
+	})
+
+	encoded, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(encoded, key))) {
+		return LoginState{}, errors.New("the login state cookie is invalid")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return LoginState{}, err
+	}
+	var state LoginState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return LoginState{}, err
+	}
+	if state.Provider != provider || state.ExpiresAt.Before(time.Now().UTC()) {
+		return LoginState{}, errors.New("the login state has expired")
+	}
+	return state, nil
+}
+
+func sign(value string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sso-state:" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,216 @@
+// Package tracing sets up OpenTelemetry tracing for http requests and database
+// queries
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer for spans started here
+const instrumentationName = "github.com/jlargs64/chirpy/internal/tracing"
+
+// Exporters spans can be sent to
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Options choose where spans are exported and how many are sampled
+type Options struct {
+	Exporter string
+	// Endpoint is the OTLP http endpoint, e.g. localhost:4318. When it is
+	// empty the standard OTEL_EXPORTER_OTLP_* env vars are used.
+	Endpoint string
+	// Insecure sends OTLP over http rather than https
+	Insecure bool
+	// SampleRatio is the share of new traces recorded, requests that carry a
+	// sampled trace context are always recorded
+	SampleRatio float64
+	// Stdout is where the stdout exporter writes
+	Stdout io.Writer
+}
+
+// Setup installs the global tracer provider and W3C trace context propagation.
+// The returned shutdown flushes any spans that haven't been exported yet.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(opts.Stdout))
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create the trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("chirpy")))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a span for every request, continuing the trace of an
+// incoming traceparent header. The span is named after the route pattern the
+// mux set, so any middleware between them must copy the pattern back onto the
+// request it was given.
+func Middleware(next http.Handler) http.Handler {
+	setRoute := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req)
+		if req.Pattern != "" {
+			trace.SpanFromContext(req.Context()).SetAttributes(semconv.HTTPRoute(req.Pattern))
+		}
+	})
+	// otelhttp names the span again once the mux has set the pattern
+	return otelhttp.NewHandler(setRoute, "http", otelhttp.WithSpanNameFormatter(
+		func(_ string, req *http.Request) string {
+			if req.Pattern != "" {
+				return req.Pattern
+			}
+			return req.Method
+		},
+	))
+}
+
+// Transport traces outgoing requests and propagates the trace context to them
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// DBTX matches the interface sqlc's generated Queries run their statements on
+type DBTX interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// WrapDB starts a span for each query, named after its sqlc query name.
+// driver is the database/sql driver name db was opened with.
+func WrapDB(db DBTX, driver string) DBTX {
+	return &tracedDB{db: db, tracer: otel.Tracer(instrumentationName), system: dbSystem(driver)}
+}
+
+type tracedDB struct {
+	db     DBTX
+	tracer trace.Tracer
+	system attribute.KeyValue
+}
+
+func dbSystem(driver string) attribute.KeyValue {
+	switch driver {
+	case "postgres":
+		return semconv.DBSystemNamePostgreSQL
+	case "sqlite":
+		return semconv.DBSystemNameSQLite
+	default:
+		return semconv.DBSystemNameKey.String(driver)
+	}
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	end(span, err)
+	return result, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	end(span, err)
+	return stmt, err
+}
+
+// QueryContext's span covers running the query, not reading the rows
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	end(span, err)
+	return rows, err
+}
+
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	end(span, row.Err())
+	return row
+}
+
+func (t *tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := QueryName(query)
+	return t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			t.system,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// end records err on the span, no rows is an expected result rather than an
+// error
+func end(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// QueryName reads the name from sqlc's "-- name: GetUser :one" header, queries
+// without one are named by their first keyword
+func QueryName(query string) string {
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		if name, _, ok := strings.Cut(rest, " "); ok {
+			return name
+		}
+	}
+	if fields := strings.Fields(query); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return "query"
+}
@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := Setup(context.Background(), Options{Exporter: ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Middleware(mux)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	route := spans[0]
+	if route.Name() != "GET /api/chirps/{chirpID}" {
+		t.Errorf("expected the span to be named after the route, got %q", route.Name())
+	}
+	if got := route.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("expected the incoming trace %s to be continued, got %s", traceID, got)
+	}
+	if !route.Parent().IsRemote() {
+		t.Error("expected the span's parent to be the remote caller")
+	}
+	var hasRoute bool
+	for _, attr := range route.Attributes() {
+		if attr == semconv.HTTPRoute("GET /api/chirps/{chirpID}") {
+			hasRoute = true
+		}
+	}
+	if !hasRoute {
+		t.Errorf("expected the span to have the route attribute, got %v", route.Attributes())
+	}
+	if spans[1].Name() != http.MethodGet {
+		t.Errorf("expected an unmatched request to be named by its method, got %q", spans[1].Name())
+	}
+	if spans[1].Parent().IsValid() {
+		t.Error("expected a request without a traceparent to start a new trace")
+	}
+}
+
+// fakeDB fails every statement with err
+type fakeDB struct {
+	err error
+}
+
+func (db fakeDB) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, db.err
+}
+
+func (db fakeDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, db.err
+}
+
+func (db fakeDB) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	return nil, db.err
+}
+
+func (db fakeDB) QueryRowContext(context.Context, string, ...any) *sql.Row {
+	return nil
+}
+
+func TestWrapDB(t *testing.T) {
+	tests := []struct {
+		name       string
+		driver     string
+		err        error
+		wantSystem string
+		wantStatus codes.Code
+	}{
+		{"Success", "postgres", nil, "postgresql", codes.Unset},
+		{"SQLite", "sqlite", nil, "sqlite", codes.Unset},
+		{"No rows is not an error", "postgres", sql.ErrNoRows, "postgresql", codes.Unset},
+		{"Error", "postgres", errors.New("connection refused"), "postgresql", codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			db := WrapDB(fakeDB{err: tt.err}, tt.driver)
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+			_, _ = db.ExecContext(ctx, "-- name: DeleteChirp :exec\nDELETE FROM chirps WHERE id = $1", 1)
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("expected a query span and its parent, got %d spans", len(spans))
+			}
+			query := spans[0]
+			if query.Name() != "DeleteChirp" {
+				t.Errorf("expected the span to be named DeleteChirp, got %q", query.Name())
+			}
+			if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("expected the query span to be a child of the request's span")
+			}
+			for _, attr := range query.Attributes() {
+				if attr.Key == semconv.DBSystemNameKey && attr.Value.AsString() != tt.wantSystem {
+					t.Errorf("expected db.system.name %q, got %q", tt.wantSystem, attr.Value.AsString())
+				}
+			}
+			if query.Status().Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v", tt.wantStatus, query.Status().Code)
+			}
+		})
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"-- name: GetUserByEmail :one\nSELECT * FROM users", "GetUserByEmail"},
+		{"  select 1", "SELECT"},
+		{"", "query"},
+	}
+	for _, tt := range tests {
+		if got := QueryName(tt.query); got != tt.want {
+			t.Errorf("QueryName(%q) = %q, expected %q", tt.query, got, tt.want)
+		}
+	}
+}
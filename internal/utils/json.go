@@ -3,17 +3,22 @@ package utils
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/jlargs64/chirpy/internal/logging"
 )
 
+// RespondWithError sends msg to the client, msg and err are added to the
+// request's access log
 func RespondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+	if err == nil {
+		err = errors.New(msg)
+	} else {
+		err = fmt.Errorf("%s: %w", msg, err)
 	}
+	logging.RecordError(w, err)
 	type errorResponse struct {
 		Error string `json:"error"`
 	}
@@ -26,14 +31,13 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		logging.RecordError(w, fmt.Errorf("could not marshal JSON: %w", err))
 		w.WriteHeader(500)
 		return
 	}
 	w.WriteHeader(code)
 	_, err = w.Write(dat)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("could not write to http:", err)
+		logging.RecordError(w, fmt.Errorf("could not write to http: %w", err))
 	}
 }
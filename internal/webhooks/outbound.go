@@ -0,0 +1,403 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/database"
+)
+
+// Event types users can subscribe their endpoints to
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+)
+
+var EventTypes = []string{EventChirpCreated, EventChirpDeleted}
+
+// Headers sent with every delivery, the signature is in the same format that
+// Verifier checks
+const (
+	SignatureHeader  = "Chirpy-Signature"
+	EventIDHeader    = "Chirpy-Event-Id"
+	DeliveryIDHeader = "Chirpy-Delivery-Id"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is tried before it fails
+	DefaultMaxAttempts = 8
+	// DefaultDisableAfter is how many attempts in a row an endpoint can fail
+	// before it is disabled
+	DefaultDisableAfter = 20
+	// deliveryTimeout bounds how long receivers have to respond
+	deliveryTimeout = time.Second * 10
+	// retryBase doubles with each attempt up to retryMax
+	retryBase = time.Second * 30
+	retryMax  = time.Hour * 6
+	// deliveryLease is how long a claimed delivery is kept from other workers,
+	// enough to send it and record the attempt
+	deliveryLease = deliveryTimeout * 3
+	// claimBatch is how many due deliveries each poll attempts
+	claimBatch = 50
+	// maxErrorBody is how much of a failed response is kept in the history
+	maxErrorBody = 512
+	// missedRuns is how many of Run's intervals can pass without delivering,
+	// on top of a delivery's lease, before the queue is reported as stalled
+	missedRuns = 3
+)
+
+// ErrPrivateAddress means an endpoint is on a loopback, private or link-local
+// network, which deliveries are never sent to
+var ErrPrivateAddress = errors.New("webhook endpoints must be on a public network")
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+// though netip doesn't count it
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// DispatchStore holds endpoints and the delivery queue
+type DispatchStore interface {
+	GetWebhookEndpointById(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error)
+	GetWebhookEndpointsForEvent(ctx context.Context, arg database.GetWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error)
+	RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error
+	RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error)
+	CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) (database.WebhookDelivery, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, arg database.ClaimDueWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	FinishWebhookDeliveryAttempt(ctx context.Context, arg database.FinishWebhookDeliveryAttemptParams) (database.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error)
+}
+
+// Envelope is the body of every delivery
+type Envelope struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Dispatcher queues events for users' endpoints and delivers them in the
+// background, retrying failures with exponential backoff
+type Dispatcher struct {
+	Store        DispatchStore
+	Client       *http.Client
+	MaxAttempts  int32
+	DisableAfter int32
+	// OnAttempt is optional, it is called with each delivery once attempted
+	OnAttempt func(delivery database.WebhookDelivery)
+	// Now is overridden in tests
+	Now func() time.Time
+
+	// lastRun is when Run last finished a pass over the queue and lastAttempt
+	// when a delivery was last attempted, in unix nanos
+	lastRun     atomic.Int64
+	lastAttempt atomic.Int64
+	interval    atomic.Int64
+}
+
+func NewDispatcher(store DispatchStore) *Dispatcher {
+	return &Dispatcher{
+		Store:        store,
+		Client:       NewClient(false),
+		MaxAttempts:  DefaultMaxAttempts,
+		DisableAfter: DefaultDisableAfter,
+		Now:          time.Now,
+	}
+}
+
+// NewClient returns the client deliveries are sent with. It only connects to
+// public addresses, checked after DNS resolution so a hostname can't point it
+// at the internal network, unless allowPrivate is set for local development.
+// Redirects aren't followed, a 3XX response fails the attempt.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: deliveryTimeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy the dialer would only check the proxy's address
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   deliveryTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refusePrivateAddress is a net.Dialer Control hook, it runs for every
+// address the host resolved to before connecting to it
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// MakeSecret returns a new secret for signing an endpoint's deliveries
+func MakeSecret() (string, error) {
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + secret, nil
+}
+
+// ValidateEndpointURL only allows absolute https urls to public hosts, or http
+// and local hosts when allowInsecure is set for local development. Hostnames
+// are checked again when they are resolved for each delivery.
+func ValidateEndpointURL(raw string, allowInsecure bool) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return errors.New("the url must be absolute")
+	}
+	if parsed.Scheme != "https" && (parsed.Scheme != "http" || !allowInsecure) {
+		return errors.New("the url must use https")
+	}
+	if parsed.User != nil || parsed.Fragment != "" {
+		return errors.New("the url must not have credentials or a fragment")
+	}
+	if allowInsecure {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !publicAddress(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// ValidEventTypes reports whether every type can be subscribed to
+func ValidEventTypes(types []string) bool {
+	if len(types) == 0 {
+		return false
+	}
+	for _, eventType := range types {
+		if !slices.Contains(EventTypes, eventType) {
+			return false
+		}
+	}
+	return true
+}
+
+// Publish queues a delivery of the event to each of the user's enabled
+// endpoints subscribed to eventType
+func (d *Dispatcher) Publish(ctx context.Context, userID uuid.UUID, eventType string, data any) error {
+	endpoints, err := d.Store.GetWebhookEndpointsForEvent(ctx, database.GetWebhookEndpointsForEventParams{
+		UserID:    userID,
+		EventType: eventType,
+	})
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	envelope := Envelope{ID: uuid.New(), Type: eventType, CreatedAt: d.now(), Data: data}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		_, err := d.Store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventID:    envelope.ID,
+			EventType:  eventType,
+			Payload:    string(payload),
+		})
+		if err != nil {
+			return fmt.Errorf("could not queue delivery to endpoint %s: %w", endpoint.ID, err)
+		}
+	}
+	return nil
+}
+
+// Redeliver queues a delivery to be attempted again straight away
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID uuid.UUID) (database.WebhookDelivery, error) {
+	return d.Store.RedeliverWebhookDelivery(ctx, deliveryID)
+}
+
+// DeliverDue attempts up to claimBatch due deliveries and returns how many it
+// tried. Each is claimed just before it is sent, so a slow endpoint can't
+// hold up deliveries another worker could send. A delivery that can't be
+// attempted is logged and retried once its lease runs out.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	attempts := 0
+	for attempts < claimBatch {
+		deliveries, err := d.Store.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+			LeaseUntil:    d.now().Add(deliveryLease),
+			MaxDeliveries: 1,
+		})
+		if err != nil {
+			return attempts, err
+		}
+		if len(deliveries) == 0 {
+			break
+		}
+		attempts++
+		attempted, err := d.attempt(ctx, deliveries[0])
+		d.lastAttempt.Store(d.Now().UnixNano())
+		if err != nil {
+			slog.Error("could not attempt webhook delivery", "delivery_id", deliveries[0].ID, "error", err)
+			continue
+		}
+		if d.OnAttempt != nil {
+			d.OnAttempt(attempted)
+		}
+	}
+	return attempts, nil
+}
+
+// Run delivers due deliveries every interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	d.interval.Store(int64(interval))
+	d.lastRun.Store(d.Now().UnixNano())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DeliverDue(ctx); err != nil {
+				slog.Error("could not deliver webhooks", "error", err)
+				continue
+			}
+			d.lastRun.Store(d.Now().UnixNano())
+		}
+	}
+}
+
+// Healthy fails when Run isn't running, or has neither finished a run nor
+// attempted a delivery for several of its intervals plus a delivery's lease,
+// so a long run over slow endpoints isn't mistaken for a stall
+func (d *Dispatcher) Healthy(context.Context) error {
+	lastRun := d.lastRun.Load()
+	if lastRun == 0 {
+		return errors.New("the delivery worker is not running")
+	}
+	since := d.Now().Sub(time.Unix(0, max(lastRun, d.lastAttempt.Load())))
+	if since > time.Duration(d.interval.Load())*missedRuns+deliveryLease {
+		return fmt.Errorf("the delivery worker has not made progress in %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// attempt sends the delivery once and schedules a retry if it fails
+func (d *Dispatcher) attempt(ctx context.Context, delivery database.WebhookDelivery) (database.WebhookDelivery, error) {
+	endpoint, err := d.Store.GetWebhookEndpointById(ctx, delivery.EndpointID)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+	if !endpoint.Enabled {
+		return d.Store.FinishWebhookDeliveryAttempt(ctx, database.FinishWebhookDeliveryAttemptParams{
+			ID:            delivery.ID,
+			Status:        database.WebhookDeliveryStatusFailed,
+			NextAttemptAt: delivery.NextAttemptAt,
+			LastError:     sql.NullString{String: "the endpoint is disabled", Valid: true},
+		})
+	}
+
+	responseStatus, sendErr := d.send(ctx, endpoint, delivery)
+	params := database.FinishWebhookDeliveryAttemptParams{
+		ID:             delivery.ID,
+		Status:         database.WebhookDeliveryStatusSucceeded,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: sql.NullInt32{Int32: int32(responseStatus), Valid: responseStatus != 0},
+	}
+	if sendErr == nil {
+		if err := d.Store.RecordWebhookEndpointSuccess(ctx, endpoint.ID); err != nil {
+			return database.WebhookDelivery{}, err
+		}
+		return d.Store.FinishWebhookDeliveryAttempt(ctx, params)
+	}
+
+	params.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+	attempts := delivery.Attempts + 1
+	if attempts >= d.MaxAttempts {
+		params.Status = database.WebhookDeliveryStatusFailed
+	} else {
+		params.Status = database.WebhookDeliveryStatusPending
+		params.NextAttemptAt = d.now().Add(RetryDelay(attempts))
+	}
+	_, err = d.Store.RecordWebhookEndpointFailure(ctx, database.RecordWebhookEndpointFailureParams{
+		ID:           endpoint.ID,
+		DisableAfter: d.DisableAfter,
+	})
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+	return d.Store.FinishWebhookDeliveryAttempt(ctx, params)
+}
+
+// send POSTs the signed payload, any non 2XX response is a failure
+func (d *Dispatcher) send(ctx context.Context, endpoint database.WebhookEndpoint, delivery database.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign([]byte(endpoint.Secret), d.now(), body))
+	req.Header.Set(EventIDHeader, delivery.EventID.String())
+	req.Header.Set(DeliveryIDHeader, delivery.ID.String())
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Errorf("the endpoint responded with %d: %s", resp.StatusCode, snippet)
+	}
+	return resp.StatusCode, nil
+}
+
+// RetryDelay is how long to wait after the given number of failed attempts
+func RetryDelay(attempts int32) time.Duration {
+	delay := retryBase
+	for i := int32(1); i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMax)
+}
+
+func (d *Dispatcher) now() time.Time {
+	return d.Now().UTC()
+}
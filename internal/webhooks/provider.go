@@ -0,0 +1,182 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+)
+
+var (
+	// ErrUnknownEvent means the provider has no handler for the event type
+	ErrUnknownEvent = errors.New("the webhook event type is not handled")
+	// ErrInvalidPayload means the delivery doesn't match the event's schema
+	ErrInvalidPayload = errors.New("the webhook payload is invalid")
+)
+
+// Event is a delivery decoded far enough to route it to a handler
+type Event struct {
+	// ID is optional, deliveries without one are never treated as duplicates
+	ID   string          `json:"id"`
+	Type string          `json:"event"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Validator is implemented by payloads with fields that are required or
+// constrained beyond what decoding them checks
+type Validator interface {
+	Validate() error
+}
+
+// Authenticator checks a delivery came from the provider
+type Authenticator func(header http.Header, body []byte) error
+
+// EventHandler handles the data of one event type
+type EventHandler func(ctx context.Context, data json.RawMessage) error
+
+// Provider is a sender of webhooks, how its deliveries are authenticated and
+// decoded, and the handlers for the event types it sends
+type Provider struct {
+	Name         string
+	Authenticate Authenticator
+	// Decode reads the event from a delivery body, DecodeEvent by default
+	Decode   func(body []byte) (Event, error)
+	handlers map[string]EventHandler
+	ignored  []string
+}
+
+func NewProvider(name string, authenticate Authenticator) *Provider {
+	return &Provider{
+		Name:         name,
+		Authenticate: authenticate,
+		Decode:       DecodeEvent,
+		handlers:     map[string]EventHandler{},
+	}
+}
+
+// Handle registers handle for eventType, the event's data is decoded into T
+// and validated before handle is called
+func Handle[T any](p *Provider, eventType string, handle func(ctx context.Context, data T) error) {
+	p.handlers[eventType] = func(ctx context.Context, raw json.RawMessage) error {
+		var data T
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		if validator, ok := any(data).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+			}
+		}
+		return handle(ctx, data)
+	}
+}
+
+// Ignore marks event types the provider sends that need no handling, so they
+// aren't reported as unknown
+func (p *Provider) Ignore(eventTypes ...string) {
+	p.ignored = append(p.ignored, eventTypes...)
+}
+
+// Ignores reports whether eventType was marked with Ignore
+func (p *Provider) Ignores(eventType string) bool {
+	return slices.Contains(p.ignored, eventType)
+}
+
+// Dispatch calls the handler for the event, wrapping ErrUnknownEvent when
+// there isn't one and ErrInvalidPayload when its data doesn't match
+func (p *Provider) Dispatch(ctx context.Context, event Event) error {
+	handle, ok := p.handlers[event.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q from %s", ErrUnknownEvent, event.Type, p.Name)
+	}
+	return handle(ctx, event.Data)
+}
+
+// DecodeEvent reads deliveries shaped {"id": ..., "event": ..., "data": {...}}
+func DecodeEvent(body []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if event.Type == "" {
+		return Event{}, fmt.Errorf("%w: missing event type", ErrInvalidPayload)
+	}
+	return event, nil
+}
+
+// SignatureAuth verifies the signature in header with verifier. Deliveries
+// without the header fail with ErrMissingSignature.
+func SignatureAuth(header string, verifier *Verifier) Authenticator {
+	return func(h http.Header, body []byte) error {
+		signature := h.Get(header)
+		if signature == "" {
+			return ErrMissingSignature
+		}
+		if verifier == nil {
+			return errors.New("no webhook signing secrets are configured")
+		}
+		return verifier.Verify(signature, body)
+	}
+}
+
+// APIKeyAuth checks the "Authorization: ApiKey <key>" header. Deliveries
+// fail with ErrMissingSignature when key is empty.
+func APIKeyAuth(key string) Authenticator {
+	return func(h http.Header, body []byte) error {
+		if key == "" {
+			return ErrMissingSignature
+		}
+		apiKey, err := auth.GetAPIKey(h)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) != 1 {
+			return errors.New("bad api key")
+		}
+		return nil
+	}
+}
+
+// Fallback tries primary and only uses fallback when primary reports
+// ErrMissingSignature, so a bad or malformed signature can't be retried as an
+// api key
+func Fallback(primary, fallback Authenticator) Authenticator {
+	return func(h http.Header, body []byte) error {
+		err := primary(h, body)
+		if errors.Is(err, ErrMissingSignature) {
+			return fallback(h, body)
+		}
+		return err
+	}
+}
+
+// Registry looks up providers by name
+type Registry struct {
+	providers map[string]*Provider
+}
+
+func NewRegistry(providers ...*Provider) *Registry {
+	r := &Registry{providers: map[string]*Provider{}}
+	for _, provider := range providers {
+		r.Register(provider)
+	}
+	return r
+}
+
+// Register adds the provider, replacing any with the same name
+func (r *Registry) Register(provider *Provider) {
+	r.providers[provider.Name] = provider
+}
+
+func (r *Registry) Provider(name string) (*Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	provider, ok := r.providers[name]
+	return provider, ok
+}
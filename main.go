@@ -1,81 +1,291 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"sync/atomic"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
 
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/cli"
+	"github.com/jlargs64/chirpy/internal/config"
 	"github.com/jlargs64/chirpy/internal/database"
-	"github.com/jlargs64/chirpy/internal/handlers"
+	"github.com/jlargs64/chirpy/internal/database/sqlite"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/sql/schema"
+	sqliteschema "github.com/jlargs64/chirpy/sql/sqlite/schema"
 )
 
+const usage = `Usage: chirpy [command] [flags]
+
+Commands:
+  serve                    serve the API, the default command
+  migrate up|down|status   apply, roll back or list the migrations
+  user create              create a user, -admin makes them an admin
+  seed                     create sample users and chirps on the dev platform
+  token revoke-all         sign every user out
+
+Every command takes the config flags, run chirpy <command> -h to list them.
+`
+
+// errUsage is returned when the command line is wrong and has been explained
+var errUsage = errors.New("usage")
+
 func main() {
-	// Init env
+	// Init config, a .env file is optional when the env is set some other way
 	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal("could not read env file", err)
-	}
-	// Init vars
-	const port = "8080"
-	dbURL := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
-	signingKey := []byte(os.Getenv("SIGNING_KEY"))
-	polkaAPIKey := os.Getenv("POLKA_API_KEY")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		log.Fatal("Could not access database:", err)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("could not read env file: ", err)
 	}
 
-	apiCfg := handlers.APIConfig{
-		FileserverHits: atomic.Int32{},
-		DBQueries:      database.New(db),
-		Platform:       platform,
-		SigningKey:     signingKey,
-		PolkaAPIKey:    polkaAPIKey,
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
+	err = run(command, args)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "chirpy:", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, args []string) error {
+	ctx := context.Background()
+	switch command {
+	case "serve":
+		cfg, logger, err := load("serve", args, nil)
+		if err != nil {
+			return err
+		}
+		if code := serve(cfg, logger); code != 0 {
+			os.Exit(code)
+		}
+		return nil
+
+	case "migrate":
+		subcommand, args := subcommand(args)
+		if subcommand != "up" && subcommand != "down" && subcommand != "status" {
+			fmt.Fprint(os.Stderr, "Usage: chirpy migrate up|down|status [flags]\n")
+			return errUsage
+		}
+		cfg, _, err := load("migrate "+subcommand, args, nil)
+		if err != nil {
+			return err
+		}
+		db, err := openDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		migrator, err := newMigrations(cfg, db)
+		if err != nil {
+			return fmt.Errorf("could not read the migrations: %w", err)
+		}
+		return cli.Migrate(ctx, migrator, subcommand, os.Stdout)
+
+	case "user":
+		subcommand, args := subcommand(args)
+		if subcommand != "create" {
+			fmt.Fprint(os.Stderr, "Usage: chirpy user create -email <email> [-admin] [flags]\n")
+			return errUsage
+		}
+		var email, password string
+		var admin bool
+		cfg, _, err := load("user create", args, func(fs *flag.FlagSet) {
+			fs.StringVar(&email, "email", "", "the user's email")
+			fs.StringVar(&password, "password", "", "the user's password, read from stdin when it is not set")
+			fs.BoolVar(&admin, "admin", false, "make the user an admin")
+		})
+		if err != nil {
+			return err
+		}
+		if password == "" {
+			if password, err = readPassword(); err != nil {
+				return err
+			}
+		}
+		db, err := openDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		user, err := cli.CreateUser(ctx, newQueries(cfg, db), email, password, admin)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s %s (%s)\n", user.ID, user.Email, user.Role)
+		return nil
 
-	// Start server
-	log.Println("Starting server...")
+	case "seed":
+		var password string
+		cfg, _, err := load("seed", args, func(fs *flag.FlagSet) {
+			fs.StringVar(&password, "password", "password", "password for every sample user")
+		})
+		if err != nil {
+			return err
+		}
+		if !cfg.Dev() {
+			return fmt.Errorf("seed only runs on the %q platform", config.PlatformDev)
+		}
+		db, err := openDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return cli.Seed(ctx, newQueries(cfg, db), password, os.Stdout)
 
-	mux := http.NewServeMux()
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	case "token":
+		subcommand, args := subcommand(args)
+		if subcommand != "revoke-all" {
+			fmt.Fprint(os.Stderr, "Usage: chirpy token revoke-all [flags]\n")
+			return errUsage
+		}
+		cfg, _, err := load("token revoke-all", args, nil)
+		if err != nil {
+			return err
+		}
+		db, err := openDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		revoked, err := cli.RevokeAllTokens(ctx, newQueries(cfg, db))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("revoked %d refresh tokens, %d personal access tokens and the access tokens of %d users\n",
+			revoked.RefreshTokens, revoked.PersonalAccessTokens, revoked.Users)
+		return nil
+
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
 	}
+	fmt.Fprintf(os.Stderr, "chirpy: unknown command %q\n\n%s", command, usage)
+	return errUsage
+}
 
-	// Create app routes
-	mux.Handle("/app/", http.StripPrefix("/app/",
-		apiCfg.MiddlewareMetricsInc(http.FileServer(http.Dir(".")))))
-	// Create API routes
-	mux.HandleFunc("GET /api/healthz", handlers.HandlerReadiness)
+// subcommand splits off the first arg unless it is a flag
+func subcommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", args
+	}
+	return args[0], args[1:]
+}
 
-	// Users
-	mux.HandleFunc("POST /api/users", apiCfg.HandleCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.HandleChangeUser)
-	mux.HandleFunc("POST /api/login", apiCfg.HandleLogin)
-	mux.HandleFunc("POST /api/refresh", apiCfg.HandleRefreshToken)
-	mux.HandleFunc("POST /api/revoke", apiCfg.HandleRefreshRevoke)
+// load parses the command's flags, added by addFlags, along with the config
+// flags, then sets up logging and password hashing from the config
+func load(name string, args []string, addFlags func(fs *flag.FlagSet)) (*config.Config, *slog.Logger, error) {
+	fs := flag.NewFlagSet("chirpy "+name, flag.ContinueOnError)
+	loader := config.AddFlags(fs)
+	if addFlags != nil {
+		addFlags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "chirpy %s: unexpected arguments %q\n", name, fs.Args())
+		return nil, nil, errUsage
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
 
-	// Webhooks
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.HandlePolkaWebhook)
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log config: %w", err)
+	}
+	slog.SetDefault(logger)
+	if err := auth.SetPasswordParams(cfg.Argon2.Params()); err != nil {
+		return nil, nil, fmt.Errorf("invalid password hashing config: %w", err)
+	}
+	return cfg, logger, nil
+}
+
+// sqlOpen opens the configured database without connecting to it
+func sqlOpen(cfg *config.Config) (*sql.DB, error) {
+	if cfg.DBDriver == config.DriverSQLite {
+		return sqlite.Open(cfg.DBURL.Value())
+	}
+	return sql.Open(config.DriverPostgres, cfg.DBURL.Value())
+}
+
+// openDB connects to the database, failing straight away when it can't be
+// reached
+func openDB(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+	db, err := sqlOpen(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not access database: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not connect to the database: %w", err)
+	}
+	return db, nil
+}
 
-	// Chirps
-	mux.HandleFunc("GET /api/chirps", apiCfg.HandleGetChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.HandleGetChirpByID)
-	mux.HandleFunc("POST /api/chirps", apiCfg.HandleCreateChrip)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.HandleDeleteChirps)
+// newQueries runs the configured driver's queries on db
+func newQueries(cfg *config.Config, db database.DBTX) database.Querier {
+	if cfg.DBDriver == config.DriverSQLite {
+		return sqlite.NewStore(db)
+	}
+	return database.New(db)
+}
+
+// newTxRunner runs transactions on db with the configured driver's queries,
+// built by newQuerier
+func newTxRunner(cfg *config.Config, db *sql.DB, newQuerier func(tx database.DBTX) database.Querier) *database.TxRunner {
+	if cfg.DBDriver == config.DriverSQLite {
+		return sqlite.NewTxRunner(db, newQuerier)
+	}
+	return database.NewTxRunner(db, newQuerier)
+}
 
-	// Create Admin routes
-	mux.Handle("GET /admin/metrics", http.HandlerFunc(apiCfg.HandlerMetrics))
-	mux.HandleFunc("POST /admin/reset", apiCfg.HandlerReset)
+// newMigrations reads the configured driver's migrations
+func newMigrations(cfg *config.Config, db *sql.DB) (*goose.Provider, error) {
+	if cfg.DBDriver == config.DriverSQLite {
+		return sqliteschema.NewProvider(db)
+	}
+	return schema.NewProvider(db)
+}
 
-	log.Println("Serving on port:", port)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("server could not start: ", err)
+// readPassword reads a line from stdin so the password stays out of the shell
+// history
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("could not read the password: %w", err)
 	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// fatal logs err and exits, it is only for failures while starting up
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
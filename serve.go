@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jlargs64/chirpy/internal/auth"
+	"github.com/jlargs64/chirpy/internal/billing"
+	"github.com/jlargs64/chirpy/internal/config"
+	"github.com/jlargs64/chirpy/internal/database"
+	"github.com/jlargs64/chirpy/internal/handlers"
+	"github.com/jlargs64/chirpy/internal/health"
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/metrics"
+	"github.com/jlargs64/chirpy/internal/oauth"
+	"github.com/jlargs64/chirpy/internal/service"
+	"github.com/jlargs64/chirpy/internal/sso"
+	"github.com/jlargs64/chirpy/internal/tracing"
+	"github.com/jlargs64/chirpy/internal/webhooks"
+)
+
+// serve runs the API until SIGINT or SIGTERM and returns the exit code
+func serve(cfg *config.Config, logger *slog.Logger) int {
+	slog.Info("loaded config", "config", cfg.String())
+	signingKey := []byte(cfg.SigningKey.Value())
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Stdout:      os.Stdout,
+	})
+	if err != nil {
+		fatal("could not set up tracing", err)
+	}
+	db, err := sqlOpen(cfg)
+	if err != nil {
+		fatal("could not access database", err)
+	}
+
+	// Queries are traced, in transactions too
+	tracedQueries := func(db database.DBTX) database.Querier {
+		return newQueries(cfg, tracing.WrapDB(db, cfg.DBDriver))
+	}
+	dbQueries := tracedQueries(db)
+	apiMetrics := metrics.New(db)
+
+	// Init access token denylist
+	denylist := auth.NewDenylist(dbQueries, auth.AccessTokenExpiry)
+	if err := denylist.Load(context.Background()); err != nil {
+		fatal("could not load the access token denylist", err)
+	}
+	loginThrottle := auth.NewLoginThrottle(dbQueries)
+	billingService := billing.NewService(dbQueries)
+	webhookDispatcher := webhooks.NewDispatcher(dbQueries)
+	webhookDispatcher.Client = webhooks.NewClient(cfg.Dev())
+	webhookDispatcher.Client.Transport = tracing.Transport(webhookDispatcher.Client.Transport)
+	webhookDispatcher.OnAttempt = func(delivery database.WebhookDelivery) {
+		apiMetrics.WebhookDelivery(string(delivery.Status))
+	}
+
+	// Background workers run until shutdown
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Go(func() { denylist.Run(workersCtx, time.Minute) })
+	workers.Go(func() { loginThrottle.Run(workersCtx, time.Hour) })
+	workers.Go(func() { billingService.Run(workersCtx, time.Minute*10) })
+	workers.Go(func() { webhookDispatcher.Run(workersCtx, time.Second*5) })
+
+	// Init external sign in providers
+	ssoProviders := make(map[string]*sso.Provider, len(cfg.SSO.Providers))
+	for _, ssoConfig := range cfg.SSO.Providers {
+		provider, err := sso.NewProvider(context.Background(), sso.ProviderConfig{
+			Name:         ssoConfig.Name,
+			Issuer:       ssoConfig.Issuer,
+			ClientID:     ssoConfig.ClientID,
+			ClientSecret: ssoConfig.ClientSecret.Value(),
+			RedirectURL:  cfg.SSO.RedirectURL(ssoConfig.Name),
+		})
+		if err != nil {
+			fatal("could not set up sign in provider", err)
+		}
+		ssoProviders[provider.Name()] = provider
+	}
+
+	// Polka signs deliveries with any of these, more than one while rotating
+	var polkaVerifier *webhooks.Verifier
+	if len(cfg.PolkaWebhookSecrets) > 0 {
+		polkaVerifier = webhooks.NewVerifier()
+		for _, secret := range cfg.PolkaWebhookSecrets {
+			polkaVerifier.Secrets = append(polkaVerifier.Secrets, []byte(secret.Value()))
+		}
+	}
+
+	apiCfg := handlers.APIConfig{
+		FileserverHits: atomic.Int32{},
+		DBQueries:      dbQueries,
+		Service:        service.New(newTxRunner(cfg, db, tracedQueries), signingKey),
+		Platform:       cfg.Platform,
+		SigningKey:     signingKey,
+		PolkaAPIKey:    cfg.PolkaAPIKey.Value(),
+		PolkaVerifier:  polkaVerifier,
+		Billing:        billingService,
+		Webhooks:       webhookDispatcher,
+		Denylist:       denylist,
+		LoginThrottle:  loginThrottle,
+		Metrics:        apiMetrics,
+		SSOProviders:   ssoProviders,
+	}
+	apiCfg.WebhookProviders = webhooks.NewRegistry(apiCfg.NewPolkaProvider())
+	workers.Go(func() { apiCfg.RunChirpAnnouncements(workersCtx, time.Second*5) })
+
+	// Readiness needs the database with every migration applied, a stalled
+	// webhook queue only degrades it
+	migrations, err := newMigrations(cfg, db)
+	if err != nil {
+		fatal("could not read the migrations", err)
+	}
+	apiCfg.Health = health.NewChecker(cfg.Server.ReadinessTimeout,
+		health.Database(db),
+		health.Migrations(migrations),
+		health.Check{Name: "webhook_queue", Optional: true, Run: webhookDispatcher.Healthy},
+	)
+
+	// Start server
+	slog.Info("starting server")
+
+	mux := http.NewServeMux()
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           newHandler(logger, apiMetrics, mux),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	// Create app routes
+	mux.Handle("/app/", http.StripPrefix("/app/",
+		apiCfg.MiddlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	// Create API routes
+	mux.HandleFunc("GET /api/livez", apiCfg.HandlerLiveness)
+	mux.HandleFunc("GET /api/readyz", apiCfg.HandlerReadiness)
+	// healthz was the readiness probe before livez and readyz
+	mux.HandleFunc("GET /api/healthz", apiCfg.HandlerReadiness)
+	mux.Handle("GET /metrics", apiMetrics.Handler(cfg.MetricsToken.Value()))
+
+	authorizer := &auth.Authorizer{
+		Users:      dbQueries,
+		Tokens:     dbQueries,
+		SigningKey: signingKey,
+		Denylist:   denylist,
+	}
+	requireScope := func(scope auth.Scope, handler http.HandlerFunc) http.Handler {
+		return authorizer.RequireScope(scope, handler)
+	}
+	requireAdmin := func(handler http.HandlerFunc) http.Handler {
+		return authorizer.RequireScope(auth.ScopeAdmin,
+			authorizer.RequireRole(database.UserRoleAdmin, handler))
+	}
+
+	// Users
+	mux.HandleFunc("POST /api/users", apiCfg.HandleCreateUser)
+	mux.Handle("PUT /api/users", requireScope(auth.ScopeUsersWrite, apiCfg.HandleChangeUser))
+	mux.HandleFunc("POST /api/login", apiCfg.HandleLogin)
+	mux.HandleFunc("POST /api/refresh", apiCfg.HandleRefreshToken)
+	mux.HandleFunc("POST /api/revoke", apiCfg.HandleRefreshRevoke)
+
+	mux.HandleFunc("GET /api/sso/{provider}/login", apiCfg.HandleSSOLogin)
+	mux.HandleFunc("GET /api/sso/{provider}/callback", apiCfg.HandleSSOCallback)
+
+	// Personal access tokens
+	mux.Handle("POST /api/tokens", requireScope(auth.ScopeTokensWrite, apiCfg.HandleCreateToken))
+	mux.Handle("GET /api/tokens", requireScope(auth.ScopeTokensWrite, apiCfg.HandleGetTokens))
+	mux.Handle("DELETE /api/tokens/{tokenID}", requireScope(auth.ScopeTokensWrite, apiCfg.HandleRevokeToken))
+
+	// OAuth
+	oauthServer := &oauth.Server{
+		Store:         dbQueries,
+		SigningKey:    signingKey,
+		Denylist:      denylist,
+		LoginThrottle: loginThrottle,
+		Metrics:       apiMetrics,
+	}
+	mux.Handle("POST /api/oauth/clients", requireScope(auth.ScopeTokensWrite, oauthServer.HandleRegisterClient))
+	mux.HandleFunc("GET /api/oauth/authorize", oauthServer.HandleAuthorize)
+	mux.HandleFunc("POST /api/oauth/authorize", oauthServer.HandleAuthorize)
+	mux.HandleFunc("POST /api/oauth/token", oauthServer.HandleToken)
+	mux.HandleFunc("POST /api/oauth/revoke", oauthServer.HandleRevoke)
+
+	// Webhooks
+	mux.HandleFunc("POST /api/{provider}/webhooks", apiCfg.HandleProviderWebhook)
+
+	// Outbound webhooks
+	mux.Handle("POST /api/webhooks", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleCreateWebhookEndpoint))
+	mux.Handle("GET /api/webhooks", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleGetWebhookEndpoints))
+	mux.Handle("DELETE /api/webhooks/{endpointID}", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleDeleteWebhookEndpoint))
+	mux.Handle("POST /api/webhooks/{endpointID}/enable", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleEnableWebhookEndpoint))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleGetWebhookDeliveries))
+	mux.Handle("POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/redeliver", requireScope(auth.ScopeWebhooksWrite, apiCfg.HandleRedeliverWebhook))
+
+	// Chirps
+	mux.HandleFunc("GET /api/chirps", apiCfg.HandleGetChirps)
+	mux.Handle("GET /api/chirps/{chirpID}", authorizer.OptionalAuth(http.HandlerFunc(apiCfg.HandleGetChirpByID)))
+	mux.Handle("POST /api/chirps", requireScope(auth.ScopeChirpsWrite, apiCfg.HandleCreateChrip))
+	mux.Handle("PUT /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, apiCfg.HandleEditChirp))
+	mux.Handle("DELETE /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, apiCfg.HandleDeleteChirps))
+	mux.Handle("POST /api/chirps/{chirpID}/pin", requireScope(auth.ScopeChirpsWrite, apiCfg.HandlePinChirp))
+	mux.Handle("DELETE /api/chirps/{chirpID}/pin", requireScope(auth.ScopeChirpsWrite, apiCfg.HandleUnpinChirp))
+
+	// Create Admin routes
+	mux.Handle("GET /admin/metrics", requireAdmin(apiCfg.HandlerMetrics))
+	mux.Handle("POST /admin/reset", requireAdmin(apiCfg.HandlerReset))
+	mux.Handle("PUT /admin/users/{userID}/role", requireAdmin(apiCfg.HandleChangeUserRole))
+	mux.Handle("POST /admin/users/{userID}/ban", requireAdmin(apiCfg.HandleBanUser))
+	mux.Handle("DELETE /admin/users/{userID}/ban", requireAdmin(apiCfg.HandleUnbanUser))
+	mux.Handle("POST /admin/unlock", requireAdmin(apiCfg.HandleUnlockLogin))
+	mux.Handle("GET /admin/webhooks/events", requireAdmin(apiCfg.HandleGetWebhookEvents))
+	mux.Handle("GET /admin/webhooks/events/{eventID}", requireAdmin(apiCfg.HandleGetWebhookEvent))
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", requireAdmin(apiCfg.HandleReplayWebhookEvent))
+
+	// Serve until SIGINT or SIGTERM, a second signal exits straight away
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("serving", "port", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		slog.Error("server could not start", "error", err)
+		exitCode = 1
+	case <-signalCtx.Done():
+		stopSignals()
+		slog.Info("shutting down", "drain_delay", cfg.Server.DrainDelay)
+
+		// Fail readiness first so load balancers stop routing here, then let
+		// in flight requests finish
+		apiCfg.Draining.Store(true)
+		time.Sleep(cfg.Server.DrainDelay)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("requests did not finish before the shutdown timeout", "error", err)
+			_ = server.Close()
+			exitCode = 1
+		}
+		cancel()
+	}
+
+	stopWorkers()
+	workers.Wait()
+	if err := db.Close(); err != nil {
+		slog.Error("could not close the database", "error", err)
+		exitCode = 1
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("could not flush traces", "error", err)
+	}
+	cancel()
+	slog.Info("server stopped")
+	return exitCode
+}
+
+// newHandler wraps mux in the middlewares every request goes through. Tracing
+// is outermost as otelhttp hands the next handler a copy of the request, the
+// ones inside it then see the pattern the mux sets.
+func newHandler(logger *slog.Logger, apiMetrics *metrics.Metrics, mux http.Handler) http.Handler {
+	return tracing.Middleware(logging.Middleware(logger, apiMetrics.Middleware(mux)))
+}
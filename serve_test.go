@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jlargs64/chirpy/internal/logging"
+	"github.com/jlargs64/chirpy/internal/metrics"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+func TestHandlerRoute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	var out bytes.Buffer
+	logger, err := logging.New(&out, logging.FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiMetrics := metrics.New(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	newHandler(logger, apiMetrics, mux).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil))
+
+	const route = "GET /api/chirps/{chirpID}"
+	var line struct {
+		Route string `json:"route"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single access log line, got %q", out.String())
+	}
+	if line.Route != route {
+		t.Errorf("expected the access log route %q, got %q", route, line.Route)
+	}
+
+	w := httptest.NewRecorder()
+	apiMetrics.Handler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `chirpy_http_requests_total{method="GET",route="GET /api/chirps/{chirpID}",status="404"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected the metrics to contain %s", want)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != route {
+		t.Errorf("expected the span to be named %q, got %q", route, spans[0].Name())
+	}
+	var hasRoute bool
+	for _, attr := range spans[0].Attributes() {
+		if attr == semconv.HTTPRoute(route) {
+			hasRoute = true
+		}
+	}
+	if !hasRoute {
+		t.Errorf("expected the span to have the route attribute, got %v", spans[0].Attributes())
+	}
+}
@@ -0,0 +1,39 @@
+-- name: CreateAccessTokenRevocation :one
+INSERT INTO access_token_revocations (
+    id,
+    created_at,
+    user_id,
+    jti,
+    expires_at,
+    token_version
+) VALUES (gen_random_uuid(), now(), $1, $2, $3, $4)
+ON CONFLICT (jti) DO UPDATE SET expires_at = excluded.expires_at
+RETURNING *;
+
+-- name: GetActiveAccessTokenRevocations :many
+SELECT *
+FROM access_token_revocations
+WHERE expires_at > now()
+ORDER BY created_at ASC;
+
+-- name: DeleteExpiredAccessTokenRevocations :execrows
+DELETE FROM access_token_revocations
+WHERE expires_at <= now();
+
+-- name: RevokeAllAccessTokens :execrows
+INSERT INTO access_token_revocations (
+    id,
+    created_at,
+    user_id,
+    jti,
+    expires_at,
+    token_version
+)
+SELECT
+    gen_random_uuid(),
+    now(),
+    users.id,
+    NULL,
+    sqlc.arg(expires_at)::timestamp,
+    users.token_version
+FROM users;
@@ -4,8 +4,33 @@ INSERT INTO chirps (
     body,
     created_at,
     updated_at,
-    user_id
-) VALUES (gen_random_uuid(), $1, now(), now(), $2)
+    user_id,
+    publish_at,
+    announced_at
+) VALUES (
+    gen_random_uuid(),
+    $1,
+    now(),
+    now(),
+    $2,
+    coalesce(sqlc.narg(publish_at)::TIMESTAMP, now()),
+    CASE WHEN sqlc.narg(publish_at)::TIMESTAMP IS NULL THEN now() END
+)
+RETURNING *;
+
+-- name: ClaimDueChirpAnnouncements :many
+-- Marks scheduled chirps that have become visible as announced, the caller
+-- publishes chirp.created for the ones returned
+UPDATE chirps
+SET announced_at = now()
+WHERE id IN (
+    SELECT c.id
+    FROM chirps AS c
+    WHERE c.announced_at IS NULL AND c.publish_at <= now()
+    ORDER BY c.publish_at ASC
+    LIMIT sqlc.arg(max_chirps)::INTEGER
+    FOR UPDATE SKIP LOCKED
+)
 RETURNING *;
 
 -- name: ResetChirps :exec
@@ -14,6 +39,7 @@ DELETE FROM chirps;
 -- name: GetChirps :many
 SELECT *
 FROM chirps
+WHERE publish_at <= now()
 ORDER BY created_at ASC;
 
 -- name: GetChirpById :one
@@ -24,3 +50,32 @@ WHERE id = $1;
 -- name: DeleteChirpById :execrows
 DELETE FROM chirps
 WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteAnyChirpById :execrows
+DELETE FROM chirps
+WHERE id = $1;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = now()
+WHERE id = $2 AND user_id = $3
+RETURNING *;
+
+-- name: CountChirpsByUserSince :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = $1 AND created_at > $2;
+
+-- name: CountPinnedChirpsByUser :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = $1 AND pinned_at IS NOT NULL;
+
+-- name: SetChirpPinned :one
+UPDATE chirps
+SET
+    pinned_at = CASE
+        WHEN sqlc.arg(pinned)::BOOLEAN THEN coalesce(pinned_at, now())
+    END
+WHERE id = $1 AND user_id = $2
+RETURNING *;
@@ -0,0 +1,35 @@
+-- name: GetLoginThrottles :many
+SELECT *
+FROM login_throttles
+WHERE throttle_key = ANY(sqlc.arg(throttle_keys)::TEXT [])
+ORDER BY throttle_key ASC;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (
+    throttle_key,
+    failures,
+    last_failure_at
+) VALUES ($1, 1, now())
+ON CONFLICT (throttle_key) DO UPDATE
+SET
+    failures = CASE
+        WHEN login_throttles.last_failure_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = now()
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE throttle_key = $1;
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE throttle_key = $1;
+
+-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE
+    last_failure_at < $1
+    AND (locked_until IS NULL OR locked_until < now());
@@ -0,0 +1,61 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    name,
+    secret_hash,
+    redirect_uris
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetOAuthClientById :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    created_at,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES ($1, now(), $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = now()
+WHERE code_hash = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (
+    token,
+    created_at,
+    updated_at,
+    user_id,
+    expires_at,
+    client_id,
+    scopes
+) VALUES (
+    $1,
+    now(),
+    now(),
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: ConsumeOAuthRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE token = $1 AND revoked_at IS NULL
+RETURNING *;
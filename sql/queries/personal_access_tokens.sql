@@ -0,0 +1,40 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    name,
+    token_hash,
+    scopes,
+    expires_at
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT *
+FROM personal_access_tokens
+WHERE token_hash = $1;
+
+-- name: GetPersonalAccessTokensByUser :many
+SELECT *
+FROM personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = now()
+WHERE
+    id = $1
+    AND (last_used_at IS NULL OR last_used_at < now() - INTERVAL '1 minute');
+
+-- name: RevokeAllPersonalAccessTokens :execrows
+UPDATE personal_access_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE revoked_at IS NULL;
@@ -24,7 +24,10 @@ SELECT
     refresh_tokens.token,
     refresh_tokens.expires_at,
     refresh_tokens.revoked_at,
-    users.id AS user_id
+    refresh_tokens.client_id,
+    users.id AS user_id,
+    users.token_version,
+    users.banned_at
 FROM refresh_tokens
 INNER JOIN users
     ON refresh_tokens.user_id = users.id
@@ -35,3 +38,8 @@ UPDATE refresh_tokens
 SET updated_at = now(), revoked_at = now()
 WHERE token = $1
 RETURNING *;
+
+-- name: RevokeAllRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = now(), revoked_at = now()
+WHERE revoked_at IS NULL AND expires_at > now();
@@ -0,0 +1,38 @@
+-- name: GetSubscriptionByUser :one
+SELECT *
+FROM subscriptions
+WHERE user_id = $1;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    plan,
+    status,
+    current_period_start,
+    current_period_end,
+    grace_period_end,
+    canceled_at,
+    access_until
+) VALUES (
+    gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5, $6, $7, $8
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    updated_at = now(),
+    plan = excluded.plan,
+    status = excluded.status,
+    current_period_start = excluded.current_period_start,
+    current_period_end = excluded.current_period_end,
+    grace_period_end = excluded.grace_period_end,
+    canceled_at = excluded.canceled_at,
+    access_until = excluded.access_until
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :many
+UPDATE subscriptions
+SET status = 'expired', updated_at = now()
+WHERE status <> 'expired' AND access_until <= now()
+RETURNING user_id;
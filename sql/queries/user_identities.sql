@@ -0,0 +1,16 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    provider,
+    subject,
+    email
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE provider = $1 AND subject = $2;
@@ -4,9 +4,8 @@ INSERT INTO users (
     created_at,
     updated_at,
     email,
-    hashed_password,
-    is_chirpy_red
-) VALUES (gen_random_uuid(), now(), now(), $1, $2, false)
+    hashed_password
+) VALUES (gen_random_uuid(), now(), now(), $1, $2)
 RETURNING *;
 
 -- name: ResetUsers :exec
@@ -28,8 +27,33 @@ SET email = $1, hashed_password = $2, updated_at = now()
 WHERE id = $3
 RETURNING *;
 
--- name: UpgradeUserToChirpyRed :one
+-- name: UpdateUserRole :one
 UPDATE users
-SET is_chirpy_red = true
+SET role = $1, updated_at = now()
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserPasswordHash :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
 WHERE id = $1
+RETURNING token_version;
+
+-- name: IncrementAllUserTokenVersions :execrows
+UPDATE users
+SET token_version = token_version + 1;
+
+-- name: SetUserBanned :one
+UPDATE users
+SET
+    banned_at = CASE
+        WHEN sqlc.arg(banned)::BOOLEAN THEN coalesce(banned_at, now())
+    END,
+    updated_at = now()
+WHERE id = sqlc.arg(id)
 RETURNING *;
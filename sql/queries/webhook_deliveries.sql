@@ -0,0 +1,58 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (
+    id,
+    created_at,
+    updated_at,
+    endpoint_id,
+    event_id,
+    event_type,
+    payload,
+    next_attempt_at
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4, now())
+RETURNING *;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Pushes next_attempt_at out to lease_until so other workers skip the
+-- deliveries while they are being attempted
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)::TIMESTAMP, updated_at = now()
+WHERE id IN (
+    SELECT d.id
+    FROM webhook_deliveries AS d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= now()
+    ORDER BY d.next_attempt_at ASC
+    LIMIT sqlc.arg(max_deliveries)::INTEGER
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: FinishWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET
+    updated_at = now(),
+    status = $2,
+    attempts = attempts + 1,
+    next_attempt_at = $3,
+    last_attempt_at = now(),
+    response_status = $4,
+    last_error = $5
+WHERE id = $1
+RETURNING *;
+
+-- name: GetWebhookDeliveryById :one
+SELECT *
+FROM webhook_deliveries
+WHERE id = $1;
+
+-- name: GetWebhookDeliveriesByEndpoint :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', next_attempt_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING *;
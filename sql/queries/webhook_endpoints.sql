@@ -0,0 +1,65 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    url,
+    secret,
+    event_types
+) VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetWebhookEndpointById :one
+SELECT *
+FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: GetWebhookEndpointsByUser :many
+SELECT *
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetWebhookEndpointsForEvent :many
+SELECT *
+FROM webhook_endpoints
+WHERE
+    user_id = $1
+    AND enabled
+    AND sqlc.arg(event_type)::TEXT = ANY(event_types);
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET
+    updated_at = now(),
+    enabled = true,
+    consecutive_failures = 0,
+    disabled_at = NULL
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = $1;
+
+-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+SET
+    consecutive_failures = consecutive_failures + 1,
+    enabled = enabled
+    AND consecutive_failures + 1 < sqlc.arg(disable_after)::INTEGER,
+    disabled_at = CASE
+        WHEN
+            enabled
+            AND consecutive_failures + 1 >= sqlc.arg(disable_after)::INTEGER
+            THEN now()
+        ELSE disabled_at
+    END
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,62 @@
+-- name: RecordWebhookEvent :one
+INSERT INTO webhook_events (
+    id,
+    provider,
+    event_id,
+    event_type,
+    payload,
+    received_at
+) VALUES (gen_random_uuid(), $1, $2, $3, $4, now())
+ON CONFLICT (provider, event_id) DO UPDATE
+SET attempts = webhook_events.attempts + 1
+RETURNING *;
+
+-- name: RetryWebhookEvent :one
+UPDATE webhook_events
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+SET claimed_at = now()
+WHERE
+    id = sqlc.arg(id)
+    AND (
+        sqlc.arg(any_outcome)::BOOLEAN
+        OR outcome IN ('pending', 'failed', 'invalid')
+    )
+    AND (
+        claimed_at IS NULL
+        OR claimed_at < sqlc.arg(stale_before)::TIMESTAMP
+    )
+RETURNING *;
+
+-- name: ReleaseWebhookEvent :exec
+-- Gives up a claim without recording an outcome
+UPDATE webhook_events
+SET claimed_at = NULL
+WHERE id = $1;
+
+-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+SET outcome = $2, error = $3, processed_at = now(), claimed_at = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: GetWebhookEventById :one
+SELECT *
+FROM webhook_events
+WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT *
+FROM webhook_events
+WHERE
+    (sqlc.narg(provider)::TEXT IS NULL OR provider = sqlc.narg(provider))
+    AND (
+        sqlc.narg(outcome)::WEBHOOK_EVENT_OUTCOME IS NULL
+        OR outcome = sqlc.narg(outcome)
+    )
+ORDER BY received_at DESC
+LIMIT $1 OFFSET $2;
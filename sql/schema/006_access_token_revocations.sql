@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE access_token_revocations (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    jti TEXT UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+-- +goose Down
+DROP TABLE access_token_revocations;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    throttle_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TYPE webhook_event_outcome AS ENUM (
+    'pending', 'processed', 'ignored', 'failed'
+);
+
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY,
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP,
+    outcome WEBHOOK_EVENT_OUTCOME NOT NULL DEFAULT 'pending',
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+-- +goose Down
+DROP TABLE webhook_events;
+DROP TYPE webhook_event_outcome;
@@ -0,0 +1,55 @@
+-- +goose Up
+CREATE TYPE subscription_status AS ENUM (
+    'active', 'past_due', 'canceled', 'expired'
+);
+
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL,
+    status SUBSCRIPTION_STATUS NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    grace_period_end TIMESTAMP,
+    canceled_at TIMESTAMP,
+    -- access_until is when the member loses Chirpy Red unless an event
+    -- extends it
+    access_until TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_access_until_idx ON subscriptions (access_until)
+WHERE status <> 'expired';
+
+-- Existing members only ever received an upgrade, start them on a fresh period
+INSERT INTO subscriptions (
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    plan,
+    status,
+    current_period_start,
+    current_period_end,
+    access_until
+)
+SELECT
+    gen_random_uuid(),
+    now(),
+    now(),
+    id,
+    'chirpy_red',
+    'active',
+    now(),
+    now() + INTERVAL '30 days',
+    now() + INTERVAL '33 days'
+FROM users
+WHERE is_chirpy_red;
+-- +goose Down
+DROP TABLE subscriptions;
+DROP TYPE subscription_status;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN pinned_at TIMESTAMP,
+ADD COLUMN publish_at TIMESTAMP NOT NULL DEFAULT now();
+
+UPDATE chirps SET publish_at = created_at;
+
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+
+ALTER TABLE chirps
+DROP COLUMN publish_at,
+DROP COLUMN pinned_at;
@@ -0,0 +1,17 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE webhook_event_outcome ADD VALUE IF NOT EXISTS 'unhandled';
+ALTER TYPE webhook_event_outcome ADD VALUE IF NOT EXISTS 'invalid';
+-- +goose Down
+UPDATE webhook_events SET outcome = 'ignored' WHERE outcome = 'unhandled';
+UPDATE webhook_events SET outcome = 'failed' WHERE outcome = 'invalid';
+ALTER TYPE webhook_event_outcome RENAME TO webhook_event_outcome_old;
+CREATE TYPE webhook_event_outcome AS ENUM (
+    'pending', 'processed', 'ignored', 'failed'
+);
+ALTER TABLE webhook_events
+ALTER COLUMN outcome DROP DEFAULT,
+ALTER COLUMN outcome TYPE WEBHOOK_EVENT_OUTCOME
+USING outcome::TEXT::WEBHOOK_EVENT_OUTCOME,
+ALTER COLUMN outcome SET DEFAULT 'pending';
+DROP TYPE webhook_event_outcome_old;
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE access_token_revocations
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- Tokens issued before this migration carry no version, users revoked before
+-- it move to version 1 so their old tokens stay revoked
+UPDATE access_token_revocations SET token_version = 1 WHERE jti IS NULL;
+
+UPDATE users SET token_version = 1
+WHERE id IN (
+    SELECT user_id
+    FROM access_token_revocations
+    WHERE jti IS NULL
+);
+-- +goose Down
+ALTER TABLE access_token_revocations
+DROP COLUMN token_version;
+
+ALTER TABLE users
+DROP COLUMN token_version;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- announced_at is when chirp.created was published for the chirp, scheduled
+-- chirps are announced once their publish_at has passed
+ALTER TABLE chirps
+ADD COLUMN announced_at TIMESTAMP;
+UPDATE chirps SET announced_at = created_at;
+CREATE INDEX chirps_unannounced_publish_at_idx ON chirps (publish_at)
+WHERE announced_at IS NULL;
+-- +goose Down
+DROP INDEX chirps_unannounced_publish_at_idx;
+ALTER TABLE chirps
+DROP COLUMN announced_at;
@@ -0,0 +1,18 @@
+// Package schema embeds the goose migrations so the binary can check and
+// apply them without the source tree
+package schema
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed *.sql
+var Migrations embed.FS
+
+// NewProvider runs the embedded migrations against db
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	return goose.NewProvider(goose.DialectPostgres, db, Migrations)
+}
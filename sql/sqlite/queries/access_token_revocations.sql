@@ -0,0 +1,24 @@
+-- name: CreateAccessTokenRevocation :one
+INSERT INTO access_token_revocations (user_id, jti, expires_at, token_version)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (jti) DO UPDATE SET expires_at = excluded.expires_at
+RETURNING *;
+
+-- name: GetActiveAccessTokenRevocations :many
+SELECT *
+FROM access_token_revocations
+WHERE expires_at > strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+ORDER BY created_at ASC, rowid ASC;
+
+-- name: DeleteExpiredAccessTokenRevocations :execrows
+DELETE FROM access_token_revocations
+WHERE expires_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now');
+
+-- name: RevokeAllAccessTokens :execrows
+INSERT INTO access_token_revocations (user_id, jti, expires_at, token_version)
+SELECT
+    users.id,
+    NULL,
+    sqlc.arg(expires_at),
+    users.token_version
+FROM users;
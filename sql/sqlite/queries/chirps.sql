@@ -0,0 +1,77 @@
+-- name: CreateChirp :one
+-- sqlc can't type publish_at here and CAST(... AS TIMESTAMP) would turn the
+-- text into a number, so it is passed untyped
+INSERT INTO chirps (body, user_id, publish_at, announced_at)
+VALUES (
+    sqlc.arg(body),
+    sqlc.arg(user_id),
+    coalesce(sqlc.narg(publish_at), strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CASE
+        WHEN sqlc.narg(publish_at) IS NULL
+            THEN strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    END
+)
+RETURNING *;
+
+-- name: ClaimDueChirpAnnouncements :many
+-- Marks scheduled chirps that have become visible as announced, the caller
+-- publishes chirp.created for the ones returned
+UPDATE chirps
+SET announced_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id IN (
+    SELECT c.id
+    FROM chirps AS c
+    WHERE
+        c.announced_at IS NULL
+        AND c.publish_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ORDER BY c.publish_at ASC
+    LIMIT CAST(sqlc.arg(max_chirps) AS INTEGER)
+)
+RETURNING *;
+
+-- name: ResetChirps :exec
+DELETE FROM chirps;
+
+-- name: GetChirps :many
+SELECT *
+FROM chirps
+WHERE publish_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+ORDER BY created_at ASC, rowid ASC;
+
+-- name: GetChirpById :one
+SELECT *
+FROM chirps
+WHERE id = ?;
+
+-- name: DeleteChirpById :execrows
+DELETE FROM chirps
+WHERE id = ? AND user_id = ?;
+
+-- name: DeleteAnyChirpById :execrows
+DELETE FROM chirps
+WHERE id = ?;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ? AND user_id = ?
+RETURNING *;
+
+-- name: CountChirpsByUserSince :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = ? AND created_at > ?;
+
+-- name: CountPinnedChirpsByUser :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = ? AND pinned_at IS NOT NULL;
+
+-- name: SetChirpPinned :one
+UPDATE chirps
+SET
+    pinned_at = CASE
+        WHEN CAST(sqlc.arg(pinned) AS BOOLEAN) THEN coalesce(pinned_at, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+    END
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
@@ -0,0 +1,45 @@
+-- name: GetLoginThrottles :many
+SELECT *
+FROM login_throttles
+WHERE throttle_key IN (sqlc.slice(throttle_keys))
+ORDER BY throttle_key ASC;
+
+-- name: RecordLoginFailure :one
+-- SQLite upserts can't bind parameters in DO UPDATE, so the new count is
+-- worked out in the inserted row
+INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+VALUES (
+    sqlc.arg(throttle_key),
+    coalesce((
+        SELECT
+            CASE
+                WHEN
+                    t.last_failure_at < sqlc.arg(reset_before)
+                    THEN 1
+                ELSE t.failures + 1
+            END
+        FROM login_throttles AS t
+        WHERE t.throttle_key = sqlc.arg(throttle_key)
+    ), 1),
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+)
+ON CONFLICT (throttle_key) DO UPDATE
+SET
+    failures = excluded.failures,
+    last_failure_at = excluded.last_failure_at
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = sqlc.narg(locked_until)
+WHERE throttle_key = sqlc.arg(throttle_key);
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE throttle_key = ?;
+
+-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE
+    last_failure_at < ?
+    AND (locked_until IS NULL OR locked_until < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
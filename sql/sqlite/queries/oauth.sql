@@ -0,0 +1,38 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (user_id, name, secret_hash, redirect_uris)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetOAuthClientById :one
+SELECT *
+FROM oauth_clients
+WHERE id = ?;
+
+-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE code_hash = ? AND used_at IS NULL
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (token, user_id, expires_at, client_id, scopes)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ConsumeOAuthRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE token = ? AND revoked_at IS NULL
+RETURNING *;
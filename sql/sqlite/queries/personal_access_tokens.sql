@@ -0,0 +1,40 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (
+    user_id,
+    name,
+    token_hash,
+    scopes,
+    expires_at
+) VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT *
+FROM personal_access_tokens
+WHERE token_hash = ?;
+
+-- name: GetPersonalAccessTokensByUser :many
+SELECT *
+FROM personal_access_tokens
+WHERE user_id = ?
+ORDER BY created_at ASC, rowid ASC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ? AND user_id = ? AND revoked_at IS NULL;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE
+    id = ?
+    AND (
+        last_used_at IS NULL
+        OR last_used_at < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', '-1 minute')
+    );
+
+-- name: RevokeAllPersonalAccessTokens :execrows
+UPDATE personal_access_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE revoked_at IS NULL;
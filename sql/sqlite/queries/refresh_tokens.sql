@@ -0,0 +1,34 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token, user_id, expires_at)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token = ?;
+
+-- name: GetUserFromRefreshToken :one
+SELECT
+    refresh_tokens.token,
+    refresh_tokens.expires_at,
+    refresh_tokens.revoked_at,
+    refresh_tokens.client_id,
+    users.id AS user_id,
+    users.token_version,
+    users.banned_at
+FROM refresh_tokens
+INNER JOIN users
+    ON refresh_tokens.user_id = users.id
+WHERE refresh_tokens.token = ?;
+
+-- name: RevokeRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE token = ?
+RETURNING *;
+
+-- name: RevokeAllRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE revoked_at IS NULL AND expires_at > strftime('%Y-%m-%d %H:%M:%f+00:00', 'now');
@@ -0,0 +1,33 @@
+-- name: GetSubscriptionByUser :one
+SELECT *
+FROM subscriptions
+WHERE user_id = ?;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (
+    user_id,
+    plan,
+    status,
+    current_period_start,
+    current_period_end,
+    grace_period_end,
+    canceled_at,
+    access_until
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    plan = excluded.plan,
+    status = excluded.status,
+    current_period_start = excluded.current_period_start,
+    current_period_end = excluded.current_period_end,
+    grace_period_end = excluded.grace_period_end,
+    canceled_at = excluded.canceled_at,
+    access_until = excluded.access_until
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :many
+UPDATE subscriptions
+SET status = 'expired', updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE status <> 'expired' AND access_until <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+RETURNING user_id;
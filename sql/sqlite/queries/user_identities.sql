@@ -0,0 +1,9 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE provider = ? AND subject = ?;
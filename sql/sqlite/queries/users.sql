@@ -0,0 +1,57 @@
+-- name: CreateUser :one
+INSERT INTO users (email, hashed_password)
+VALUES (?, ?)
+RETURNING *;
+
+-- name: ResetUsers :exec
+DELETE FROM users;
+
+-- name: GetUserByEmail :one
+SELECT *
+FROM users
+WHERE email = ?;
+
+-- name: GetUserById :one
+SELECT *
+FROM users
+WHERE id = ?;
+
+-- name: UpdateUserById :one
+UPDATE users
+SET
+    email = ?,
+    hashed_password = ?,
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateUserPasswordHash :exec
+UPDATE users
+SET hashed_password = ?
+WHERE id = ?;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = ?
+RETURNING token_version;
+
+-- name: IncrementAllUserTokenVersions :execrows
+UPDATE users
+SET token_version = token_version + 1;
+
+-- name: SetUserBanned :one
+UPDATE users
+SET
+    banned_at = CASE
+        WHEN CAST(sqlc.arg(banned) AS BOOLEAN) THEN coalesce(banned_at, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+    END,
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = sqlc.arg(id)
+RETURNING *;
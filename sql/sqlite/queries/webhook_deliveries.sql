@@ -0,0 +1,52 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Pushes next_attempt_at out to lease_until so other workers skip the
+-- deliveries while they are being attempted, SQLite has one writer at a time
+-- so there is no row locking to do
+UPDATE webhook_deliveries
+SET
+    next_attempt_at = sqlc.arg(lease_until),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id IN (
+    SELECT d.id
+    FROM webhook_deliveries AS d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ORDER BY d.next_attempt_at ASC
+    LIMIT CAST(sqlc.arg(max_deliveries) AS INTEGER)
+)
+RETURNING *;
+
+-- name: FinishWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    status = sqlc.arg(status),
+    attempts = attempts + 1,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    last_attempt_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    response_status = sqlc.narg(response_status),
+    last_error = sqlc.narg(last_error)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetWebhookDeliveryById :one
+SELECT *
+FROM webhook_deliveries
+WHERE id = ?;
+
+-- name: GetWebhookDeliveriesByEndpoint :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT ?;
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', next_attempt_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = ?
+RETURNING *;
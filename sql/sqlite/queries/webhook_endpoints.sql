@@ -0,0 +1,63 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (user_id, url, secret, event_types)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetWebhookEndpointById :one
+SELECT *
+FROM webhook_endpoints
+WHERE id = ?;
+
+-- name: GetWebhookEndpointsByUser :many
+SELECT *
+FROM webhook_endpoints
+WHERE user_id = ?
+ORDER BY created_at ASC, rowid ASC;
+
+-- name: GetWebhookEndpointsForEvent :many
+SELECT *
+FROM webhook_endpoints
+WHERE
+    user_id = sqlc.arg(user_id)
+    AND enabled
+    AND EXISTS (
+        SELECT 1
+        FROM json_each(webhook_endpoints.event_types)
+        WHERE json_each.value = CAST(sqlc.arg(event_type) AS TEXT)
+    );
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = ? AND user_id = ?;
+
+-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    enabled = true,
+    consecutive_failures = 0,
+    disabled_at = NULL
+WHERE id = ? AND user_id = ?
+RETURNING *;
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = ?;
+
+-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+SET
+    consecutive_failures = consecutive_failures + 1,
+    enabled = enabled
+    AND consecutive_failures + 1 < CAST(sqlc.arg(disable_after) AS INTEGER),
+    disabled_at = CASE
+        WHEN
+            enabled
+            AND consecutive_failures + 1
+            >= CAST(sqlc.arg(disable_after) AS INTEGER)
+            THEN strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+        ELSE disabled_at
+    END
+WHERE id = sqlc.arg(id)
+RETURNING *;
@@ -0,0 +1,63 @@
+-- name: RecordWebhookEvent :one
+INSERT INTO webhook_events (provider, event_id, event_type, payload)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (provider, event_id) DO UPDATE
+SET attempts = webhook_events.attempts + 1
+RETURNING *;
+
+-- name: RetryWebhookEvent :one
+UPDATE webhook_events
+SET attempts = attempts + 1
+WHERE id = ?
+RETURNING *;
+
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+SET claimed_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE
+    id = sqlc.arg(id)
+    AND (
+        CAST(sqlc.arg(any_outcome) AS BOOLEAN)
+        OR outcome IN ('pending', 'failed', 'invalid')
+    )
+    AND (
+        claimed_at IS NULL
+        OR claimed_at < sqlc.arg(stale_before)
+    )
+RETURNING *;
+
+-- name: ReleaseWebhookEvent :exec
+-- Gives up a claim without recording an outcome
+UPDATE webhook_events
+SET claimed_at = NULL
+WHERE id = ?;
+
+-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+SET
+    outcome = sqlc.arg(outcome),
+    error = sqlc.narg(error),
+    processed_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    claimed_at = NULL
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetWebhookEventById :one
+SELECT *
+FROM webhook_events
+WHERE id = ?;
+
+-- name: ListWebhookEvents :many
+SELECT *
+FROM webhook_events
+WHERE
+    (
+        CAST(sqlc.narg(provider) AS TEXT) IS NULL
+        OR provider = sqlc.narg(provider)
+    )
+    AND (
+        CAST(sqlc.narg(outcome) AS TEXT) IS NULL
+        OR outcome = sqlc.narg(outcome)
+    )
+ORDER BY received_at DESC, rowid DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
@@ -0,0 +1,350 @@
+-- +goose Up
+-- The Postgres schema as of 016_webhook_event_outcomes in one migration.
+-- Defaults replace gen_random_uuid() with a random UUID v4 and now() with UTC
+-- text in the format the driver writes times, so timestamps compare and sort
+-- as text. Enums are checked text and arrays are JSON.
+CREATE TABLE users (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    hashed_password TEXT NOT NULL,
+    is_chirpy_red BOOLEAN NOT NULL DEFAULT false,
+    role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'moderator', 'admin'))
+);
+
+CREATE TABLE chirps (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    pinned_at TIMESTAMP,
+    publish_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris JSON NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    client_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes JSON NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_client_id
+    FOREIGN KEY (client_id)
+    REFERENCES oauth_clients (id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE refresh_tokens (
+    token TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    client_id UUID REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scopes JSON,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE access_token_revocations (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    jti TEXT UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE personal_access_tokens (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes JSON NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE,
+    CONSTRAINT uq_provider_subject
+    UNIQUE (provider, subject)
+);
+
+CREATE TABLE login_throttles (
+    throttle_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    processed_at TIMESTAMP,
+    outcome TEXT NOT NULL DEFAULT 'pending'
+    CHECK (
+        outcome IN (
+            'pending', 'processed', 'ignored', 'failed', 'unhandled', 'invalid'
+        )
+    ),
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL
+    CHECK (status IN ('active', 'past_due', 'canceled', 'expired')),
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    grace_period_end TIMESTAMP,
+    canceled_at TIMESTAMP,
+    -- access_until is when the member loses Chirpy Red unless an event
+    -- extends it
+    access_until TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_access_until_idx ON subscriptions (access_until)
+WHERE status <> 'expired';
+
+CREATE TABLE webhook_endpoints (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    user_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    -- the secret is needed in plain text to sign deliveries
+    secret TEXT NOT NULL,
+    event_types JSON NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users (id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT (
+        lower(
+            hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4'
+            || substr(hex(randomblob(2)), 2) || '-'
+            || substr('89ab', 1 + (abs(random()) % 4), 1)
+            || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+        )
+    ),
+    created_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    updated_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    endpoint_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending'
+    CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT (
+        strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+    ),
+    last_attempt_at TIMESTAMP,
+    response_status INTEGER,
+    last_error TEXT,
+    CONSTRAINT fk_endpoint_id
+    FOREIGN KEY (endpoint_id)
+    REFERENCES webhook_endpoints (id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
+DROP TABLE subscriptions;
+DROP TABLE webhook_events;
+DROP TABLE login_throttles;
+DROP TABLE user_identities;
+DROP TABLE personal_access_tokens;
+DROP TABLE access_token_revocations;
+DROP TABLE refresh_tokens;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
+DROP TABLE chirps;
+DROP TABLE users;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN banned_at TIMESTAMP;
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN banned_at;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE webhook_events
+ADD COLUMN claimed_at TIMESTAMP;
+-- +goose Down
+ALTER TABLE webhook_events
+DROP COLUMN claimed_at;
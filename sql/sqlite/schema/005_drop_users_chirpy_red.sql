@@ -0,0 +1,16 @@
+-- +goose Up
+-- Chirpy Red membership is read from the user's subscription
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT false;
+UPDATE users
+SET is_chirpy_red = true
+WHERE id IN (
+    SELECT user_id
+    FROM subscriptions
+    WHERE
+        status <> 'expired'
+        AND access_until > strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+);
@@ -0,0 +1,18 @@
+// Package schema embeds the SQLite goose migrations, the equivalent of
+// sql/schema up to 016 squashed into one and the later ones alongside
+package schema
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed *.sql
+var Migrations embed.FS
+
+// NewProvider runs the embedded migrations against db
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	return goose.NewProvider(goose.DialectSQLite3, db, Migrations)
+}